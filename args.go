@@ -0,0 +1,72 @@
+package instrumentedsql
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/kr/pretty"
+)
+
+// recordArgs records the args of the operation in the args label, hashed or with their personal data masked if configured
+func (c *opCall) recordArgs() {
+	args := c.args
+	if c.argsHashKey != nil {
+		args = hashArgs(c.argsHashKey, args)
+	} else if c.piiMasking {
+		var kinds []string
+		args, kinds = maskPII(args)
+		if len(kinds) > 0 {
+			c.setLabel("pii", strings.Join(kinds, ","))
+		}
+	}
+
+	c.setLabel("args", pretty.Sprint(args))
+}
+
+// HashArg returns the hash of value recorded in the args label by WithArgsHashing with key,
+// so that the queries run for a known identifier can be searched for
+func HashArg(key []byte, value interface{}) string {
+	mac := hmac.New(sha256.New, key)
+	if b, ok := value.([]byte); ok {
+		mac.Write(b)
+	} else {
+		fmt.Fprint(mac, value)
+	}
+
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// hashArgs returns a copy of args where the values that are not nil are replaced by their hash, see HashArg
+func hashArgs(key []byte, args []driver.NamedValue) []driver.NamedValue {
+	hashed := make([]driver.NamedValue, len(args))
+	for n, arg := range args {
+		hashed[n] = arg
+		if arg.Value != nil {
+			hashed[n].Value = HashArg(key, arg.Value)
+		}
+	}
+
+	return hashed
+}
+
+// argsSize approximates the number of bytes sent for args, strings and byte slices count for their length, other values for 8 bytes
+func argsSize(args []driver.NamedValue) int64 {
+	var size int64
+	for _, arg := range args {
+		switch v := arg.Value.(type) {
+		case nil:
+		case string:
+			size += int64(len(v))
+		case []byte:
+			size += int64(len(v))
+		default:
+			size += 8
+		}
+	}
+
+	return size
+}
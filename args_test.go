@@ -0,0 +1,43 @@
+package instrumentedsql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestArgsSummary(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithArgsSummary()), "")
+	if _, err := db.Exec("UPDATE t SET a = ? WHERE b IN (?, ?)", "secret", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	op := logger.AssertQuery(t, "UPDATE t SET a = ? WHERE b IN (?, ?)")
+	if op.Args != "" || op.Labels["arg_count"] != "3" || op.Labels["args_size"] != "22" {
+		t.Errorf("query recorded with args %q and labels %v", op.Args, op.Labels)
+	}
+}
+
+func TestArgsHashing(t *testing.T) {
+	key := []byte("service key")
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithArgsHashing(key)), "")
+
+	for _, id := range []interface{}{int64(42), "42", nil} {
+		if _, err := db.ExecContext(context.Background(), "UPDATE users SET n = 1 WHERE id = ?", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	execs := logger.Find(string(OpSQLConnExec))
+	hash := HashArg(key, 42)
+	if !strings.Contains(execs[0].Args, hash) || !strings.Contains(execs[1].Args, hash) || strings.Contains(execs[2].Args, "hmac") {
+		t.Errorf("logged args %q, %q and %q, want the ids hashed to %s", execs[0].Args, execs[1].Args, execs[2].Args, hash)
+	}
+	if HashArg([]byte("other key"), 42) == hash {
+		t.Error("hash does not depend on the key")
+	}
+}
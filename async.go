@@ -0,0 +1,107 @@
+package instrumentedsql
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncLogger is a Logger passing log entries to another one from a background goroutine, through a bounded buffer,
+// so that a slow logger does not slow queries down. Entries are dropped when the buffer is full.
+type AsyncLogger struct {
+	logger  Logger
+	entries chan asyncLogEntry
+	dropped uint64
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type asyncLogEntry struct {
+	ctx     context.Context
+	msg     string
+	keyvals []interface{}
+	// flushed is set for the entries marking a flush, it is closed once the entries buffered before are logged
+	flushed chan struct{}
+}
+
+// NewAsyncLogger returns an AsyncLogger passing up to size buffered entries to logger.
+// The contexts of the entries may be done by the time logger gets them. Close must be called to stop it.
+func NewAsyncLogger(logger Logger, size int) *AsyncLogger {
+	l := &AsyncLogger{logger: logger, entries: make(chan asyncLogEntry, size), done: make(chan struct{})}
+	go l.run()
+
+	return l
+}
+
+func (l *AsyncLogger) run() {
+	defer close(l.done)
+
+	for e := range l.entries {
+		if e.flushed != nil {
+			close(e.flushed)
+			continue
+		}
+		l.logger.Log(e.ctx, e.msg, e.keyvals...)
+	}
+}
+
+// Log buffers the entry, or drops it if the buffer is full or the logger closed
+func (l *AsyncLogger) Log(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		atomic.AddUint64(&l.dropped, 1)
+		return
+	}
+
+	select {
+	case l.entries <- asyncLogEntry{ctx: ctx, msg: msg, keyvals: keyvals}:
+	default:
+		atomic.AddUint64(&l.dropped, 1)
+	}
+}
+
+// Flush waits until the entries buffered so far are logged, or returns the error of ctx if it is done first
+func (l *AsyncLogger) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return nil
+	}
+	select {
+	case l.entries <- asyncLogEntry{flushed: flushed}:
+	case <-ctx.Done():
+		l.mu.RUnlock()
+		return ctx.Err()
+	}
+	l.mu.RUnlock()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns the number of entries dropped so far
+func (l *AsyncLogger) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+// Close stops the logger once the buffered entries are logged, entries logged afterwards are dropped
+func (l *AsyncLogger) Close() {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.entries)
+	}
+	l.mu.Unlock()
+
+	<-l.done
+}
@@ -0,0 +1,64 @@
+package instrumentedsql
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncLogger(t *testing.T) {
+	block := make(chan struct{})
+	var logged []string
+	l := NewAsyncLogger(LoggerFunc(func(ctx context.Context, msg string, keyvals ...interface{}) {
+		<-block
+		logged = append(logged, msg)
+	}), 2)
+
+	// The first entry is taken by the background goroutine, the next two fill the buffer
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		l.Log(context.Background(), msg)
+	}
+	close(block)
+	l.Close()
+	l.Log(context.Background(), "f")
+
+	if len(logged) < 2 || logged[0] != "a" || logged[1] != "b" {
+		t.Errorf("logged %v, want the first entries in order", logged)
+	}
+	if dropped := l.Dropped(); dropped != uint64(6-len(logged)) {
+		t.Errorf("dropped %d entries, logged %d of 6", dropped, len(logged))
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var mu sync.Mutex
+	var logged []string
+	async := NewAsyncLogger(LoggerFunc(func(ctx context.Context, msg string, keyvals ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, msg)
+	}), 10)
+	defer async.Close()
+
+	var reported []QueryStats
+	d := WrapDriver(&fakeDriver{}, WithLogger(async), WithSlowQueryReport(time.Hour, 5, func(stats []QueryStats) {
+		reported = append(reported, stats...)
+	}))
+	db := openBenchDB(t, d, "")
+	if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.(interface{ Shutdown(context.Context) error }).Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 1 {
+		t.Errorf("reported %+v, want the query of the interval in progress", reported)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logged) != 2 || logged[1] != string(OpSQLConnExec) {
+		t.Errorf("logged %v before Shutdown returned", logged)
+	}
+}
@@ -0,0 +1,83 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// AuditRecord describes a statement modifying data or schema, see WithAuditWriter
+type AuditRecord struct {
+	Time time.Time
+	Op   Op
+	// Statement is the type of the statement, INSERT, UPDATE, DELETE or DDL
+	Statement string
+	// Query is the fingerprint of the query, with its literals and placeholders replaced by ?, so that no data is recorded
+	Query string
+	// RowsAffected is the number of rows the statement changed, -1 if the parent driver does not tell,
+	// or for the statements run as queries, such as INSERT ... RETURNING
+	RowsAffected int64
+	Duration     time.Duration
+	Err          error
+	// DB is the name passed to WithDBName and ConnID identifies the connection, as in the conn_id label
+	DB     string
+	ConnID uint64
+	// Attributes are the attributes of the context of the statement, see WithContextAttributes, such as the user ID
+	Attributes map[string]string
+	// Tenant is the tenant the statement was run for, see WithTenantExtractor
+	Tenant string
+}
+
+// AuditWriter records the audit trail of the statements modifying data or schema, see WithAuditWriter.
+// It is called synchronously once the statement is done, implementations should buffer records if writing them is slow.
+type AuditWriter interface {
+	WriteAudit(ctx context.Context, record AuditRecord) error
+}
+
+// AuditWriterFunc is an adapter which allows a function to be used as an AuditWriter
+type AuditWriterFunc func(ctx context.Context, record AuditRecord) error
+
+// WriteAudit calls f(ctx, record)
+func (f AuditWriterFunc) WriteAudit(ctx context.Context, record AuditRecord) error {
+	return f(ctx, record)
+}
+
+// audit writes the audit record of the operation if it modifies data or schema, failures to write it are logged
+// as a sql-audit-failed warning
+func (c *opCall) audit(err error, duration time.Duration) {
+	if !isStatementOp(c.op) || err == driver.ErrSkip {
+		return
+	}
+	verb := parseStatement(c.query).verb
+	switch verb {
+	case statementInsert, statementUpdate, statementDelete, statementDDL:
+	default:
+		return
+	}
+
+	record := AuditRecord{
+		Time:         c.start,
+		Op:           c.op,
+		Statement:    verb,
+		Query:        c.fingerprint(),
+		RowsAffected: -1,
+		Duration:     duration,
+		Err:          err,
+		DB:           c.dbName,
+		ConnID:       c.conn.id,
+		Tenant:       c.tenant,
+	}
+	if res, ok := c.result.(driver.Result); ok && err == nil {
+		if n, err := res.RowsAffected(); err == nil {
+			record.RowsAffected = n
+		}
+	}
+	ctx := c.routeContext()
+	if c.contextAttributes != nil {
+		record.Attributes = c.contextAttributes(ctx)
+	}
+
+	if err := c.auditWriter.WriteAudit(ctx, record); err != nil {
+		c.events.Log(ctx, "sql-audit-failed", "op", c.opName(c.op), "query", record.Query, "err", err.Error())
+	}
+}
@@ -0,0 +1,48 @@
+package instrumentedsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+type userKey struct{}
+
+func TestAuditWriter(t *testing.T) {
+	var records []AuditRecord
+	writer := AuditWriterFunc(func(ctx context.Context, record AuditRecord) error {
+		records = append(records, record)
+		if record.Statement == statementDDL {
+			return errors.New("audit log unavailable")
+		}
+		return nil
+	})
+	attributes := func(ctx context.Context) map[string]string {
+		user, _ := ctx.Value(userKey{}).(string)
+		return map[string]string{"user_id": user}
+	}
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithDBName("app"), WithContextAttributes(attributes),
+		WithAuditWriter(writer)), "")
+	ctx := context.WithValue(context.Background(), userKey{}, "42")
+
+	for _, query := range []string{"SELECT n FROM t", "UPDATE t SET secret = 'hunter2' WHERE id = 1", "CREATE TABLE u (id int)"} {
+		if _, err := db.ExecContext(Skip(ctx), query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("audited %d statements, want 2", len(records))
+	}
+	update := records[0]
+	if update.Statement != statementUpdate || update.Query != "UPDATE t SET secret = ? WHERE id = ?" || update.RowsAffected != 1 ||
+		update.DB != "app" || update.Attributes["user_id"] != "42" || update.Time.IsZero() {
+		t.Errorf("audit record is %+v", update)
+	}
+	if failures := logger.Find("sql-audit-failed"); len(failures) != 1 {
+		t.Errorf("logged %d audit failures, want 1", len(failures))
+	}
+}
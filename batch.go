@@ -0,0 +1,98 @@
+package instrumentedsql
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batch aggregates the queries run with a context returned by BeginBatch
+type batch struct {
+	once  sync.Once
+	start time.Time
+
+	mu sync.Mutex
+	// conn is a copy of the connection of the first query of the batch, without its transaction in progress,
+	// whose options are used to record the batch. The connection itself may be back in the pool once end is called.
+	conn    *wrappedConn
+	query   string
+	queries map[string]struct{}
+	count   int64
+	failed  int64
+	busy    time.Duration
+	err     error
+}
+
+// BeginBatch returns a copy of ctx for which queries are not instrumented one by one but aggregated,
+// such as the inserts of a loop loading thousands of rows. Calling end records the whole batch as a single sql-batch
+// operation, with the number of queries run, the number that failed and the time spent running them,
+// its duration is the time since BeginBatch was called.
+//
+// Hooks still run for every query, and queries are still recorded by WithQueryStats.
+func BeginBatch(ctx context.Context) (batchCtx context.Context, end func()) {
+	b := &batch{start: time.Now(), queries: map[string]struct{}{}}
+	return context.WithValue(ctx, batchKey, b), func() { b.once.Do(func() { b.end(ctx) }) }
+}
+
+// contextBatch returns the batch set on ctx by BeginBatch, ctx may be nil for the legacy driver methods
+func contextBatch(ctx context.Context) *batch {
+	if ctx == nil {
+		return nil
+	}
+
+	b, _ := ctx.Value(batchKey).(*batch)
+	return b
+}
+
+// record adds a query to the batch
+func (b *batch) record(c *opCall, duration time.Duration, failed bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		b.conn = &wrappedConn{
+			opts:      c.opts,
+			id:        c.conn.id,
+			idLabel:   c.conn.idLabel,
+			dsn:       c.conn.dsn,
+			dsnInfo:   c.conn.dsnInfo,
+			checkouts: atomic.LoadInt64(&c.conn.checkouts),
+		}
+		b.query = c.query
+	}
+	if len(b.queries) < maxBatchQueries {
+		b.queries[c.query] = struct{}{}
+	}
+	b.count++
+	b.busy += duration
+	if failed {
+		b.failed++
+		if b.err == nil {
+			b.err = err
+		}
+	}
+}
+
+// maxBatchQueries bounds the distinct queries counted for a batch
+const maxBatchQueries = 100
+
+// end records the batch, its span is a child of the span in ctx, the context BeginBatch was called with
+func (b *batch) end(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		// No query was run
+		return
+	}
+
+	call := b.conn.startOp(ctx, b.conn.GetSpan(ctx), OpSQLBatch, b.query, nil)
+	call.start = b.start
+	call.setLabel("count", strconv.FormatInt(b.count, 10))
+	call.setLabel("failed", strconv.FormatInt(b.failed, 10))
+	call.setLabel("statements", strconv.Itoa(len(b.queries)))
+	call.setLabel("busy", b.busy.String())
+	call.finish(b.err)
+}
@@ -0,0 +1,66 @@
+package instrumentedsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestBatch(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	tr := instrumentedsqltest.NewTracer()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithTracer(tr)), "")
+	ctx := tr.ContextWithSpan(context.Background(), "load")
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	logger.Reset()
+	tr.Reset()
+
+	batchCtx, end := BeginBatch(ctx)
+	for n := 0; n < 1000; n++ {
+		if _, err := db.ExecContext(batchCtx, "INSERT INTO t (a) VALUES (?)", n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.ExecContext(batchCtx, "UPDATE counts SET n = n + 1000"); err != nil {
+		t.Fatal(err)
+	}
+	logger.AssertNames(t)
+	end()
+	end()
+
+	logger.AssertNames(t, "sql-batch")
+	op := logger.AssertQuery(t, "INSERT INTO t (a) VALUES (?)")
+	if op.Labels["count"] != "1001" || op.Labels["failed"] != "0" || op.Labels["statements"] != "2" || op.Err != nil {
+		t.Errorf("batch recorded as %+v", op)
+	}
+	if spans := tr.Spans(); len(spans) != 1 || spans[0].Parent != "load" {
+		t.Errorf("recorded spans %+v, want the batch in load", spans)
+	}
+}
+
+func TestBatchEndedDuringTx(t *testing.T) {
+	tr := instrumentedsqltest.NewTracer()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithTracer(tr)), "")
+	db.SetMaxOpenConns(1)
+	ctx := tr.ContextWithSpan(context.Background(), "load")
+
+	batchCtx, end := BeginBatch(ctx)
+	if _, err := db.ExecContext(batchCtx, "INSERT INTO t (a) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	// The connection of the batch is back in the pool, running a transaction for other code
+	tx, err := db.BeginTx(tr.ContextWithSpan(context.Background(), "other"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	end()
+
+	spans := tr.Spans()
+	if batch := spans[len(spans)-1]; batch.Name != "(sql-batch) INSERT INTO t (a) VALUES (1)" || batch.Parent != "load" {
+		t.Errorf("recorded batch %+v, want it in load", batch)
+	}
+}
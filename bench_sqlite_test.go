@@ -0,0 +1,55 @@
+//go:build sqlite
+// +build sqlite
+
+package instrumentedsql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteBenchDB opens an in memory sqlite database with a table t of rows rows
+func sqliteBenchDB(rows int) benchDB {
+	return func(tb testing.TB, wrapped bool) *sql.DB {
+		var d driver.Driver = &sqlite3.SQLiteDriver{}
+		if wrapped {
+			d = WrapDriver(d, WithLogger(nullLogger{}))
+		}
+		db := openBenchDB(tb, d, ":memory:")
+
+		if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, a INTEGER, n INTEGER)"); err != nil {
+			tb.Fatal(err)
+		}
+		for n := 0; n < rows; n++ {
+			if _, err := db.Exec("INSERT INTO t (id, a, n) VALUES (?, 0, ?)", n+1, n); err != nil {
+				tb.Fatal(err)
+			}
+		}
+
+		return db
+	}
+}
+
+func BenchmarkSQLiteExec(b *testing.B) {
+	benchmarkDrivers(b, sqliteBenchDB(2), benchmarkExec)
+}
+
+func BenchmarkSQLiteQuery(b *testing.B) {
+	for _, rows := range []int{1, 100, 10000} {
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			benchmarkDrivers(b, sqliteBenchDB(rows), benchmarkQuery)
+		})
+	}
+}
+
+func BenchmarkSQLitePrepareExec(b *testing.B) {
+	benchmarkDrivers(b, sqliteBenchDB(2), benchmarkPrepareExec)
+}
+
+func BenchmarkSQLiteTx(b *testing.B) {
+	benchmarkDrivers(b, sqliteBenchDB(2), benchmarkTx)
+}
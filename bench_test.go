@@ -0,0 +1,170 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// maxAllocsOverhead is the budget of allocations added by the instrumentation of an Exec without args,
+// with a logger but no tracer, see TestAllocsOverhead
+const maxAllocsOverhead = 16
+
+var benchDrivers uint64
+
+// openBenchDB registers d under a new name and opens it with a single connection
+func openBenchDB(tb testing.TB, d driver.Driver, dsn string) *sql.DB {
+	name := fmt.Sprintf("instrumentedsql-bench-%d", atomic.AddUint64(&benchDrivers, 1))
+	sql.Register(name, d)
+
+	db, err := sql.Open(name, dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	tb.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// benchDB opens a database on the parent driver returned by open, either directly or wrapped
+type benchDB func(tb testing.TB, wrapped bool) *sql.DB
+
+// fakeBenchDB opens a database on the in memory driver, whose queries return rows rows
+func fakeBenchDB(rows int) benchDB {
+	return func(tb testing.TB, wrapped bool) *sql.DB {
+		var d driver.Driver = &fakeDriver{rows: rows}
+		if wrapped {
+			d = WrapDriver(d, WithLogger(nullLogger{}))
+		}
+		return openBenchDB(tb, d, "")
+	}
+}
+
+func benchmarkDrivers(b *testing.B, open benchDB, run func(b *testing.B, db *sql.DB)) {
+	for _, wrapped := range []bool{false, true} {
+		name := "raw"
+		if wrapped {
+			name = "wrapped"
+		}
+		b.Run(name, func(b *testing.B) {
+			db := open(b, wrapped)
+			b.ReportAllocs()
+			b.ResetTimer()
+			run(b, db)
+		})
+	}
+}
+
+func benchmarkExec(b *testing.B, db *sql.DB) {
+	ctx := context.Background()
+	for n := 0; n < b.N; n++ {
+		if _, err := db.ExecContext(ctx, "UPDATE t SET a = ? WHERE id = ?", 1, 2); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkExecNoArgs(b *testing.B, db *sql.DB) {
+	ctx := context.Background()
+	for n := 0; n < b.N; n++ {
+		if _, err := db.ExecContext(ctx, "UPDATE t SET a = 1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkQuery(b *testing.B, db *sql.DB) {
+	ctx := context.Background()
+	for n := 0; n < b.N; n++ {
+		rows, err := db.QueryContext(ctx, "SELECT n FROM t WHERE id > ?", 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var v int64
+		for rows.Next() {
+			if err := rows.Scan(&v); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := rows.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkPrepareExec(b *testing.B, db *sql.DB) {
+	ctx := context.Background()
+	for n := 0; n < b.N; n++ {
+		stmt, err := db.PrepareContext(ctx, "UPDATE t SET a = ? WHERE id = ?")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := stmt.ExecContext(ctx, 1, 2); err != nil {
+			b.Fatal(err)
+		}
+		stmt.Close()
+	}
+}
+
+func benchmarkTx(b *testing.B, db *sql.DB) {
+	ctx := context.Background()
+	for n := 0; n < b.N; n++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE t SET a = ? WHERE id = ?", 1, 2); err != nil {
+			b.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExec(b *testing.B) {
+	benchmarkDrivers(b, fakeBenchDB(0), benchmarkExec)
+}
+
+func BenchmarkExecNoArgs(b *testing.B) {
+	benchmarkDrivers(b, fakeBenchDB(0), benchmarkExecNoArgs)
+}
+
+func BenchmarkQuery(b *testing.B) {
+	for _, rows := range []int{1, 100, 10000} {
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			benchmarkDrivers(b, fakeBenchDB(rows), benchmarkQuery)
+		})
+	}
+}
+
+func BenchmarkPrepareExec(b *testing.B) {
+	benchmarkDrivers(b, fakeBenchDB(0), benchmarkPrepareExec)
+}
+
+func BenchmarkTx(b *testing.B) {
+	benchmarkDrivers(b, fakeBenchDB(0), benchmarkTx)
+}
+
+// TestAllocsOverhead keeps the cost of the instrumentation in check, allocations are counted as they are deterministic
+func TestAllocsOverhead(t *testing.T) {
+	ctx := context.Background()
+	exec := func(db *sql.DB) func() {
+		return func() {
+			if _, err := db.ExecContext(ctx, "UPDATE t SET a = 1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	raw := testing.AllocsPerRun(100, exec(fakeBenchDB(0)(t, false)))
+	wrapped := testing.AllocsPerRun(100, exec(fakeBenchDB(0)(t, true)))
+
+	if overhead := wrapped - raw; overhead > maxAllocsOverhead {
+		t.Errorf("instrumenting an Exec costs %v allocations, the budget is %d", overhead, maxAllocsOverhead)
+	}
+}
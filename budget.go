@@ -0,0 +1,98 @@
+package instrumentedsql
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBudgetExceeded is returned for the queries run over the budget of their context when it is enforced, see Budgeted
+var ErrBudgetExceeded = errors.New("instrumentedsql: query budget exceeded")
+
+// Budget bounds the queries run with a context, typically the ones run to serve a request, see Budgeted
+type Budget struct {
+	// MaxQueries is the number of queries that can be run, there is no limit if it is 0
+	MaxQueries int64
+	// MaxDuration is the time the queries can take overall, there is no limit if it is 0
+	MaxDuration time.Duration
+	// Enforce makes the queries run once the budget is exceeded fail with ErrBudgetExceeded,
+	// otherwise they run and are only labeled budget_exceeded
+	Enforce bool
+	// OnExceeded is called once, if not nil, by the first query exceeding the budget
+	OnExceeded func(ctx context.Context, usage BudgetUsage)
+}
+
+// BudgetUsage is how much of its budget a context used
+type BudgetUsage struct {
+	Queries  int64
+	Duration time.Duration
+}
+
+// budget tracks the usage of a Budget, its counters are accessed atomically
+type budget struct {
+	Budget
+	queries  int64
+	duration int64
+	exceeded int32
+}
+
+// Budgeted returns a copy of ctx whose queries are counted against budget, to catch requests running many more queries
+// than expected, such as the N+1 queries of ORMs, before they take the database down.
+// The queries run with the contexts derived from the returned one share its budget.
+// Budgets are tracked by the drivers returned by WrapDriver, which returns the parent driver as is when nothing
+// is recorded, so WithBudgets is needed if the driver is wrapped only for them.
+func Budgeted(ctx context.Context, b Budget) context.Context {
+	return context.WithValue(ctx, budgetKey, &budget{Budget: b})
+}
+
+// BudgetUsed returns how much of the budget set on ctx by Budgeted was used so far, and false if ctx has no budget
+func BudgetUsed(ctx context.Context) (BudgetUsage, bool) {
+	b := contextBudget(ctx)
+	if b == nil {
+		return BudgetUsage{}, false
+	}
+
+	return b.usage(), true
+}
+
+// contextBudget returns the budget set on ctx by Budgeted, ctx may be nil for the legacy driver methods
+func contextBudget(ctx context.Context) *budget {
+	if ctx == nil {
+		return nil
+	}
+
+	b, _ := ctx.Value(budgetKey).(*budget)
+	return b
+}
+
+func (b *budget) usage() BudgetUsage {
+	return BudgetUsage{Queries: atomic.LoadInt64(&b.queries), Duration: time.Duration(atomic.LoadInt64(&b.duration))}
+}
+
+// spend counts a query starting against the budget of its context, if any, and returns ErrBudgetExceeded
+// if it is over budget and the budget is enforced
+func (c *opCall) spend() error {
+	b := contextBudget(c.ctx)
+	if b == nil || !isStatementOp(c.op) {
+		return nil
+	}
+	c.budget = b
+
+	queries := atomic.AddInt64(&b.queries, 1)
+	overQueries := b.MaxQueries > 0 && queries > b.MaxQueries
+	overDuration := b.MaxDuration > 0 && time.Duration(atomic.LoadInt64(&b.duration)) >= b.MaxDuration
+	if !overQueries && !overDuration {
+		return nil
+	}
+
+	c.setLabel("budget_exceeded", "true")
+	if b.OnExceeded != nil && atomic.CompareAndSwapInt32(&b.exceeded, 0, 1) {
+		b.OnExceeded(c.ctx, b.usage())
+	}
+	if b.Enforce {
+		return ErrBudgetExceeded
+	}
+
+	return nil
+}
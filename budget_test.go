@@ -0,0 +1,66 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestBudget(t *testing.T) {
+	for _, enforce := range []bool{false, true} {
+		logger := instrumentedsqltest.NewLogger()
+		db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger)), "")
+
+		var exceeded []BudgetUsage
+		ctx := Budgeted(context.Background(), Budget{MaxQueries: 2, Enforce: enforce, OnExceeded: func(ctx context.Context, usage BudgetUsage) {
+			exceeded = append(exceeded, usage)
+		}})
+		var errs []error
+		for n := 0; n < 4; n++ {
+			_, err := db.ExecContext(ctx, "UPDATE t SET a = 1")
+			errs = append(errs, err)
+		}
+
+		if len(exceeded) != 1 || exceeded[0].Queries != 3 {
+			t.Errorf("OnExceeded called with %+v, want once by the third query", exceeded)
+		}
+		for n, err := range errs {
+			if want := enforce && n >= 2; errors.Is(err, ErrBudgetExceeded) != want {
+				t.Errorf("query %d failed with %v, enforced %t", n, err, enforce)
+			}
+		}
+		if usage, ok := BudgetUsed(ctx); !ok || usage.Queries != 4 {
+			t.Errorf("BudgetUsed() = %+v, %t", usage, ok)
+		}
+		ops := logger.Find(string(OpSQLConnExec))
+		if len(ops) != 4 || ops[1].Labels["budget_exceeded"] != nil || ops[3].Labels["budget_exceeded"] != "true" {
+			t.Errorf("queries logged as %+v", ops)
+		}
+	}
+}
+
+func TestBudgetWithoutOptions(t *testing.T) {
+	d := &fakeDriver{}
+	for _, test := range []struct {
+		wrapped driver.Driver
+		want    int64
+	}{
+		// The parent driver is returned as is
+		{WrapDriver(d), 0},
+		{WrapDriver(d, WithBudgets()), 2},
+	} {
+		db := openBenchDB(t, test.wrapped, "")
+		ctx := Budgeted(context.Background(), Budget{MaxQueries: 1, Enforce: true})
+		var err error
+		for n := 0; n < 2; n++ {
+			_, err = db.ExecContext(ctx, "UPDATE t SET a = 1")
+		}
+
+		if usage, _ := BudgetUsed(ctx); usage.Queries != test.want || errors.Is(err, ErrBudgetExceeded) != (test.want > 0) {
+			t.Errorf("%T: used %+v and returned %v, want %d queries counted", test.wrapped, usage, err, test.want)
+		}
+	}
+}
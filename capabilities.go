@@ -0,0 +1,47 @@
+package instrumentedsql
+
+import "database/sql/driver"
+
+// connCapabilities are the optional interfaces implemented by a parent connection, detected once when it is opened
+type connCapabilities struct {
+	beginTx        driver.ConnBeginTx
+	prepareContext driver.ConnPrepareContext
+	execer         driver.Execer
+	execerContext  driver.ExecerContext
+	queryer        driver.Queryer
+	queryerContext driver.QueryerContext
+	pinger         driver.Pinger
+	resetter       driver.SessionResetter
+	checker        driver.NamedValueChecker
+}
+
+func detectConnCapabilities(conn driver.Conn) connCapabilities {
+	var caps connCapabilities
+	caps.beginTx, _ = conn.(driver.ConnBeginTx)
+	caps.prepareContext, _ = conn.(driver.ConnPrepareContext)
+	caps.execer, _ = conn.(driver.Execer)
+	caps.execerContext, _ = conn.(driver.ExecerContext)
+	caps.queryer, _ = conn.(driver.Queryer)
+	caps.queryerContext, _ = conn.(driver.QueryerContext)
+	caps.pinger, _ = conn.(driver.Pinger)
+	caps.resetter, _ = conn.(driver.SessionResetter)
+	caps.checker, _ = conn.(driver.NamedValueChecker)
+
+	return caps
+}
+
+// stmtCapabilities are the optional interfaces implemented by a parent statement, detected once when it is prepared
+type stmtCapabilities struct {
+	execContext  driver.StmtExecContext
+	queryContext driver.StmtQueryContext
+	checker      driver.NamedValueChecker
+}
+
+func detectStmtCapabilities(stmt driver.Stmt) stmtCapabilities {
+	var caps stmtCapabilities
+	caps.execContext, _ = stmt.(driver.StmtExecContext)
+	caps.queryContext, _ = stmt.(driver.StmtQueryContext)
+	caps.checker, _ = stmt.(driver.NamedValueChecker)
+
+	return caps
+}
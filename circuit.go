@@ -0,0 +1,158 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for queries rejected because the circuit breaker is open, see WithCircuitBreaker
+var ErrCircuitOpen = errors.New("instrumentedsql: circuit breaker open")
+
+// CircuitBreakerConfig configures when the circuit breaker opens, see WithCircuitBreaker
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures opens the circuit after that many queries failed in a row, 0 disables it
+	ConsecutiveFailures int
+	// FailureRate opens the circuit when that fraction of the queries failed within Window, 0 disables it
+	FailureRate float64
+	// MinRequests is the number of queries required within Window for FailureRate to apply
+	MinRequests int
+	// Window is the period over which FailureRate is computed
+	Window time.Duration
+	// OpenDuration is how long the circuit stays open before a single query is let through to probe the database
+	OpenDuration time.Duration
+	// Failure reports whether err counts as a failure, by default connection errors and timeouts do
+	// as classified by DefaultErrorClassifier, errors caused by the queries themselves don't
+	Failure func(err error) bool
+}
+
+// The states of the circuit breaker
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// circuitBreaker is a hook rejecting queries while the database is failing
+type circuitBreaker struct {
+	CircuitBreakerConfig
+	logger Logger
+
+	mu          sync.Mutex
+	state       string
+	openedAt    time.Time
+	probing     bool
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+}
+
+func newCircuitBreaker(config CircuitBreakerConfig, logger Logger) *circuitBreaker {
+	if config.Failure == nil {
+		config.Failure = failureByDefault
+	}
+
+	return &circuitBreaker{CircuitBreakerConfig: config, logger: logger, state: circuitClosed}
+}
+
+// failureByDefault reports whether err is a connection error or a timeout
+func failureByDefault(err error) bool {
+	switch DefaultErrorClassifier(err) {
+	case ErrorCategoryConnection, ErrorCategoryTimeout:
+		return true
+	}
+
+	return false
+}
+
+func (b *circuitBreaker) Before(ctx context.Context, op Op, query string, args []driver.NamedValue) (context.Context, error) {
+	if !isStatementOp(op) {
+		return ctx, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.OpenDuration {
+			return nil, ErrCircuitOpen
+		}
+		b.setState(ctx, circuitHalfOpen)
+		b.probing = true
+	case circuitHalfOpen:
+		if b.probing {
+			return nil, ErrCircuitOpen
+		}
+		b.probing = true
+	}
+
+	return ctx, nil
+}
+
+func (b *circuitBreaker) After(ctx context.Context, op Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration) {
+	if !isStatementOp(op) {
+		return
+	}
+
+	failed := err != nil && err != driver.ErrSkip && b.Failure(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.probing = false
+		if err == driver.ErrSkip {
+			// The query is run again as a prepared statement, which probes instead
+			return
+		}
+		if failed {
+			b.open(ctx)
+		} else {
+			b.setState(ctx, circuitClosed)
+		}
+		return
+	}
+
+	if err == driver.ErrSkip {
+		return
+	}
+	if now := time.Now(); now.Sub(b.windowStart) > b.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	b.failures++
+	b.consecutive++
+
+	if b.state == circuitClosed && b.tripped() {
+		b.open(ctx)
+	}
+}
+
+// tripped reports whether the failures seen so far should open the circuit
+func (b *circuitBreaker) tripped() bool {
+	if b.ConsecutiveFailures > 0 && b.consecutive >= b.ConsecutiveFailures {
+		return true
+	}
+
+	return b.FailureRate > 0 && b.requests >= b.MinRequests && float64(b.failures) >= b.FailureRate*float64(b.requests)
+}
+
+func (b *circuitBreaker) open(ctx context.Context) {
+	b.openedAt = time.Now()
+	b.consecutive, b.requests, b.failures = 0, 0, 0
+	b.setState(ctx, circuitOpen)
+}
+
+// setState changes the state of the circuit and logs the change as sql-circuit-breaker
+func (b *circuitBreaker) setState(ctx context.Context, state string) {
+	b.logger.Log(ctx, "sql-circuit-breaker", "from", b.state, "to", state)
+	b.state = state
+}
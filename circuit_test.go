@@ -0,0 +1,67 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	b := newCircuitBreaker(CircuitBreakerConfig{ConsecutiveFailures: 2, OpenDuration: time.Hour}, nullLogger{})
+
+	run := func(err error) error {
+		if _, beforeErr := b.Before(ctx, OpSQLConnExec, "SELECT 1", nil); beforeErr != nil {
+			return beforeErr
+		}
+		b.After(ctx, OpSQLConnExec, "SELECT 1", nil, nil, err, 0)
+		return err
+	}
+
+	run(driver.ErrBadConn)
+	run(nil)
+	run(driver.ErrBadConn)
+	if b.state != circuitClosed {
+		t.Fatalf("state = %s after non consecutive failures, want closed", b.state)
+	}
+
+	run(driver.ErrBadConn)
+	if b.state != circuitOpen {
+		t.Fatalf("state = %s after consecutive failures, want open", b.state)
+	}
+	if err := run(nil); err != ErrCircuitOpen {
+		t.Fatalf("err = %v while open, want ErrCircuitOpen", err)
+	}
+
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	if _, err := b.Before(ctx, OpSQLConnExec, "SELECT 1", nil); err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if _, err := b.Before(ctx, OpSQLConnExec, "SELECT 1", nil); err != ErrCircuitOpen {
+		t.Fatalf("err = %v while probing, want ErrCircuitOpen", err)
+	}
+	b.After(ctx, OpSQLConnExec, "SELECT 1", nil, nil, nil, 0)
+	if b.state != circuitClosed {
+		t.Fatalf("state = %s after successful probe, want closed", b.state)
+	}
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	ctx := context.Background()
+	b := newCircuitBreaker(CircuitBreakerConfig{FailureRate: 0.5, MinRequests: 4, Window: time.Hour, OpenDuration: time.Hour}, nullLogger{})
+
+	for _, err := range []error{nil, context.DeadlineExceeded, nil} {
+		b.Before(ctx, OpSQLStmtQuery, "SELECT 1", nil)
+		b.After(ctx, OpSQLStmtQuery, "SELECT 1", nil, nil, err, 0)
+	}
+	if b.state != circuitClosed {
+		t.Fatalf("state = %s below MinRequests, want closed", b.state)
+	}
+
+	b.Before(ctx, OpSQLStmtQuery, "SELECT 1", nil)
+	b.After(ctx, OpSQLStmtQuery, "SELECT 1", nil, nil, context.DeadlineExceeded, 0)
+	if b.state != circuitOpen {
+		t.Fatalf("state = %s at a failure rate of 0.5, want open", b.state)
+	}
+}
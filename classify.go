@@ -0,0 +1,80 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+)
+
+// ErrorCategory is a coarse classification of the errors returned by the parent driver
+type ErrorCategory string
+
+// The error categories returned by DefaultErrorClassifier
+const (
+	ErrorCategoryUnknown       ErrorCategory = "unknown"
+	ErrorCategoryTimeout       ErrorCategory = "timeout"
+	ErrorCategoryCanceled      ErrorCategory = "canceled"
+	ErrorCategoryConstraint    ErrorCategory = "constraint_violation"
+	ErrorCategorySerialization ErrorCategory = "serialization_failure"
+	ErrorCategoryConnection    ErrorCategory = "connection"
+	ErrorCategorySyntax        ErrorCategory = "syntax"
+)
+
+// ErrorClassifier buckets an error into a category, it is called for every failed operation, see WithErrorClassifier
+type ErrorClassifier func(err error) ErrorCategory
+
+// sqlStater is implemented by the errors of drivers that expose the SQLSTATE of server side errors, such as pgx and lib/pq
+type sqlStater interface {
+	SQLState() string
+}
+
+// DefaultErrorClassifier classifies context errors, driver.ErrBadConn, network errors and,
+// for drivers whose errors have a SQLState() string method or are recognized such as MySQL's,
+// server side errors by their SQLSTATE class.
+func DefaultErrorClassifier(err error) ErrorCategory {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorCategoryTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCategoryCanceled
+	case errors.Is(err, driver.ErrBadConn):
+		return ErrorCategoryConnection
+	}
+
+	if info, ok := parseServerError(err); ok {
+		if category := classifySQLState(info.sqlState); category != ErrorCategoryUnknown {
+			return category
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorCategoryTimeout
+		}
+
+		return ErrorCategoryConnection
+	}
+
+	return ErrorCategoryUnknown
+}
+
+// classifySQLState classifies a SQLSTATE code as defined by the SQL standard and extended by Postgres and MySQL
+func classifySQLState(state string) ErrorCategory {
+	switch {
+	case state == "40001" || state == "40P01":
+		return ErrorCategorySerialization
+	case state == "57014" || state == "HYT00" || state == "HYT01":
+		return ErrorCategoryTimeout
+	case strings.HasPrefix(state, "23"):
+		return ErrorCategoryConstraint
+	case strings.HasPrefix(state, "08"):
+		return ErrorCategoryConnection
+	case strings.HasPrefix(state, "42"):
+		return ErrorCategorySyntax
+	}
+
+	return ErrorCategoryUnknown
+}
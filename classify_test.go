@@ -0,0 +1,141 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+type sqlStateErr string
+
+func (e sqlStateErr) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateErr) SQLState() string { return string(e) }
+
+func TestDefaultErrorClassifier(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorCategory
+	}{
+		{context.DeadlineExceeded, ErrorCategoryTimeout},
+		{fmt.Errorf("query: %w", context.Canceled), ErrorCategoryCanceled},
+		{driver.ErrBadConn, ErrorCategoryConnection},
+		{sqlStateErr("23505"), ErrorCategoryConstraint},
+		{fmt.Errorf("tx: %w", sqlStateErr("40001")), ErrorCategorySerialization},
+		{sqlStateErr("42601"), ErrorCategorySyntax},
+		{sqlStateErr("57014"), ErrorCategoryTimeout},
+		{sqlStateErr("XX000"), ErrorCategoryUnknown},
+		{fmt.Errorf("boom"), ErrorCategoryUnknown},
+	}
+
+	for _, test := range tests {
+		if got := DefaultErrorClassifier(test.err); got != test.want {
+			t.Errorf("DefaultErrorClassifier(%v) = %s, want %s", test.err, got, test.want)
+		}
+	}
+}
+
+// mySQLError mimics the errors of go-sql-driver/mysql
+type mySQLError struct {
+	Number   uint16
+	SQLState [5]byte
+	Message  string
+}
+
+func (e *mySQLError) Error() string { return e.Message }
+
+// pqError mimics the errors of lib/pq
+type pqError struct {
+	Code       string
+	Constraint string
+}
+
+func (e *pqError) Error() string { return "pq: " + e.Code }
+
+func TestParseServerError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want serverError
+		ok   bool
+	}{
+		{&mySQLError{Number: 1062, SQLState: [5]byte{'2', '3', '0', '0', '0'}}, serverError{sqlState: "23000", code: "1062"}, true},
+		{fmt.Errorf("insert: %w", &pqError{Code: "23505", Constraint: "users_email_key"}), serverError{sqlState: "23505", constraint: "users_email_key"}, true},
+		{sqlStateErr("40P01"), serverError{sqlState: "40P01"}, true},
+		{fmt.Errorf("boom"), serverError{}, false},
+	}
+
+	for _, test := range tests {
+		if got, ok := parseServerError(test.err); got != test.want || ok != test.ok {
+			t.Errorf("parseServerError(%v) = %+v, %v, want %+v, %v", test.err, got, ok, test.want, test.ok)
+		}
+	}
+	if got := DefaultErrorClassifier(&mySQLError{Number: 1213, SQLState: [5]byte{'4', '0', '0', '0', '1'}}); got != ErrorCategorySerialization {
+		t.Errorf("DefaultErrorClassifier(MySQL deadlock) = %s, want %s", got, ErrorCategorySerialization)
+	}
+}
+
+func TestLockFailure(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	deadlock := &mySQLError{Number: 1213, SQLState: [5]byte{'4', '0', '0', '0', '1'}, Message: "Deadlock found"}
+	db := openBenchDB(t, WrapDriver(&fakeDriver{execErr: deadlock}, WithLogger(logger)), "")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("UPDATE accounts SET balance = 0 WHERE id = 1"); err != deadlock {
+		t.Fatalf("Exec() = %v, want the deadlock", err)
+	}
+	tx.Rollback()
+
+	events := logger.Find("sql-deadlock")
+	if len(events) != 1 || events[0].Query != "UPDATE accounts SET balance = 0 WHERE id = 1" || events[0].Labels["tx_duration"] == nil {
+		t.Errorf("recorded deadlock events %+v", events)
+	}
+	if op := logger.Find(string(OpSQLConnExec))[0]; op.Labels["lock_failure"] != "deadlock" || op.Labels["error_code"] != "1213" {
+		t.Errorf("failed exec recorded with labels %v", op.Labels)
+	}
+}
+
+func TestErrorFilter(t *testing.T) {
+	notFound := errors.New("not found")
+	cases := []struct {
+		name       string
+		err        error
+		wantFailed bool
+	}{
+		{name: "filtered", err: notFound},
+		{name: "wrapping a filtered error", err: fmt.Errorf("lookup: %w", notFound)},
+		{name: "not filtered", err: errors.New("connection reset"), wantFailed: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			tr := instrumentedsqltest.NewTracer()
+			d := WrapDriver(&fakeDriver{execErr: tc.err}, WithLogger(logger), WithTracer(tr), WithQueryStats(), WithErrorFilter(IgnoreErrors(notFound)))
+			db := openBenchDB(t, d, "")
+
+			if _, err := db.Exec("UPDATE t SET a = 1"); err != tc.err {
+				t.Fatalf("Exec() = %v, want %v", err, tc.err)
+			}
+
+			// The error is still logged and the query still counted, only its failure is filtered
+			if op := logger.AssertQuery(t, "UPDATE t SET a = 1"); op.Err != tc.err {
+				t.Errorf("logged error %v, want %v", op.Err, tc.err)
+			}
+			stats := d.(interface{ Stats() []QueryStats }).Stats()
+			if len(stats) != 1 || stats[0].Count != 1 || (stats[0].Errors == 1) != tc.wantFailed {
+				t.Errorf("recorded stats %+v, want the query failed %t", stats, tc.wantFailed)
+			}
+			for _, span := range tr.Spans() {
+				if span.Labels["query"] != "" && (span.Labels["error"] == "true") != tc.wantFailed {
+					t.Errorf("recorded span %+v, want it failed %t", span, tc.wantFailed)
+				}
+			}
+		})
+	}
+}
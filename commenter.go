@@ -0,0 +1,69 @@
+package instrumentedsql
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/away-team/go-tracer/tracer"
+)
+
+// TraceParenter can be implemented by spans that are able to render their W3C trace context
+// (https://www.w3.org/TR/trace-context/#traceparent-header), it is used to fill in the traceparent of sqlcommenter comments
+type TraceParenter interface {
+	TraceParent() string
+}
+
+// commentQuery appends a sqlcommenter comment to query if commenting is enabled.
+// Queries that already contain a comment are left untouched, as required by the specification.
+func (o *opts) commentQuery(span tracer.Span, query string) string {
+	if !o.commentQueries || strings.Contains(query, "/*") {
+		return query
+	}
+
+	tags := map[string]string{}
+	if o.commentApplication != "" {
+		tags["application"] = o.commentApplication
+	}
+	if tp, ok := span.(TraceParenter); ok {
+		if traceParent := tp.TraceParent(); traceParent != "" {
+			tags["traceparent"] = traceParent
+		}
+	}
+
+	comment := sqlComment(tags)
+	if comment == "" {
+		return query
+	}
+
+	trimmed := strings.TrimRight(query, " \t\r\n")
+	if strings.HasSuffix(trimmed, ";") {
+		return strings.TrimSuffix(trimmed, ";") + " " + comment + ";"
+	}
+
+	return trimmed + " " + comment
+}
+
+// sqlComment serializes tags as a sqlcommenter comment, keys sorted and keys and values url encoded
+func sqlComment(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, sqlCommentEscape(k)+"='"+sqlCommentEscape(tags[k])+"'")
+	}
+
+	return "/*" + strings.Join(pairs, ",") + "*/"
+}
+
+func sqlCommentEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
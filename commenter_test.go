@@ -0,0 +1,69 @@
+package instrumentedsql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/away-team/go-tracer/tracer"
+)
+
+type traceParentSpan struct {
+	tracer.Span
+	traceParent string
+}
+
+func (s traceParentSpan) TraceParent() string { return s.traceParent }
+
+func TestCommentQuery(t *testing.T) {
+	o := &opts{commentQueries: true, commentApplication: "my app"}
+	span := traceParentSpan{traceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+
+	tests := []struct {
+		query, want string
+	}{
+		{"SELECT 1", "SELECT 1 /*application='my%20app',traceparent='00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01'*/"},
+		{"SELECT 1;\n", "SELECT 1 /*application='my%20app',traceparent='00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01'*/;"},
+		{"SELECT /* hint */ 1", "SELECT /* hint */ 1"},
+	}
+
+	for _, test := range tests {
+		if got := o.commentQuery(span, test.query); got != test.want {
+			t.Errorf("commentQuery(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestSQLCommenter(t *testing.T) {
+	parent := &fakeDriver{rows: 1}
+	db := openBenchDB(t, WrapDriver(parent, WithSQLCommenter("app")), "")
+
+	if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query("SELECT a FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	stmt, err := db.Prepare("SELECT b FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SELECT /*+ INDEX(t) */ a FROM t"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"UPDATE t SET a = 1 /*application='app'*/",
+		"SELECT a FROM t /*application='app'*/",
+		"SELECT b FROM t",
+		"SELECT /*+ INDEX(t) */ a FROM t",
+	}
+	if sent := parent.sentQueries(); !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+}
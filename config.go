@@ -0,0 +1,112 @@
+package instrumentedsql
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config lets some options of a wrapped driver be changed at runtime, for example to trace more while investigating
+// an incident, see WithConfig. Settings that were never set on it keep the value of the options passed to WrapDriver.
+// It is safe for concurrent use.
+type Config struct {
+	// mu serializes the updates, values holds the current *configValues
+	mu     sync.Mutex
+	values atomic.Value
+}
+
+// configValues are the settings of a Config, they are replaced as a whole on every update
+type configValues struct {
+	sampler    Sampler
+	samplerSet bool
+
+	slowQueryThreshold    time.Duration
+	slowQueryThresholdSet bool
+
+	opsIncluded map[Op]struct{}
+	opsExcluded map[Op]struct{}
+	opsSet      bool
+}
+
+// NewConfig returns a Config with nothing set
+func NewConfig() *Config {
+	c := &Config{}
+	c.values.Store(&configValues{})
+
+	return c
+}
+
+func (c *Config) load() *configValues {
+	return c.values.Load().(*configValues)
+}
+
+// update applies set to a copy of the current settings and makes it current
+func (c *Config) update(set func(v *configValues)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v := *c.load()
+	set(&v)
+	c.values.Store(&v)
+}
+
+// SetSampleRate samples operations with the given probability from now on, see ProbabilitySampler
+func (c *Config) SetSampleRate(fraction float64) {
+	c.SetSampler(ProbabilitySampler(fraction))
+}
+
+// SetSampler replaces the sampler, nil instruments every operation
+func (c *Config) SetSampler(sampler Sampler) {
+	c.update(func(v *configValues) {
+		v.sampler, v.samplerSet = sampler, true
+	})
+}
+
+// SetSlowQueryThreshold replaces the threshold passed to WithSlowQueryThreshold
+func (c *Config) SetSlowQueryThreshold(threshold time.Duration) {
+	c.update(func(v *configValues) {
+		v.slowQueryThreshold, v.slowQueryThresholdSet = threshold, true
+	})
+}
+
+// SetOps replaces the operations instrumented, as set by WithOpsIncluded and WithOpsExcluded.
+// When included is empty all operations but the excluded ones are instrumented.
+func (c *Config) SetOps(included, excluded []Op) {
+	c.update(func(v *configValues) {
+		v.opsIncluded, v.opsExcluded, v.opsSet = opSet(included), opSet(excluded), true
+		if len(included) == 0 {
+			v.opsIncluded = nil
+		}
+	})
+}
+
+func opSet(ops []Op) map[Op]struct{} {
+	set := make(map[Op]struct{}, len(ops))
+	for _, op := range ops {
+		set[op] = struct{}{}
+	}
+
+	return set
+}
+
+// currentSampler returns the sampler to use, from the config if it was set there
+func (o *opts) currentSampler() Sampler {
+	if o.config != nil {
+		if v := o.config.load(); v.samplerSet {
+			return v.sampler
+		}
+	}
+
+	return o.sampler
+}
+
+// currentSlowQueryThreshold returns the slow query threshold to use, from the config if it was set there
+func (o *opts) currentSlowQueryThreshold() time.Duration {
+	if o.config != nil {
+		if v := o.config.load(); v.slowQueryThresholdSet {
+			return v.slowQueryThreshold
+		}
+	}
+
+	return o.slowQueryThreshold
+}
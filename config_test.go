@@ -0,0 +1,39 @@
+package instrumentedsql
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	config := NewConfig()
+	o := &opts{config: config, slowQueryThreshold: time.Second}
+	WithOpsExcluded(OpSQLPing)(o)
+
+	if o.opEnabled(OpSQLPing) || !o.opEnabled(OpSQLConnExec) {
+		t.Error("operations instrumented differ from the options before the config is set")
+	}
+	if got := o.currentSlowQueryThreshold(); got != time.Second {
+		t.Errorf("slow query threshold = %v before the config is set, want 1s", got)
+	}
+
+	config.SetOps([]Op{OpSQLConnExec}, nil)
+	config.SetSlowQueryThreshold(time.Millisecond)
+	config.SetSampleRate(0)
+
+	if !o.opEnabled(OpSQLConnExec) || o.opEnabled(OpSQLConnQuery) || o.opEnabled(OpSQLPing) {
+		t.Error("operations instrumented differ from the config")
+	}
+	if got := o.currentSlowQueryThreshold(); got != time.Millisecond {
+		t.Errorf("slow query threshold = %v, want 1ms", got)
+	}
+	if sampler := o.currentSampler(); sampler == nil || sampler(context.Background(), OpSQLConnExec, "") {
+		t.Error("sampler of the config not used")
+	}
+
+	config.SetOps(nil, nil)
+	if !o.opEnabled(OpSQLPing) {
+		t.Error("operation not instrumented with no operations set in the config")
+	}
+}
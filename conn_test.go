@@ -0,0 +1,37 @@
+package instrumentedsql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestConnCloseSummary(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{rows: 2, nextErr: errors.New("protocol error")}, WithLogger(logger)), "")
+
+	if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := countRows(db.Query("SELECT a FROM t")); err == nil {
+		t.Fatal("the query did not fail")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	closes := logger.Find(string(OpSQLConnClose))
+	if len(closes) != 1 {
+		t.Fatalf("recorded %d connection closes, want 1", len(closes))
+	}
+	labels := closes[0].Labels
+	if labels["conn_queries"] != "2" || labels["conn_errors"] != "1" || labels["conn_txs"] != "1" || labels["conn_lifetime"] == nil {
+		t.Errorf("connection close recorded with labels %v", labels)
+	}
+}
@@ -0,0 +1,97 @@
+package instrumentedsql
+
+import "context"
+
+// contextKey is the type of the keys this package stores in contexts
+type contextKey int
+
+const (
+	instrumentationModeKey contextKey = iota
+	allowDDLKey
+	connIDKey
+	nameKey
+	labelsKey
+	batchKey
+	budgetKey
+	requestScopeKey
+	cacheTTLKey
+)
+
+// instrumentationMode overrides the instrumentation of the operations run with a context, see Skip and Force
+type instrumentationMode int
+
+const (
+	modeDefault instrumentationMode = iota
+	modeSkip
+	modeForce
+)
+
+// Skip returns a copy of ctx for which operations are not instrumented at all.
+// This is meant for hot loops such as migrations or bulk loads which would flood logs and traces.
+func Skip(ctx context.Context) context.Context {
+	return context.WithValue(ctx, instrumentationModeKey, modeSkip)
+}
+
+// Force returns a copy of ctx for which operations are always instrumented, regardless of the sampler and of excluded operations
+func Force(ctx context.Context) context.Context {
+	return context.WithValue(ctx, instrumentationModeKey, modeForce)
+}
+
+// contextMode returns the instrumentation mode set on ctx, which may be nil for the legacy driver methods
+func contextMode(ctx context.Context) instrumentationMode {
+	if ctx == nil {
+		return modeDefault
+	}
+
+	mode, _ := ctx.Value(instrumentationModeKey).(instrumentationMode)
+	return mode
+}
+
+// ConnID returns the ID of the connection an operation runs on, as recorded in the conn_id label.
+// It is only set when hooks are configured, on the contexts passed to Hooks and then to the parent driver,
+// so that operations are not slowed down by it otherwise. ok is false for contexts without it.
+func ConnID(ctx context.Context) (uint64, bool) {
+	id, ok := ctx.Value(connIDKey).(uint64)
+	return id, ok
+}
+
+// Named returns a copy of ctx for which the spans of the queries run with it are named name, rather than after their
+// operation and query, so that they get a name meaningful to the application such as load-user-batch.
+// The name is also recorded in the name label of the queries.
+func Named(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, nameKey, name)
+}
+
+// Labeled returns a copy of ctx for which the operations run with it get labels,
+// on top of those set by the parents of ctx and by WithContextAttributes
+func Labeled(ctx context.Context, labels map[string]string) context.Context {
+	merged := make(map[string]string, len(labels))
+	for k, v := range contextLabels(ctx) {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, labelsKey, merged)
+}
+
+// contextName returns the name set on ctx by Named, ctx may be nil for the legacy driver methods
+func contextName(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	name, _ := ctx.Value(nameKey).(string)
+	return name
+}
+
+// contextLabels returns the labels set on ctx by Labeled, ctx may be nil for the legacy driver methods
+func contextLabels(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+
+	labels, _ := ctx.Value(labelsKey).(map[string]string)
+	return labels
+}
@@ -0,0 +1,89 @@
+package instrumentedsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestNamedAndLabeled(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	tr := instrumentedsqltest.NewTracer()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithTracer(tr)), "")
+
+	ctx := Labeled(context.Background(), map[string]string{"tenant": "acme", "feature": "users"})
+	ctx = Labeled(ctx, map[string]string{"feature": "batch"})
+	tx, err := db.BeginTx(Named(ctx, "load-user-batch"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(Named(ctx, "load-user-batch"), "UPDATE users SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	op := logger.AssertQuery(t, "UPDATE users SET a = 1")
+	if op.Labels["name"] != "load-user-batch" || op.Labels["tenant"] != "acme" || op.Labels["feature"] != "batch" {
+		t.Errorf("query recorded with labels %v", op.Labels)
+	}
+	for _, commit := range logger.Find(string(OpSQLTxCommit)) {
+		if _, ok := commit.Labels["name"]; ok || commit.Labels["tenant"] != "acme" {
+			t.Errorf("commit recorded with labels %v", commit.Labels)
+		}
+	}
+
+	// Only the query is renamed, the transaction keeps its usual spans
+	var names []string
+	for _, span := range tr.Spans() {
+		names = append(names, span.Name)
+	}
+	want := []string{"sql-conn-open", "sql-tx", "sql-tx-begin", "load-user-batch", "sql-tx-commit"}
+	if len(names) != len(want) {
+		t.Fatalf("recorded spans %v, want %v", names, want)
+	}
+	for n := range want {
+		if names[n] != want[n] {
+			t.Errorf("recorded spans %v, want %v", names, want)
+			break
+		}
+	}
+}
+
+func TestSkipAndForce(t *testing.T) {
+	dropAll := func(ctx context.Context, op Op, query string) bool { return false }
+	cases := []struct {
+		name    string
+		ctx     context.Context
+		options []Opt
+		want    bool
+	}{
+		{name: "sampled out", ctx: context.Background(), options: []Opt{WithSampler(dropAll)}},
+		{name: "forced past the sampler", ctx: Force(context.Background()), options: []Opt{WithSampler(dropAll)}, want: true},
+		{name: "forced past excluded operations", ctx: Force(context.Background()), options: []Opt{WithOpsExcluded(OpSQLConnExec)}, want: true},
+		{name: "skipped", ctx: Skip(context.Background())},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			tr := instrumentedsqltest.NewTracer()
+			db := openBenchDB(t, WrapDriver(&fakeDriver{}, append(tc.options, WithLogger(logger), WithTracer(tr))...), "")
+
+			if _, err := db.ExecContext(tc.ctx, "UPDATE t SET a = 1"); err != nil {
+				t.Fatal(err)
+			}
+
+			logged := len(logger.Find(string(OpSQLConnExec))) == 1
+			traced := false
+			for _, span := range tr.Spans() {
+				traced = traced || span.Labels["query"] == "UPDATE t SET a = 1"
+			}
+			if logged != tc.want || traced != tc.want {
+				t.Errorf("logged %t and traced %t, want %t", logged, traced, tc.want)
+			}
+		})
+	}
+}
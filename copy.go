@@ -0,0 +1,121 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+)
+
+// errCopyNotFlushed is the error of the copies whose statement was closed before the rows sent were flushed
+var errCopyNotFlushed = errors.New("instrumentedsql: copy closed without flushing its rows")
+
+// copyState tracks a COPY ... FROM STDIN statement, whose rows are sent with one Exec each,
+// the way lib/pq's CopyIn works, until an Exec without args flushes them
+type copyState struct {
+	// call is the sql-copy operation in progress, started by the first row
+	call  *opCall
+	rows  int64
+	bytes int64
+}
+
+// isCopyFromStdin reports whether query copies rows sent by the client, such as the queries built by pq.CopyIn
+func isCopyFromStdin(query string) bool {
+	return parseStatement(query).verb == "COPY" && hasTopLevelKeyword(query, "STDIN")
+}
+
+// copyExec sends a row of a COPY statement to the parent, or flushes the rows sent so far when there are no args.
+// The copy is instrumented as a single sql-copy operation, from the first row until the flush, rather than one per row.
+// The operation is checked by the guards and hooks when it starts, a copy they refuse sends no rows.
+func (s wrappedStmt) copyExec(ctx context.Context, args []driver.NamedValue) (res driver.Result, err error) {
+	call := s.copy.call
+	if call == nil {
+		call = s.conn.startOp(ctx, nil, OpSQLCopy, s.query, nil)
+		if ctx, err = call.before(); err != nil {
+			call.finish(err)
+			return nil, err
+		}
+		s.copy.call = call
+	}
+
+	if len(args) > 0 {
+		s.copy.rows++
+		s.copy.bytes += argsSize(args)
+
+		return s.parentExec(ctx, args)
+	}
+
+	call.setLabel("rows", strconv.FormatInt(s.copy.rows, 10))
+	call.setLabel("bytes", strconv.FormatInt(s.copy.bytes, 10))
+	*s.copy = copyState{}
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	return s.parentExec(ctx, nil)
+}
+
+// abandonCopy records the rows of a COPY statement sent since the last flush, if any, as a failed sql-copy operation,
+// as the statement is closed without flushing them
+func (s wrappedStmt) abandonCopy() {
+	if s.copy == nil || s.copy.call == nil {
+		return
+	}
+
+	call := s.copy.call
+	call.setLabel("rows", strconv.FormatInt(s.copy.rows, 10))
+	call.setLabel("bytes", strconv.FormatInt(s.copy.bytes, 10))
+	*s.copy = copyState{}
+	call.finish(errCopyNotFlushed)
+}
+
+// parentExec runs the statement on the parent without instrumenting it
+func (s wrappedStmt) parentExec(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if stmtExecContext := s.caps.execContext; stmtExecContext != nil && ctx != nil {
+		return stmtExecContext.ExecContext(ctx, args)
+	}
+
+	dargs, err := s.toValues(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.parent.Exec(dargs)
+}
+
+// CopyFrom runs copyRows, which copies rows using the parent of driverConn directly, such as with the CopyFrom of pgx,
+// as a single sql-copy operation recording the number of rows and bytes copied. copyRows returns 0 bytes if it does not
+// know how many were sent, they are not recorded then. driverConn is the connection passed to the function
+// given to the Raw method of sql.Conn, copyRows gets its parent and the context to copy with, which carries
+// what the hooks added to ctx:
+//
+//	conn.Raw(func(driverConn interface{}) error {
+//		return instrumentedsql.CopyFrom(ctx, driverConn, "users", func(ctx context.Context, parent interface{}) (int64, int64, error) {
+//			rows, err := parent.(*stdlib.Conn).Conn().CopyFrom(ctx, pgx.Identifier{"users"}, columns, source)
+//			return rows, 0, err
+//		})
+//	})
+func CopyFrom(ctx context.Context, driverConn interface{}, table string,
+	copyRows func(ctx context.Context, parent interface{}) (rows, bytes int64, err error)) (err error) {
+	c, ok := driverConn.(*wrappedConn)
+	if !ok {
+		// The driver was not wrapped
+		_, _, err = copyRows(ctx, driverConn)
+		return err
+	}
+
+	call := c.startOp(ctx, nil, OpSQLCopy, "COPY "+table+" FROM STDIN", nil)
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if ctx, err = call.before(); err != nil {
+		return err
+	}
+
+	rows, bytes, err := copyRows(ctx, c.parent)
+	call.setLabel("rows", strconv.FormatInt(rows, 10))
+	if bytes > 0 {
+		call.setLabel("bytes", strconv.FormatInt(bytes, 10))
+	}
+
+	return err
+}
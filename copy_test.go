@@ -0,0 +1,172 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestCopyIn(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger)), "")
+
+	stmt, err := db.Prepare(`COPY "users" ("name", "age") FROM STDIN`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := stmt.Exec(name, 30); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	stmt.Close()
+
+	logger.AssertNames(t, "sql-conn-open", "sql-prepare", "sql-copy", "sql-stmt-close")
+	copied := logger.Find("sql-copy")[0]
+	if copied.Labels["rows"] != "3" || copied.Labels["bytes"] != "37" {
+		t.Errorf("copy recorded with labels %v, want 3 rows and 37 bytes", copied.Labels)
+	}
+}
+
+func TestCopyInNotFlushed(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger)), "")
+
+	stmt, err := db.Prepare(`COPY "users" ("name") FROM STDIN`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Exec("alice"); err != nil {
+		t.Fatal(err)
+	}
+	stmt.Close()
+
+	logger.AssertNames(t, "sql-conn-open", "sql-prepare", "sql-copy", "sql-stmt-close")
+	if copied := logger.Find("sql-copy")[0]; copied.Labels["rows"] != "1" || copied.Err != errCopyNotFlushed {
+		t.Errorf("copy recorded as %+v, want a failed copy of 1 row", copied)
+	}
+}
+
+func TestCopyFrom(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger)), "")
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	failed := errors.New("copy failed")
+	err = conn.Raw(func(driverConn interface{}) error {
+		return CopyFrom(ctx, driverConn, "users", func(ctx context.Context, parent interface{}) (int64, int64, error) {
+			if _, ok := parent.(driver.Conn).(*fakeConn); !ok {
+				t.Errorf("copy got %T, want the parent connection", parent)
+			}
+			return 2, 24, failed
+		})
+	})
+	if err != failed {
+		t.Errorf("CopyFrom() = %v, want %v", err, failed)
+	}
+
+	copied := logger.AssertQuery(t, "COPY users FROM STDIN")
+	if copied.Name != "sql-copy" || copied.Labels["rows"] != "2" || copied.Labels["bytes"] != "24" || copied.Err != failed {
+		t.Errorf("copy recorded as %+v", copied)
+	}
+}
+
+// copyHook counts the copies it is called for, refusing them with err if set, and adds a value to their context
+type copyHook struct {
+	err           error
+	before, after *int
+}
+
+func (h copyHook) Before(ctx context.Context, op Op, query string, args []driver.NamedValue) (context.Context, error) {
+	if op != OpSQLCopy {
+		return ctx, nil
+	}
+	*h.before++
+	if h.err != nil {
+		return nil, h.err
+	}
+	return context.WithValue(ctx, hookKey{}, "copy"), nil
+}
+
+func (h copyHook) After(ctx context.Context, op Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration) {
+	if op == OpSQLCopy {
+		*h.after++
+	}
+}
+
+func TestCopyInHooks(t *testing.T) {
+	refused := errors.New("refused")
+	for _, hookErr := range []error{nil, refused} {
+		var before, after int
+		logger := instrumentedsqltest.NewLogger()
+		db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithHooks(copyHook{err: hookErr, before: &before, after: &after})), "")
+
+		stmt, err := db.Prepare(`COPY "users" ("name") FROM STDIN`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The hooks run once for the whole copy, when its first row is sent
+		_, err = stmt.Exec("alice")
+		if !errors.Is(err, hookErr) {
+			t.Fatalf("sending the first row returned %v, want %v", err, hookErr)
+		}
+		if hookErr == nil {
+			for _, name := range []string{"bob", "carol"} {
+				if _, err := stmt.Exec(name); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := stmt.Exec(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stmt.Close()
+
+		wantAfter := 1
+		if hookErr != nil {
+			wantAfter = 0
+		}
+		if before != 1 || after != wantAfter {
+			t.Errorf("hook error %v: Before called %d times and After %d times, want 1 and %d", hookErr, before, after, wantAfter)
+		}
+		copies := logger.Find("sql-copy")
+		if len(copies) != 1 || copies[0].Err != hookErr {
+			t.Errorf("hook error %v: recorded copies %+v", hookErr, copies)
+		}
+	}
+}
+
+func TestCopyFromHooks(t *testing.T) {
+	var before, after int
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithHooks(copyHook{before: &before, after: &after})), "")
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		return CopyFrom(ctx, driverConn, "users", func(ctx context.Context, parent interface{}) (int64, int64, error) {
+			if ctx.Value(hookKey{}) != "copy" {
+				t.Error("copy got a context without the value added by the hook")
+			}
+			return 1, 10, nil
+		})
+	})
+	if err != nil || before != 1 || after != 1 {
+		t.Errorf("CopyFrom() = %v with Before called %d times and After %d times, want 1 each", err, before, after)
+	}
+}
@@ -0,0 +1,42 @@
+package instrumentedsql
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// checkDeadline warns about operations starting with less time left before the deadline of their context
+// than configured with WithDeadlineWarning
+func (c *opCall) checkDeadline() {
+	if c.ctx == nil {
+		return
+	}
+	deadline, ok := c.ctx.Deadline()
+	if !ok {
+		return
+	}
+
+	remaining := time.Until(deadline)
+	if remaining >= c.deadlineWarning {
+		return
+	}
+
+	c.setLabel("deadline_remaining", remaining.String())
+	c.events.Log(c.ctx, "sql-deadline-warning", "op", c.opName(c.op), "query", c.shown, "deadline_remaining", remaining)
+}
+
+// recordCancellation records why the context of the operation was done, if it was, and whether the parent driver
+// gave up because of it, to tell client side timeouts from slow queries
+func (c *opCall) recordCancellation(err error) {
+	if c.ctx == nil || c.ctx.Err() == nil {
+		return
+	}
+
+	ctxErr := c.ctx.Err()
+	c.setLabel("ctx_err", ctxErr.Error())
+	if cause := contextCause(c.ctx); cause != nil && cause != ctxErr {
+		c.setLabel("ctx_cause", cause.Error())
+	}
+	c.setLabel("driver_aborted", strconv.FormatBool(errors.Is(err, ctxErr)))
+}
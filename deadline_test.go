@@ -0,0 +1,30 @@
+package instrumentedsql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestRecordCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{context.Background(), nil, "[]"},
+		{ctx, fmt.Errorf("query: %w", context.Canceled), "[ctx_err context canceled driver_aborted true]"},
+		{ctx, nil, "[ctx_err context canceled driver_aborted false]"},
+	}
+
+	for _, test := range tests {
+		c := &opCall{opts: &opts{}, ctx: test.ctx}
+		c.recordCancellation(test.err)
+		if got := fmt.Sprint(c.keyvals); got != test.want {
+			t.Errorf("recordCancellation(%v) recorded %s, want %s", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package instrumentedsql
+
+import "regexp"
+
+// QueryRule matches queries by their text or fingerprint, see WithQueryAllowlist and WithQueryDenylist
+type QueryRule struct {
+	// Pattern matches the text of queries when set
+	Pattern *regexp.Regexp
+	// Fingerprint matches the queries with this fingerprint when set, as reported by QueryStats.
+	// It is normalized, so a query with literal values can be given as well.
+	Fingerprint string
+}
+
+// queryDetail decides which queries are instrumented in full, from the allowlist and denylist rules
+type queryDetail struct {
+	allow []QueryRule
+	deny  []QueryRule
+	// fingerprints is set when a rule matches fingerprints, so that they are only computed then
+	fingerprints bool
+}
+
+func (d *queryDetail) add(rules []QueryRule, deny bool) {
+	for _, rule := range rules {
+		if rule.Fingerprint != "" {
+			rule.Fingerprint = fingerprint(rule.Fingerprint)
+			d.fingerprints = true
+		}
+		if deny {
+			d.deny = append(d.deny, rule)
+		} else {
+			d.allow = append(d.allow, rule)
+		}
+	}
+}
+
+// detailed reports whether the query of call gets full detail: it matches the allowlist, if any, and not the denylist
+func (d *queryDetail) detailed(call *opCall) bool {
+	fp := ""
+	if d.fingerprints {
+		fp = call.fingerprint()
+	}
+
+	if len(d.allow) > 0 && !matchRules(d.allow, call.query, fp) {
+		return false
+	}
+
+	return !matchRules(d.deny, call.query, fp)
+}
+
+func matchRules(rules []QueryRule, query, fp string) bool {
+	for _, rule := range rules {
+		if rule.Pattern != nil && rule.Pattern.MatchString(query) {
+			return true
+		}
+		if rule.Fingerprint != "" && rule.Fingerprint == fp {
+			return true
+		}
+	}
+
+	return false
+}
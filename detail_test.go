@@ -0,0 +1,80 @@
+package instrumentedsql
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestQueryDetail(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Opt
+		detailed []string
+	}{
+		{
+			name:     "denylist",
+			opts:     []Opt{WithQueryDenylist(QueryRule{Pattern: regexp.MustCompile(`^SELECT 1$`)}, QueryRule{Fingerprint: "UPDATE t SET a = 5"})},
+			detailed: []string{"DELETE FROM t"},
+		},
+		{
+			name:     "allowlist",
+			opts:     []Opt{WithQueryAllowlist(QueryRule{Pattern: regexp.MustCompile(`(?i)^(update|delete)`)})},
+			detailed: []string{"UPDATE t SET a = ?", "DELETE FROM t"},
+		},
+		{
+			name: "both",
+			opts: []Opt{
+				WithQueryAllowlist(QueryRule{Pattern: regexp.MustCompile(`(?i)^(update|delete)`)}),
+				WithQueryDenylist(QueryRule{Fingerprint: "DELETE FROM t"}),
+			},
+			detailed: []string{"UPDATE t SET a = ?"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			tr := instrumentedsqltest.NewTracer()
+			wrapped := WrapDriver(&fakeDriver{api: fakeExecerAPI}, append(tt.opts, WithLogger(logger), WithTracer(tr), WithQueryStats())...)
+			db := openBenchDB(t, wrapped, "")
+
+			for _, query := range []string{"SELECT 1", "UPDATE t SET a = ?", "DELETE FROM t"} {
+				var args []interface{}
+				if query == "UPDATE t SET a = ?" {
+					args = append(args, 1)
+				}
+				if _, err := db.Exec(query, args...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var logged []string
+			for _, op := range logger.Find(string(OpSQLConnExec)) {
+				logged = append(logged, op.Query)
+			}
+			if len(logged) != len(tt.detailed) {
+				t.Fatalf("logged %q, want %q", logged, tt.detailed)
+			}
+			for n := range logged {
+				if logged[n] != tt.detailed[n] {
+					t.Errorf("logged %q, want %q", logged, tt.detailed)
+				}
+			}
+			spans := 0
+			for _, span := range tr.Spans() {
+				if strings.HasPrefix(span.Name, "("+string(OpSQLConnExec)+")") {
+					spans++
+				}
+			}
+			if spans != len(tt.detailed) {
+				t.Errorf("recorded %d exec spans, want %d", spans, len(tt.detailed))
+			}
+			if n := len(wrapped.(interface{ Stats() []QueryStats }).Stats()); n != 3 {
+				t.Errorf("recorded stats for %d queries, want all 3", n)
+			}
+		})
+	}
+}
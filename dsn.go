@@ -0,0 +1,159 @@
+package instrumentedsql
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// dsnInfo is what a DSN tells about the server a connection is made to, never the password, see WithDSNAttributes
+type dsnInfo struct {
+	host     string
+	port     string
+	user     string
+	database string
+}
+
+// labels records the known parts of the DSN on call
+func (i *dsnInfo) labels(call *opCall) {
+	if i.host != "" {
+		call.setLabel("db_host", i.host)
+	}
+	if i.port != "" {
+		call.setLabel("db_port", i.port)
+	}
+	if i.user != "" {
+		call.setLabel("db_user", i.user)
+	}
+	if i.database != "" {
+		call.setLabel("db_database", i.database)
+	}
+}
+
+// parseDSN extracts what it can from the common DSN formats: URLs such as postgres://user@host:5432/db,
+// the MySQL user@tcp(host:3306)/db format and key/value pairs such as host=localhost dbname=db or server=host;database=db.
+// It gives up on anything else, such as the file names of sqlite.
+func parseDSN(dsn string) dsnInfo {
+	switch {
+	case strings.Contains(dsn, "://"):
+		return parseURLDSN(dsn)
+	case strings.Contains(dsn, "="):
+		if i := strings.IndexAny(dsn, "=/("); dsn[i] == '=' {
+			return parseKeyValueDSN(dsn)
+		}
+	}
+	if strings.Contains(dsn, "/") && (strings.Contains(dsn, "@") || strings.Contains(dsn, "(")) {
+		return parseMySQLDSN(dsn)
+	}
+
+	return dsnInfo{}
+}
+
+func parseURLDSN(dsn string) dsnInfo {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsnInfo{}
+	}
+
+	info := dsnInfo{host: u.Hostname(), port: u.Port(), database: strings.TrimPrefix(u.Path, "/")}
+	if u.User != nil {
+		info.user = u.User.Username()
+	}
+	query := u.Query()
+	for _, key := range []string{"database", "dbname"} {
+		if db := query.Get(key); db != "" {
+			info.database = db
+		}
+	}
+	if user := query.Get("user"); user != "" && info.user == "" {
+		info.user = user
+	}
+
+	return info
+}
+
+// parseMySQLDSN parses [user[:password]@][net[(addr)]]/dbname[?params]
+func parseMySQLDSN(dsn string) dsnInfo {
+	var info dsnInfo
+
+	slash := strings.LastIndex(dsn, "/")
+	info.database = dsn[slash+1:]
+	if i := strings.IndexByte(info.database, '?'); i >= 0 {
+		info.database = info.database[:i]
+	}
+
+	rest := dsn[:slash]
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		info.user = rest[:at]
+		if i := strings.IndexByte(info.user, ':'); i >= 0 {
+			info.user = info.user[:i]
+		}
+		rest = rest[at+1:]
+	}
+	if open := strings.IndexByte(rest, '('); open >= 0 && strings.HasSuffix(rest, ")") {
+		addr := rest[open+1 : len(rest)-1]
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			info.host, info.port = host, port
+		} else {
+			info.host = addr
+		}
+	}
+
+	return info
+}
+
+// parseKeyValueDSN parses pairs separated by spaces or semicolons, values may be quoted with single quotes
+func parseKeyValueDSN(dsn string) dsnInfo {
+	var info dsnInfo
+
+	for len(dsn) > 0 {
+		dsn = strings.TrimLeft(dsn, " \t\n;")
+		eq := strings.IndexByte(dsn, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(dsn[:eq]))
+		dsn = strings.TrimLeft(dsn[eq+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(dsn, "'") {
+			var b strings.Builder
+			n := 1
+			for ; n < len(dsn) && dsn[n] != '\''; n++ {
+				if dsn[n] == '\\' && n+1 < len(dsn) {
+					n++
+				}
+				b.WriteByte(dsn[n])
+			}
+			value = b.String()
+			if n < len(dsn) {
+				// Skip the closing quote
+				n++
+			}
+			dsn = dsn[n:]
+		} else {
+			end := strings.IndexAny(dsn, " \t\n;")
+			if end < 0 {
+				end = len(dsn)
+			}
+			value, dsn = dsn[:end], dsn[end:]
+		}
+
+		switch key {
+		case "host", "server", "data source", "address", "addr":
+			// MSSQL accepts host,port
+			if i := strings.IndexByte(value, ','); i >= 0 {
+				value, info.port = value[:i], value[i+1:]
+			}
+			info.host = value
+		case "port":
+			info.port = value
+		case "user", "user id", "uid", "username":
+			info.user = value
+		case "dbname", "database", "initial catalog":
+			info.database = value
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,39 @@
+package instrumentedsql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// maxTxQueries bounds the number of distinct queries remembered per transaction, see WithDuplicateQueryDetection
+const maxTxQueries = 1000
+
+// duplicateKey returns the key of a query and its args, which is the same for byte-identical queries only
+func duplicateKey(query string, args []driver.NamedValue) string {
+	var b strings.Builder
+	b.WriteString(query)
+	for _, arg := range args {
+		fmt.Fprintf(&b, "\x00%s:%d:%#v", arg.Name, arg.Ordinal, arg.Value)
+	}
+
+	return b.String()
+}
+
+// detectDuplicate counts the query of the operation among the ones run in the transaction in progress, and logs
+// a sql-duplicate-query warning the first time it is run again with the same args
+func (c *opCall) detectDuplicate() {
+	queries := c.conn.txQueries
+	key := duplicateKey(c.query, c.args)
+	n, ok := queries[key]
+	if !ok && len(queries) >= maxTxQueries {
+		return
+	}
+	n++
+	queries[key] = n
+	c.txExecutions = n
+
+	if n == 2 {
+		c.events.Log(c.ctx, "sql-duplicate-query", "op", c.opName(c.op), "query", c.shown, "conn_id", c.conn.id)
+	}
+}
@@ -0,0 +1,47 @@
+package instrumentedsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestDuplicateQueryDetection(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithDuplicateQueryDetection()), "")
+	ctx := context.Background()
+
+	// Outside of a transaction queries are not tracked
+	for n := 0; n < 2; n++ {
+		if _, err := db.ExecContext(ctx, "UPDATE t SET a = 1 WHERE id = ?", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{1, 2, 1, 1} {
+		if _, err := tx.ExecContext(ctx, "UPDATE t SET a = 1 WHERE id = ?", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if warnings := logger.Find("sql-duplicate-query"); len(warnings) != 1 {
+		t.Errorf("logged %d warnings, want 1", len(warnings))
+	}
+	var duplicates []interface{}
+	for _, op := range logger.Find(string(OpSQLConnExec)) {
+		if n, ok := op.Labels["duplicate_in_tx"]; ok {
+			duplicates = append(duplicates, n)
+		}
+	}
+	if len(duplicates) != 2 || duplicates[0] != "2" || duplicates[1] != "3" {
+		t.Errorf("duplicate_in_tx labels are %v, want [2 3]", duplicates)
+	}
+}
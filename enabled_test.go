@@ -0,0 +1,74 @@
+package instrumentedsql
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestSetEnabled(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	var flag int32 = 1
+	d := WrapDriver(&fakeDriver{}, WithLogger(logger), WithEnabled(func() bool { return atomic.LoadInt32(&flag) == 1 }))
+	db := openBenchDB(t, d, "")
+	db.SetMaxOpenConns(4)
+	setEnabled := d.(interface{ SetEnabled(bool) }).SetEnabled
+
+	execs := func() int {
+		return len(logger.Find(string(OpSQLConnExec)))
+	}
+	exec := func() {
+		if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exec()
+	setEnabled(false)
+	exec()
+	if n := execs(); n != 1 {
+		t.Errorf("recorded %d execs once switched off, want 1", n)
+	}
+	setEnabled(true)
+	exec()
+	if n := execs(); n != 2 {
+		t.Errorf("recorded %d execs once switched back on, want 2", n)
+	}
+	atomic.StoreInt32(&flag, 0)
+	exec()
+	if n := execs(); n != 2 {
+		t.Errorf("recorded %d execs with the feature flag off, want 2", n)
+	}
+	atomic.StoreInt32(&flag, 1)
+
+	// Switching while operations run is safe, every one of them is either recorded or not
+	logger.Reset()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for n := 0; n < 100; n++ {
+		setEnabled(n%2 == 0)
+	}
+	wg.Wait()
+	setEnabled(true)
+	if n := execs(); n > 400 {
+		t.Errorf("recorded %d execs out of 400", n)
+	}
+	logger.Reset()
+	exec()
+	if n := execs(); n != 1 {
+		t.Errorf("recorded %d execs once switched back on, want 1", n)
+	}
+}
@@ -0,0 +1,116 @@
+package instrumentedsql
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverError is what the errors of well known drivers tell about failures on the server side
+type serverError struct {
+	// sqlState is the SQLSTATE of the error
+	sqlState string
+	// code is the vendor specific error code, such as the error numbers of MySQL
+	code string
+	// constraint is the name of the constraint violated, if any
+	constraint string
+}
+
+// parseServerError looks for the errors of lib/pq, pgx and go-sql-driver/mysql in the chain of err,
+// by their methods and fields since this package does not depend on the drivers
+func parseServerError(err error) (serverError, bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		var info serverError
+		if stater, ok := err.(sqlStater); ok {
+			info.sqlState = stater.SQLState()
+		}
+
+		v := reflect.ValueOf(err)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Struct && strings.Contains(v.Type().Name(), "Error") {
+			// MySQLError has Number uint16 and SQLState [5]byte, pq.Error and pgconn.PgError have Code string
+			if f := v.FieldByName("Number"); f.IsValid() && isUint(f.Kind()) {
+				info.code = strconv.FormatUint(f.Uint(), 10)
+			}
+			if f := v.FieldByName("SQLState"); f.IsValid() && f.Kind() == reflect.Array && f.Type().Elem().Kind() == reflect.Uint8 && f.Index(0).Uint() != 0 {
+				state := make([]byte, f.Len())
+				reflect.Copy(reflect.ValueOf(state), f)
+				info.sqlState = string(state)
+			}
+			if f := v.FieldByName("Code"); f.IsValid() && f.Kind() == reflect.String && info.sqlState == "" {
+				info.sqlState = f.String()
+			}
+			for _, name := range []string{"Constraint", "ConstraintName"} {
+				if f := v.FieldByName(name); f.IsValid() && f.Kind() == reflect.String {
+					info.constraint = f.String()
+				}
+			}
+		}
+
+		if info != (serverError{}) {
+			return info, true
+		}
+	}
+
+	return serverError{}, false
+}
+
+func isUint(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+// recordServerError records the SQLSTATE, vendor code and constraint of a failure on the server side
+func (c *opCall) recordServerError(err error) {
+	info, ok := parseServerError(err)
+	if !ok {
+		return
+	}
+
+	if info.sqlState != "" {
+		c.setLabel("sqlstate", info.sqlState)
+	}
+	if info.code != "" {
+		c.setLabel("error_code", info.code)
+	}
+	if info.constraint != "" {
+		c.setLabel("constraint", info.constraint)
+	}
+	c.recordLockFailure(info)
+}
+
+// lockFailure tells whether a server side error is a deadlock or a lock wait timeout, or neither
+func (info serverError) lockFailure() string {
+	switch {
+	case info.sqlState == "40P01" || info.code == "1213":
+		return "deadlock"
+	case info.sqlState == "55P03" || info.code == "1205":
+		return "lock_timeout"
+	}
+
+	return ""
+}
+
+// recordLockFailure logs a sql-deadlock or sql-lock-timeout event for operations failing on locks, which usually call
+// for alerting of their own, along with the fingerprint of the query and how long the transaction had been running
+func (c *opCall) recordLockFailure(info serverError) {
+	failure := info.lockFailure()
+	if failure == "" {
+		return
+	}
+
+	c.setLabel("lock_failure", failure)
+	keyvals := []interface{}{"op", c.opName(c.op), "query", c.shown, "fingerprint", c.fingerprint(), "conn_id", c.conn.id}
+	if !c.conn.txStart.IsZero() {
+		keyvals = append(keyvals, "tx_duration", time.Since(c.conn.txStart))
+	}
+	c.events.Log(c.ctx, "sql-"+strings.Replace(failure, "_", "-", -1), keyvals...)
+}
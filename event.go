@@ -0,0 +1,103 @@
+package instrumentedsql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// QueryEvent is the record of an operation written to an EventSink, see WithEventSink.
+// Its fields and their JSON names are stable, new ones may be added.
+type QueryEvent struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	// Statement is set for the operations running a statement, as opposed to prepares or transactions
+	Statement bool `json:"statement"`
+	// Query is the query as recorded in spans and logs, see WithSecretScanning, and Fingerprint its normalized form
+	Query       string `json:"query,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Args are the args as recorded in the args label, they are empty with WithArgsSummary
+	Args     string        `json:"args,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	Err      string        `json:"error,omitempty"`
+	// Rows is the number of rows fetched by queries
+	Rows    int64  `json:"rows,omitempty"`
+	DB      string `json:"db,omitempty"`
+	ConnID  uint64 `json:"conn_id"`
+	TraceID string `json:"trace_id,omitempty"`
+	// Labels are the other labels of the operation, such as caller or tenant
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// EventSink receives the event of every operation logged, see WithEventSink
+type EventSink interface {
+	WriteEvent(ctx context.Context, event QueryEvent) error
+}
+
+// jsonEventSink writes events as JSON lines, see NewJSONEventSink
+type jsonEventSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONEventSink returns an EventSink writing one JSON object per line to w, which is safe for concurrent use.
+// It gives services without a tracing infrastructure a complete query log that can be searched with grep or jq.
+func NewJSONEventSink(w io.Writer) EventSink {
+	return &jsonEventSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonEventSink) WriteEvent(ctx context.Context, event QueryEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enc.Encode(event)
+}
+
+// writeEvent writes the event of the operation to the event sink, failures are logged as a sql-event-sink-failed warning
+func (c *opCall) writeEvent(err error, duration time.Duration) {
+	event := QueryEvent{
+		Time:      c.start,
+		Op:        c.opName(c.op),
+		Query:     c.shown,
+		Statement: isStatementOp(c.op),
+		Duration:  duration,
+		DB:        c.dbName,
+		ConnID:    c.conn.id,
+	}
+	if c.query != "" {
+		event.Fingerprint = c.fingerprint()
+	}
+	if err != nil {
+		event.Err = err.Error()
+	}
+	if ider, ok := c.span.(TraceIDer); ok {
+		event.TraceID = ider.TraceID()
+	}
+
+	for n := 0; n+1 < len(c.keyvals); n += 2 {
+		key, _ := c.keyvals[n].(string)
+		value, ok := c.keyvals[n+1].(string)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "query", "db", "conn_id":
+		case "args":
+			event.Args = value
+		case "rows":
+			event.Rows, _ = strconv.ParseInt(value, 10, 64)
+		default:
+			if event.Labels == nil {
+				event.Labels = map[string]string{}
+			}
+			event.Labels[key] = value
+		}
+	}
+
+	if err := c.eventSink.WriteEvent(c.routeContext(), event); err != nil {
+		c.events.Log(c.routeContext(), "sql-event-sink-failed", "op", event.Op, "err", err.Error())
+	}
+}
@@ -0,0 +1,71 @@
+package instrumentedsql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONEventSink(t *testing.T) {
+	var buf bytes.Buffer
+	db := openBenchDB(t, WrapDriver(&fakeDriver{rows: 2}, WithDBName("app"), WithEventSink(NewJSONEventSink(&buf)),
+		WithOpsExcluded(OpSQLConnOpen, OpSQLConnClose, OpSQLPrepare, OpSQLStmtClose)), "")
+
+	rows, err := db.QueryContext(Labeled(context.Background(), map[string]string{"feature": "search"}), "SELECT n FROM t WHERE id = ?", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("wrote %d lines, want 1:\n%s", len(lines), buf.String())
+	}
+	var event QueryEvent
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Op != string(OpSQLConnQuery) || event.Query != "SELECT n FROM t WHERE id = ?" || event.Fingerprint == "" ||
+		!strings.Contains(event.Args, "42") || event.Rows != 2 || event.DB != "app" || event.ConnID == 0 ||
+		event.Labels["feature"] != "search" || event.Duration <= 0 || event.Time.IsZero() {
+		t.Errorf("event is %+v", event)
+	}
+}
+
+func TestWideEventSink(t *testing.T) {
+	var events []map[string]interface{}
+	sink := NewWideEventSink(func(ctx context.Context, fields map[string]interface{}) error {
+		events = append(events, fields)
+		return nil
+	})
+	db := openBenchDB(t, WrapDriver(&fakeDriver{rows: 1}, WithEventSink(sink), WithCallerAttribution(),
+		WithTenantExtractor(func(ctx context.Context) string { return "acme" }, 0)), "")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("UPDATE t SET n = 1 WHERE id = ?", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("sent %d events, want one for the statement", len(events))
+	}
+	fields := events[0]
+	for _, name := range []string{"timestamp", "duration_ms", "db.query", "db.fingerprint", "db.rows", "db.conn_id", "db.caller"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("event has no %s field: %v", name, fields)
+		}
+	}
+	if fields["db.tenant"] != "acme" || fields["db.fingerprint"] != "UPDATE t SET n = ? WHERE id = ?" {
+		t.Errorf("event is %v", fields)
+	}
+}
@@ -0,0 +1,142 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/away-team/go-tracer/tracer"
+)
+
+// explainTimeout bounds the time spent explaining a single query
+const explainTimeout = 5 * time.Second
+
+// explainer runs EXPLAIN for slow queries on a connection of its own, see WithExplain
+type explainer struct {
+	parent    driver.Driver
+	threshold time.Duration
+	interval  time.Duration
+
+	// last is the time of the last EXPLAIN in unix nanoseconds, it is accessed atomically
+	last int64
+	// running tracks the EXPLAINs in progress, for Flush
+	running sync.WaitGroup
+}
+
+// maybeExplain explains the query of call in the background if it was slow enough and the rate limit allows it.
+// The plan is recorded as an OpSQLExplain operation which is a child of the one of call.
+func (e *explainer) maybeExplain(call *opCall, duration time.Duration) {
+	if duration < e.threshold || !explainable(call.op, call.query) {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&e.last)
+	if now-last < int64(e.interval) || !atomic.CompareAndSwapInt64(&e.last, last, now) {
+		return
+	}
+
+	// The args belong to database/sql once the query is done, and call is not to be used after it is finished
+	conn, ctx, parent, query := call.conn, call.ctx, call.span, call.query
+	args := append([]driver.NamedValue(nil), call.args...)
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+		e.explain(conn, ctx, parent, query, args)
+	}()
+}
+
+// explain records the plan of query as a child of parent
+func (e *explainer) explain(conn *wrappedConn, ctx context.Context, parent tracer.Span, query string, args []driver.NamedValue) {
+	explainCall := conn.startOp(ctx, parent, OpSQLExplain, query, nil)
+
+	planCtx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+
+	plan, err := e.plan(planCtx, conn.dsn, query, args)
+	if err == nil {
+		explainCall.setLabel("plan", plan)
+	}
+	explainCall.finish(err)
+}
+
+// plan runs EXPLAIN for query on a new connection and returns the plan, one line per row
+func (e *explainer) plan(ctx context.Context, dsn, query string, args []driver.NamedValue) (string, error) {
+	conn, err := e.parent.Open(dsn)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	explain := "EXPLAIN " + query
+
+	var rows driver.Rows
+	if queryer, ok := conn.(driver.QueryerContext); ok {
+		rows, err = queryer.QueryContext(ctx, explain, args)
+	} else {
+		var stmt driver.Stmt
+		stmt, err = conn.Prepare(explain)
+		if err != nil {
+			return "", err
+		}
+		defer stmt.Close()
+
+		var dargs []driver.Value
+		dargs, err = namedValueToValue(args)
+		if err != nil {
+			return "", err
+		}
+		rows, err = stmt.Query(dargs)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	dest := make([]driver.Value, len(rows.Columns()))
+	for {
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		fields := make([]string, len(dest))
+		for n, v := range dest {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			fields[n] = fmt.Sprint(v)
+		}
+		lines = append(lines, strings.Join(fields, " | "))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// explainable reports whether the query of op can be explained without executing it
+func explainable(op Op, query string) bool {
+	if !isStatementOp(op) {
+		return false
+	}
+
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH", "INSERT", "UPDATE", "DELETE", "REPLACE":
+		return true
+	}
+
+	return false
+}
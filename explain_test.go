@@ -0,0 +1,84 @@
+package instrumentedsql
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestExplain(t *testing.T) {
+	cases := []struct {
+		name      string
+		threshold time.Duration
+		interval  time.Duration
+		queries   []string
+		want      []string
+	}{
+		{
+			name:      "faster than the threshold",
+			threshold: time.Hour,
+			queries:   []string{"SELECT a FROM t"},
+		},
+		{
+			name:      "rate limited",
+			threshold: time.Nanosecond,
+			interval:  time.Hour,
+			queries:   []string{"SELECT a FROM t", "SELECT b FROM t"},
+			want:      []string{"EXPLAIN SELECT a FROM t"},
+		},
+		{
+			name:      "not explainable",
+			threshold: time.Nanosecond,
+			queries:   []string{"CREATE TABLE t (a int)", "UPDATE t SET a = 1"},
+			want:      []string{"EXPLAIN UPDATE t SET a = 1"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			parent := &fakeDriver{rows: 2}
+			logger := instrumentedsqltest.NewLogger()
+			tr := instrumentedsqltest.NewTracer()
+			d := WrapDriver(parent, WithLogger(logger), WithTracer(tr), WithDBSystem(systemPostgres), WithExplain(tc.threshold, tc.interval))
+			db := openBenchDB(t, d, "")
+			ctx := tr.ContextWithSpan(context.Background(), "request")
+
+			for _, query := range tc.queries {
+				if _, err := db.ExecContext(ctx, query); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := d.(interface{ Flush(context.Context) error }).Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			var explained []string
+			for _, query := range parent.sentQueries() {
+				if strings.HasPrefix(query, "EXPLAIN ") {
+					explained = append(explained, query)
+				}
+			}
+			if !reflect.DeepEqual(explained, tc.want) {
+				t.Errorf("explained %q, want %q", explained, tc.want)
+			}
+			explains := logger.Find(string(OpSQLExplain))
+			if len(explains) != len(tc.want) {
+				t.Fatalf("recorded %d explains, want %d", len(explains), len(tc.want))
+			}
+			for _, op := range explains {
+				if op.Labels["plan"] != "1\n0" || op.Err != nil {
+					t.Errorf("recorded explain %+v, want the rows of the plan", op)
+				}
+			}
+			for _, span := range tr.Spans() {
+				if span.Labels["plan"] != "" && span.Parent != "(sql-conn-exec) "+span.Labels["query"] {
+					t.Errorf("recorded explain %+v, want it in the span of the slow query", span)
+				}
+			}
+		})
+	}
+}
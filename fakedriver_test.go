@@ -0,0 +1,232 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// fakeAPI selects the optional interfaces implemented by the connections and statements of a fakeDriver,
+// so that the fallbacks of the wrapper for parent drivers missing them are exercised
+type fakeAPI int
+
+const (
+	// fakeContextAPI implements every optional interface the wrapper uses
+	fakeContextAPI fakeAPI = iota
+	// fakeExecerAPI only implements driver.Execer and driver.Queryer on top of driver.Conn
+	fakeExecerAPI
+	// fakeBareAPI only implements driver.Conn and driver.Stmt
+	fakeBareAPI
+)
+
+// fakeDriver is an in memory driver doing no work, queries return rows rows of a single column
+type fakeDriver struct {
+	rows int
+	api  fakeAPI
+	// execErr is returned by the ExecContext of connections if set
+	execErr error
+	// execPanic makes the ExecContext of connections panic with it if set
+	execPanic interface{}
+	// beginPanic makes the BeginTx of connections panic with it if set
+	beginPanic interface{}
+	// nextErr is returned by the Next of rows instead of io.EOF if set, closeErr by their Close
+	nextErr  error
+	closeErr error
+	// pingErr is returned by the Ping of connections if set
+	pingErr error
+
+	// prepares and closes count the statements prepared and closed, accessed atomically
+	prepares int64
+	closes   int64
+
+	mu sync.Mutex
+	// sent are the queries passed to the connections, to check what the wrapper sends
+	sent []string
+}
+
+// send records a query passed to a connection
+func (d *fakeDriver) send(query string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sent = append(d.sent, query)
+}
+
+// sentQueries returns the queries passed to the connections so far
+func (d *fakeDriver) sentQueries() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string(nil), d.sent...)
+}
+
+type fakeBareConn struct {
+	driver *fakeDriver
+}
+
+type fakeExecerConn struct {
+	*fakeBareConn
+}
+
+type fakeConn struct {
+	*fakeExecerConn
+}
+
+type fakeBareStmt struct {
+	conn *fakeBareConn
+}
+
+type fakeStmt struct {
+	*fakeBareStmt
+}
+
+type fakeTx struct{}
+
+// fakeArg is an arg only the connections implementing every optional interface accept, see CheckNamedValue
+type fakeArg struct{}
+
+type fakeRows struct {
+	driver *fakeDriver
+	left   int
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	conn := &fakeBareConn{driver: d}
+	switch d.api {
+	case fakeBareAPI:
+		return conn, nil
+	case fakeExecerAPI:
+		return &fakeExecerConn{conn}, nil
+	}
+
+	return &fakeConn{&fakeExecerConn{conn}}, nil
+}
+
+func (c *fakeBareConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.send(query)
+	atomic.AddInt64(&c.driver.prepares, 1)
+	return &fakeBareStmt{conn: c}, nil
+}
+
+func (c *fakeBareConn) Close() error {
+	return nil
+}
+
+func (c *fakeBareConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeExecerConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	c.driver.send(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeExecerConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	c.driver.send(query)
+	return &fakeRows{driver: c.driver, left: c.driver.rows}, nil
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.send(query)
+	atomic.AddInt64(&c.driver.prepares, 1)
+	return &fakeStmt{&fakeBareStmt{conn: c.fakeBareConn}}, nil
+}
+
+func (c *fakeConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Prepare(query)
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.driver.beginPanic != nil {
+		panic(c.driver.beginPanic)
+	}
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.send(query)
+	if c.driver.execPanic != nil {
+		panic(c.driver.execPanic)
+	}
+	if c.driver.execErr != nil {
+		return nil, c.driver.execErr
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.driver.send(query)
+	return &fakeRows{driver: c.driver, left: c.driver.rows}, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	return c.driver.pingErr
+}
+
+func (c *fakeConn) ResetSession(ctx context.Context) error {
+	return nil
+}
+
+func (c *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := nv.Value.(fakeArg); ok {
+		return nil
+	}
+
+	return driver.ErrSkip
+}
+
+func (s *fakeBareStmt) Close() error {
+	atomic.AddInt64(&s.conn.driver.closes, 1)
+	return nil
+}
+
+func (s *fakeBareStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeBareStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeBareStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{driver: s.conn.driver, left: s.conn.driver.rows}, nil
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{driver: s.conn.driver, left: s.conn.driver.rows}, nil
+}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"n"}
+}
+
+func (r *fakeRows) Close() error {
+	return r.driver.closeErr
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		if r.driver.nextErr != nil {
+			return r.driver.nextErr
+		}
+		return io.EOF
+	}
+	r.left--
+	dest[0] = int64(r.left)
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+// TestFallbacks runs the same operations on parent drivers implementing fewer and fewer optional interfaces,
+// the operations must succeed and be instrumented whichever fallback the wrapper or database/sql takes
+func TestFallbacks(t *testing.T) {
+	operations := []struct {
+		name string
+		run  func(ctx context.Context, conn *sql.Conn) error
+		ops  map[fakeAPI][]string
+	}{
+		{
+			name: "exec",
+			run: func(ctx context.Context, conn *sql.Conn) error {
+				_, err := conn.ExecContext(ctx, "UPDATE t SET a = ?", 1)
+				return err
+			},
+			ops: map[fakeAPI][]string{
+				fakeContextAPI: {"sql-conn-exec"},
+				fakeExecerAPI:  {"sql-conn-exec"},
+				fakeBareAPI:    {"sql-conn-exec", "sql-prepare", "sql-stmt-exec", "sql-stmt-close"},
+			},
+		},
+		{
+			name: "query",
+			run: func(ctx context.Context, conn *sql.Conn) error {
+				return countRows(conn.QueryContext(ctx, "SELECT a FROM t WHERE b = ?", 1))
+			},
+			ops: map[fakeAPI][]string{
+				fakeContextAPI: {"sql-conn-query"},
+				fakeExecerAPI:  {"sql-conn-query"},
+				fakeBareAPI:    {"sql-conn-query", "sql-prepare", "sql-stmt-query", "sql-stmt-close"},
+			},
+		},
+		{
+			name: "prepared",
+			run: func(ctx context.Context, conn *sql.Conn) error {
+				stmt, err := conn.PrepareContext(ctx, "SELECT a FROM t WHERE b = ?")
+				if err != nil {
+					return err
+				}
+				defer stmt.Close()
+				if _, err := stmt.ExecContext(ctx, 1); err != nil {
+					return err
+				}
+				return countRows(stmt.QueryContext(ctx, 1))
+			},
+			ops: map[fakeAPI][]string{
+				fakeContextAPI: {"sql-prepare", "sql-stmt-exec", "sql-stmt-query", "sql-stmt-close"},
+				fakeExecerAPI:  {"sql-prepare", "sql-stmt-exec", "sql-stmt-query", "sql-stmt-close"},
+				fakeBareAPI:    {"sql-prepare", "sql-stmt-exec", "sql-stmt-query", "sql-stmt-close"},
+			},
+		},
+		{
+			name: "tx",
+			run: func(ctx context.Context, conn *sql.Conn) error {
+				tx, err := conn.BeginTx(ctx, nil)
+				if err != nil {
+					return err
+				}
+				return tx.Commit()
+			},
+			ops: map[fakeAPI][]string{
+				fakeContextAPI: {"sql-tx-begin", "sql-tx-commit", "sql-tx"},
+				fakeExecerAPI:  {"sql-tx-begin", "sql-tx-commit", "sql-tx"},
+				fakeBareAPI:    {"sql-tx-begin", "sql-tx-commit", "sql-tx"},
+			},
+		},
+		{
+			name: "ping",
+			run: func(ctx context.Context, conn *sql.Conn) error {
+				return conn.PingContext(ctx)
+			},
+			ops: map[fakeAPI][]string{
+				fakeContextAPI: {"sql-ping"},
+				fakeExecerAPI:  {"sql-dummy-ping"},
+				fakeBareAPI:    {"sql-dummy-ping"},
+			},
+		},
+	}
+
+	for _, api := range []fakeAPI{fakeContextAPI, fakeExecerAPI, fakeBareAPI} {
+		for _, operation := range operations {
+			t.Run(fmt.Sprintf("%d/%s", api, operation.name), func(t *testing.T) {
+				logger := instrumentedsqltest.NewLogger()
+				db := openBenchDB(t, WrapDriver(&fakeDriver{rows: 2, api: api}, WithLogger(logger)), "")
+				ctx := context.Background()
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				logger.Reset()
+
+				if err := operation.run(ctx, conn); err != nil {
+					t.Fatal(err)
+				}
+				logger.AssertNames(t, operation.ops[api]...)
+				for _, op := range logger.Ops() {
+					if op.Err != nil && op.Err != driver.ErrSkip {
+						t.Errorf("%s failed: %v", op.Name, op.Err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCheckNamedValue(t *testing.T) {
+	for _, api := range []fakeAPI{fakeContextAPI, fakeBareAPI} {
+		db := openBenchDB(t, WrapDriver(&fakeDriver{api: api}, WithLogger(nullLogger{})), "")
+
+		// The parent connection accepts fakeArg, other args must still get the default conversion
+		_, err := db.Exec("UPDATE t SET a = ? WHERE b = ?", fakeArg{}, int32(1))
+		if accepted := err == nil; accepted != (api == fakeContextAPI) {
+			t.Errorf("api %d: Exec with fakeArg = %v", api, err)
+		}
+		stmt, err := db.Prepare("UPDATE t SET a = ? WHERE b = ?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = stmt.Exec(fakeArg{}, int32(1))
+		if accepted := err == nil; accepted != (api == fakeContextAPI) {
+			t.Errorf("api %d: Stmt.Exec with fakeArg = %v", api, err)
+		}
+		stmt.Close()
+	}
+}
+
+func TestNamedArgs(t *testing.T) {
+	for _, api := range []fakeAPI{fakeExecerAPI, fakeBareAPI} {
+		db := openBenchDB(t, WrapDriver(&fakeDriver{rows: 2, api: api}, WithLogger(nullLogger{})), "")
+		if _, err := db.Exec("UPDATE t SET a = @a", sql.Named("a", 1)); err == nil {
+			t.Errorf("api %d: Exec with named args succeeded without WithNamedArgs", api)
+		}
+
+		var converted []driver.Value
+		convert := func(args []driver.NamedValue) ([]driver.Value, error) {
+			values, err := NamedArgsAsValues(args)
+			converted = values
+			return values, err
+		}
+		db = openBenchDB(t, WrapDriver(&fakeDriver{rows: 2, api: api}, WithNamedArgs(convert)), "")
+		if _, err := db.Exec("UPDATE t SET a = @a WHERE b = ?", sql.Named("a", 1), 2); err != nil {
+			t.Fatalf("api %d: %v", api, err)
+		}
+		if len(converted) != 2 || converted[0] != sql.Named("a", int64(1)) || converted[1] != int64(2) {
+			t.Errorf("api %d: converted args to %v", api, converted)
+		}
+		if err := countRows(db.Query("SELECT a FROM t WHERE b = @b", sql.Named("b", 1))); err != nil {
+			t.Errorf("api %d: %v", api, err)
+		}
+	}
+}
+
+// countRows reads all the rows returned by a query and closes them
+func countRows(rows *sql.Rows, err error) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if n != 2 {
+		return fmt.Errorf("read %d rows, want 2", n)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package instrumentedsql
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// fingerprint normalizes a query so that executions differing only by their literal values,
+// placeholders, comments, whitespace or the length of IN lists share the same fingerprint
+func fingerprint(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	// space is set when whitespace was skipped before the next token,
+	// it is written as a single space unless it is next to a parenthesis or comma
+	space := false
+	write := func(s string) {
+		if space && b.Len() > 0 && !strings.ContainsAny(b.String()[b.Len()-1:], "(,") && !strings.ContainsAny(s[:1], "),") {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(s)
+	}
+
+	for pos := 0; pos < len(query); {
+		r, size := utf8.DecodeRuneInString(query[pos:])
+		rest := query[pos:]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			space = true
+			pos += size
+		case strings.HasPrefix(rest, "--"):
+			pos += skipPast(rest, "\n")
+			space = true
+		case strings.HasPrefix(rest, "/*"):
+			pos += 2 + skipPast(rest[2:], "*/")
+			space = true
+		case r == '\'':
+			pos += stringLiteralLen(rest, true)
+			write("?")
+		case r == '"' || r == '`':
+			n := 1 + skipPast(rest[1:], string(r))
+			write(rest[:n])
+			pos += n
+		case r == '?':
+			pos += size
+			write("?")
+		case r == '$' && len(rest) > 1 && isDigit(rest[1]):
+			n := 1
+			for n < len(rest) && isDigit(rest[n]) {
+				n++
+			}
+			pos += n
+			write("?")
+		case r < utf8.RuneSelf && isDigit(byte(r)):
+			n := 0
+			for n < len(rest) && (isDigit(rest[n]) || rest[n] == '.') {
+				n++
+			}
+			pos += n
+			write("?")
+		case isWordRune(r):
+			n := 0
+			for n < len(rest) {
+				r, size := utf8.DecodeRuneInString(rest[n:])
+				if !isWordRune(r) {
+					break
+				}
+				n += size
+			}
+			write(rest[:n])
+			pos += n
+		default:
+			write(string(r))
+			pos += size
+		}
+	}
+
+	return collapseLists(b.String())
+}
+
+// collapseLists reduces lists of placeholders such as (?, ?, ?) or (?),(?) to a single (?)
+func collapseLists(s string) string {
+	for {
+		collapsed := strings.Replace(s, "?,?", "?", -1)
+		collapsed = strings.Replace(collapsed, "(?),(?)", "(?)", -1)
+		if collapsed == s {
+			return s
+		}
+		s = collapsed
+	}
+}
+
+// skipPast returns the length of s up to and including the first occurrence of end, or the length of s
+func skipPast(s, end string) int {
+	i := strings.Index(s, end)
+	if i < 0 {
+		return len(s)
+	}
+
+	return i + len(end)
+}
+
+// stringLiteralLen returns the length of the string literal s starts with, including its quotes.
+// Quotes within the literal are escaped by doubling them, or with a backslash if backslashEscapes is set.
+func stringLiteralLen(s string, backslashEscapes bool) int {
+	for n := 1; n < len(s); n++ {
+		switch s[n] {
+		case '\\':
+			if backslashEscapes {
+				n++
+			}
+		case '\'':
+			if n+1 < len(s) && s[n+1] == '\'' {
+				n++
+				continue
+			}
+			return n + 1
+		}
+	}
+
+	return len(s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,21 @@
+package instrumentedsql
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"SELECT * FROM users WHERE id = 42", "SELECT * FROM users WHERE id = ?"},
+		{"select *\n  from users -- by id\n where id = $1", "select * from users where id = ?"},
+		{"SELECT name FROM t1 WHERE name = 'it''s' AND id IN (1, 2, 3.5)", "SELECT name FROM t1 WHERE name = ? AND id IN (?)"},
+		{"INSERT INTO t (a, b) VALUES (?, ?), (?, ?)", "INSERT INTO t (a,b) VALUES (?)"},
+		{`/* app */ UPDATE "t" SET v = -1`, `UPDATE "t" SET v = -?`},
+	}
+
+	for _, test := range tests {
+		if got := fingerprint(test.query); got != test.want {
+			t.Errorf("fingerprint(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
@@ -37,3 +37,12 @@ func (s span) SetLabel(k, v string) {
 func (s span) Finish() {
 	s.parent.Finish()
 }
+
+// TraceID returns the ID of the trace of the span, for the exemplars of the query statistics
+func (s span) TraceID() string {
+	if s.parent == nil {
+		return ""
+	}
+
+	return s.parent.TraceID()
+}
@@ -0,0 +1,102 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStatementDenied is wrapped by the errors returned by DenyUnboundedWrites and DenyDDL
+var ErrStatementDenied = errors.New("instrumentedsql: statement denied")
+
+// Guard decides whether a query may be sent to the parent driver, returning an error rejects it, see WithGuard.
+// Guards are called for prepares and for queries executed on the connection.
+type Guard func(ctx context.Context, op Op, query string) error
+
+// guardHook runs a Guard as the Before hook of the operations submitting a query
+type guardHook struct {
+	guard Guard
+}
+
+func (h guardHook) Before(ctx context.Context, op Op, query string, args []driver.NamedValue) (context.Context, error) {
+	if !submitsQuery(op) {
+		return ctx, nil
+	}
+
+	return ctx, h.guard(ctx, op, query)
+}
+
+func (h guardHook) After(ctx context.Context, op Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration) {
+}
+
+// DenyUnboundedWrites is a Guard rejecting UPDATE and DELETE statements without a WHERE clause
+func DenyUnboundedWrites(ctx context.Context, op Op, query string) error {
+	info := parseStatement(query)
+	if info.verb != statementUpdate && info.verb != statementDelete {
+		return nil
+	}
+	if hasTopLevelKeyword(query, "WHERE") {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s without a WHERE clause", ErrStatementDenied, info.verb)
+}
+
+// DenyDDL is a Guard rejecting DDL statements unless their context was returned by AllowDDL
+func DenyDDL(ctx context.Context, op Op, query string) error {
+	if parseStatement(query).verb != statementDDL {
+		return nil
+	}
+	if allowed, _ := ctx.Value(allowDDLKey).(bool); allowed {
+		return nil
+	}
+
+	return fmt.Errorf("%w: DDL outside of a migration", ErrStatementDenied)
+}
+
+// AllowDDL returns a copy of ctx for which DenyDDL accepts DDL statements, for use by migrations
+func AllowDDL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowDDLKey, true)
+}
+
+// DenyWrites is a Guard rejecting the statements that may write, which are the ones QueryAccess does not recognize as reads
+func DenyWrites(ctx context.Context, op Op, query string) error {
+	if QueryAccess(query) != AccessWrite {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s on a read-only database", ErrStatementDenied, parseStatement(query).verb)
+}
+
+// readOnlyMode is what WithReadOnlyGuard does with the statements that may write
+type readOnlyMode int
+
+const (
+	readOnlyOff readOnlyMode = iota
+	readOnlyLog
+	readOnlyEnforce
+)
+
+// checkReadOnly reports the statement the operation sends to the parent driver if it may write, see WithReadOnlyGuard,
+// and returns the error of DenyWrites if the guard is enforced. Copies are checked too, as CopyFrom sends rows
+// without preparing a statement.
+func (c *opCall) checkReadOnly() error {
+	if !submitsQuery(c.op) && c.op != OpSQLCopy {
+		return nil
+	}
+	err := DenyWrites(c.ctx, c.op, c.parentQuery)
+	if err == nil {
+		return nil
+	}
+
+	c.setLabel("read_only_violation", "true")
+	c.events.Log(c.routeContext(), "sql-read-only-violation", "op", c.opName(c.op), "query", c.shownQuery(c.parentQuery), "caller", caller(),
+		"enforced", c.readOnly == readOnlyEnforce)
+	if c.readOnly == readOnlyEnforce {
+		return err
+	}
+
+	return nil
+}
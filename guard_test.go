@@ -0,0 +1,116 @@
+package instrumentedsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestDenyUnboundedWrites(t *testing.T) {
+	tests := []struct {
+		query  string
+		denied bool
+	}{
+		{"DELETE FROM users", true},
+		{"delete from users -- where id = 1", true},
+		{"DELETE FROM users WHERE id = ?", false},
+		{"UPDATE users SET name = 'where'", true},
+		{"UPDATE users SET n = (SELECT max(n) FROM b WHERE b.id = 1)", true},
+		{"UPDATE users SET n = 1 WHERE id = $1", false},
+		{"WITH r AS (SELECT id FROM a WHERE x) DELETE FROM b", true},
+		{"SELECT * FROM users", false},
+	}
+
+	for _, test := range tests {
+		err := DenyUnboundedWrites(context.Background(), OpSQLConnExec, test.query)
+		if denied := errors.Is(err, ErrStatementDenied); denied != test.denied {
+			t.Errorf("DenyUnboundedWrites(%q) = %v, want denied %v", test.query, err, test.denied)
+		}
+	}
+}
+
+func TestDenyDDL(t *testing.T) {
+	ctx := context.Background()
+	if err := DenyDDL(ctx, OpSQLConnExec, "DROP TABLE users"); !errors.Is(err, ErrStatementDenied) {
+		t.Errorf("DenyDDL(DROP TABLE) = %v, want ErrStatementDenied", err)
+	}
+	if err := DenyDDL(AllowDDL(ctx), OpSQLConnExec, "DROP TABLE users"); err != nil {
+		t.Errorf("DenyDDL(DROP TABLE) with AllowDDL = %v, want nil", err)
+	}
+	if err := DenyDDL(ctx, OpSQLConnQuery, "SELECT 1"); err != nil {
+		t.Errorf("DenyDDL(SELECT) = %v, want nil", err)
+	}
+}
+
+func TestReadOnlyGuard(t *testing.T) {
+	for _, enforce := range []bool{false, true} {
+		logger := instrumentedsqltest.NewLogger()
+		db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithReadOnlyGuard(enforce)), "")
+		ctx := context.Background()
+
+		rows, err := db.QueryContext(ctx, "SELECT n FROM t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+		_, err = db.ExecContext(ctx, "UPDATE t SET n = 1")
+		if denied := errors.Is(err, ErrStatementDenied); denied != enforce {
+			t.Errorf("enforce %v: UPDATE returned %v", enforce, err)
+		}
+
+		warnings := logger.Find("sql-read-only-violation")
+		if len(warnings) != 1 || warnings[0].Query != "UPDATE t SET n = 1" || warnings[0].Labels["enforced"] != enforce {
+			t.Errorf("enforce %v: logged %+v, want a single warning for the UPDATE", enforce, warnings)
+		}
+	}
+}
+
+func TestReadOnlyGuardCopy(t *testing.T) {
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithReadOnlyGuard(true)), "")
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	copied := false
+	err = conn.Raw(func(driverConn interface{}) error {
+		return CopyFrom(ctx, driverConn, "users", func(ctx context.Context, parent interface{}) (int64, int64, error) {
+			copied = true
+			return 1, 10, nil
+		})
+	})
+	if !errors.Is(err, ErrStatementDenied) || copied {
+		t.Errorf("CopyFrom() = %v, copied %v, want the copy denied", err, copied)
+	}
+}
+
+// lockingRewriter makes the SELECTs it rewrites lock the rows they read
+type lockingRewriter struct {
+	schemaRewriter
+}
+
+func (lockingRewriter) RewriteQuery(ctx context.Context, op Op, query string) string {
+	return query + " FOR UPDATE"
+}
+
+func TestReadOnlyGuardRewrittenQuery(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	parent := &fakeDriver{}
+	db := openBenchDB(t, WrapDriver(parent, WithLogger(logger), WithHooks(lockingRewriter{}), WithReadOnlyGuard(true)), "")
+
+	// The query sent to the parent driver is checked, not the one passed to database/sql
+	if _, err := db.Query("SELECT n FROM t"); !errors.Is(err, ErrStatementDenied) {
+		t.Errorf("Query() = %v, want the locking read denied", err)
+	}
+	if sent := parent.sentQueries(); len(sent) != 0 {
+		t.Errorf("sent %q, want nothing", sent)
+	}
+	warnings := logger.Find("sql-read-only-violation")
+	if len(warnings) != 1 || warnings[0].Query != "SELECT n FROM t FOR UPDATE" {
+		t.Errorf("logged %+v, want a single warning for the locking read", warnings)
+	}
+}
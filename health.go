@@ -0,0 +1,49 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Checker checks that a database is reachable and answering queries, for health endpoints.
+// The operations it runs are labeled health_check when the database uses a wrapped driver, so that they can be told apart.
+type Checker struct {
+	// DB is the database to check
+	DB *sql.DB
+	// Query is run after pinging the database if not empty, such as SELECT 1, the rows it returns are discarded
+	Query string
+	// Timeout bounds the whole check if not zero, on top of the deadline of the context passed to Check
+	Timeout time.Duration
+}
+
+// Check pings the database then runs the validation query, if any, it returns the first error encountered
+func (c *Checker) Check(ctx context.Context) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	ctx = Labeled(ctx, map[string]string{"health_check": "true"})
+
+	if err := c.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	if c.Query == "" {
+		return nil
+	}
+
+	rows, err := c.DB.QueryContext(Named(ctx, "health-check"), c.Query)
+	if err != nil {
+		return fmt.Errorf("validation query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("validation query: %w", err)
+	}
+
+	return rows.Close()
+}
@@ -0,0 +1,32 @@
+package instrumentedsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestChecker(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	parent := &fakeDriver{rows: 1}
+	checker := &Checker{DB: openBenchDB(t, WrapDriver(parent, WithLogger(logger)), ""), Query: "SELECT 1", Timeout: time.Second}
+
+	if err := checker.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	logger.AssertNames(t, string(OpSQLConnOpen), string(OpSQLPing), string(OpSQLConnQuery))
+	for _, op := range logger.Ops()[1:] {
+		if op.Labels["health_check"] != "true" {
+			t.Errorf("%s recorded with labels %v", op.Name, op.Labels)
+		}
+	}
+
+	unreachable := errors.New("unreachable")
+	parent.pingErr = unreachable
+	if err := checker.Check(context.Background()); !errors.Is(err, unreachable) {
+		t.Errorf("Check() = %v, want the ping error", err)
+	}
+}
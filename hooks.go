@@ -0,0 +1,105 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// Hooks lets users run their own code around the operations of the wrapped driver, see WithHooks.
+// Hooks run for every operation that calls the parent driver, whether it is instrumented or not.
+// QueryAccess tells hooks whether a query reads or writes.
+type Hooks interface {
+	// Before is called before the parent driver is, the returned context is used for the rest of the operation.
+	// Returning an error aborts the operation with that error, the hooks after this one are not called then.
+	Before(ctx context.Context, op Op, query string, args []driver.NamedValue) (context.Context, error)
+	// After is called once the operation is over, for every hook whose Before was called successfully.
+	// result is the driver.Result or driver.Rows returned by the parent driver, if any, the duration of queries includes fetching their rows.
+	After(ctx context.Context, op Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration)
+}
+
+// QueryRewriter can be implemented by Hooks to change the query passed to the parent driver, for example to add index hints
+// or qualify tables with the schema of a tenant. RewriteQuery is called after Before for prepares and for queries executed
+// on the connection, prepared statements run the query they were prepared with.
+// The original query is the one recorded and passed to the hooks, the rewritten one is recorded as rewritten_query.
+type QueryRewriter interface {
+	RewriteQuery(ctx context.Context, op Op, query string) string
+}
+
+// before prepares the operation to call the parent driver, running the Before hooks, and returns the context to run it with
+func (c *opCall) before() (context.Context, error) {
+	if err := c.spend(); err != nil {
+		return nil, err
+	}
+	if c.profilerLabels {
+		c.setProfilerLabels()
+	}
+	if c.runtimeTrace {
+		c.startTraceRegion()
+	}
+	if len(c.hooks) > 0 {
+		if err := c.runHooks(); err != nil {
+			return nil, err
+		}
+	}
+	// The guard checks the query as rewritten by the hooks
+	if c.readOnly != readOnlyOff {
+		if err := c.checkReadOnly(); err != nil {
+			return nil, err
+		}
+	}
+	if c.querySlots != nil && isStatementOp(c.op) {
+		if err := c.acquireSlot(); err != nil {
+			return nil, err
+		}
+	}
+	if c.phaseTimings {
+		c.phases.driverStart = time.Now()
+	}
+
+	return c.ctx, nil
+}
+
+// runHooks runs the Before hooks of the operation, updating its context
+func (c *opCall) runHooks() error {
+	ctx := c.ctx
+	if ctx == nil {
+		// The legacy driver methods have no context
+		ctx = context.Background()
+	}
+	ctx = context.WithValue(ctx, connIDKey, c.conn.id)
+	c.ctx = ctx
+
+	for _, h := range c.hooks {
+		var err error
+		ctx, err = h.Before(ctx, c.op, c.query, c.args)
+		if err != nil {
+			return err
+		}
+		c.ctx = ctx
+		c.hooksRun++
+
+		if rw, ok := h.(QueryRewriter); ok && submitsQuery(c.op) {
+			c.parentQuery = rw.RewriteQuery(ctx, c.op, c.parentQuery)
+		}
+	}
+
+	return nil
+}
+
+// after runs the After hooks of the hooks whose Before ran, in reverse order
+func (c *opCall) after(err error, duration time.Duration) {
+	for n := c.hooksRun - 1; n >= 0; n-- {
+		c.hooks[n].After(c.ctx, c.op, c.query, c.args, c.result, err, duration)
+	}
+}
+
+// submitsQuery reports whether op hands a new query to the parent driver, as opposed to running a prepared statement
+func submitsQuery(op Op) bool {
+	switch op {
+	case OpSQLPrepare, OpSQLConnExec, OpSQLConnQuery:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,244 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+type hookKey struct{}
+
+// recordingHook records the calls to its Before and After in calls, shared by the hooks of a test
+type recordingHook struct {
+	name      string
+	beforeErr error
+
+	mu    *sync.Mutex
+	calls *[]string
+}
+
+func (h recordingHook) record(call string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	*h.calls = append(*h.calls, call)
+}
+
+func (h recordingHook) Before(ctx context.Context, op Op, query string, args []driver.NamedValue) (context.Context, error) {
+	if op != OpSQLConnExec {
+		return ctx, nil
+	}
+	h.record("before " + h.name)
+	if h.beforeErr != nil {
+		return nil, h.beforeErr
+	}
+
+	return context.WithValue(ctx, hookKey{}, h.name), nil
+}
+
+func (h recordingHook) After(ctx context.Context, op Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration) {
+	if op != OpSQLConnExec {
+		return
+	}
+	last, _ := ctx.Value(hookKey{}).(string)
+	_, hasConnID := ConnID(ctx)
+	h.record(fmt.Sprintf("after %s ctx=%s conn_id=%t", h.name, last, hasConnID))
+}
+
+func TestHooks(t *testing.T) {
+	refused := errors.New("refused")
+	cases := []struct {
+		name      string
+		beforeErr map[string]error
+		wantErr   error
+		want      []string
+	}{
+		{
+			name: "before in order and after in reverse",
+			want: []string{
+				"before first", "before second", "before third",
+				"after third ctx=third conn_id=true", "after second ctx=third conn_id=true", "after first ctx=third conn_id=true",
+			},
+		},
+		{
+			name:      "before error aborts",
+			beforeErr: map[string]error{"second": refused},
+			wantErr:   refused,
+			want:      []string{"before first", "before second", "after first ctx=first conn_id=true"},
+		},
+		{
+			name:      "first before error runs no after",
+			beforeErr: map[string]error{"first": refused},
+			wantErr:   refused,
+			want:      []string{"before first"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mu    sync.Mutex
+				calls []string
+			)
+			var hooks []Hooks
+			for _, name := range []string{"first", "second", "third"} {
+				hooks = append(hooks, recordingHook{name: name, beforeErr: tc.beforeErr[name], mu: &mu, calls: &calls})
+			}
+			parent := &fakeDriver{}
+			db := openBenchDB(t, WrapDriver(parent, WithHooks(hooks...)), "")
+
+			_, err := db.ExecContext(context.Background(), "UPDATE t SET a = 1")
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("got error %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(calls, tc.want) {
+				t.Errorf("got calls %q, want %q", calls, tc.want)
+			}
+			sent := 0
+			if tc.wantErr == nil {
+				sent = 1
+			}
+			if n := len(parent.sentQueries()); n != sent {
+				t.Errorf("sent %d queries to the parent driver, want %d", n, sent)
+			}
+		})
+	}
+}
+
+func TestQueryRewriter(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		rewritten = map[string][]interface{}{}
+	)
+	logger := LoggerFunc(func(ctx context.Context, msg string, keyvals ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		for n := 0; n+1 < len(keyvals); n += 2 {
+			if keyvals[n] == "rewritten_query" {
+				rewritten[msg] = append(rewritten[msg], keyvals[n+1])
+			}
+		}
+	})
+	parent := &fakeDriver{}
+	db := openBenchDB(t, WrapDriver(parent, WithLogger(logger), WithHooks(schemaRewriter{})), "")
+
+	if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := db.Prepare("SELECT a FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	want := []string{"UPDATE tenant1.t SET a = 1", "SELECT a FROM tenant1.t"}
+	if sent := parent.sentQueries(); !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	wantRewritten := map[string][]interface{}{
+		string(OpSQLConnExec): {"UPDATE tenant1.t SET a = 1"},
+		string(OpSQLPrepare):  {"SELECT a FROM tenant1.t"},
+	}
+	if !reflect.DeepEqual(rewritten, wantRewritten) {
+		t.Errorf("recorded rewritten_query %q, want %q", rewritten, wantRewritten)
+	}
+}
+
+func TestQueryRewriterSampledOut(t *testing.T) {
+	var rewritten []interface{}
+	logger := LoggerFunc(func(ctx context.Context, msg string, keyvals ...interface{}) {
+		for n := 0; n+1 < len(keyvals); n += 2 {
+			if keyvals[n] == "rewritten_query" {
+				rewritten = append(rewritten, keyvals[n+1])
+			}
+		}
+	})
+	parent := &fakeDriver{execErr: errors.New("deadlock")}
+	conn, err := WrapDriver(parent, WithLogger(logger), WithHooks(schemaRewriter{}), WithSampler(func(ctx context.Context, op Op, query string) bool {
+		return false
+	})).Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Failing operations left out by the sampler are still logged, with the query sent recorded once
+	if _, err := conn.(driver.ExecerContext).ExecContext(context.Background(), "UPDATE t SET a = 1", nil); err == nil {
+		t.Fatal("got no error")
+	}
+	if want := []interface{}{"UPDATE tenant1.t SET a = 1"}; !reflect.DeepEqual(rewritten, want) {
+		t.Errorf("recorded rewritten_query %q, want %q", rewritten, want)
+	}
+}
+
+// connIDHook records the connection IDs of the contexts passed to its Before
+type connIDHook struct {
+	mu  *sync.Mutex
+	ids *[]uint64
+}
+
+func (h connIDHook) Before(ctx context.Context, op Op, query string, args []driver.NamedValue) (context.Context, error) {
+	if op == OpSQLConnExec {
+		if id, ok := ConnID(ctx); ok {
+			h.mu.Lock()
+			*h.ids = append(*h.ids, id)
+			h.mu.Unlock()
+		}
+	}
+	return ctx, nil
+}
+
+func (connIDHook) After(ctx context.Context, op Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration) {
+}
+
+func TestConnID(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		ids []uint64
+	)
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithHooks(connIDHook{mu: &mu, ids: &ids})), "")
+	db.SetMaxOpenConns(2)
+
+	// Two connections are open while the first transaction is in progress
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("UPDATE t SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE t SET a = 2"); err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+
+	var labels []uint64
+	for _, op := range logger.Find(string(OpSQLConnExec)) {
+		id, err := strconv.ParseUint(op.Labels["conn_id"].(string), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels = append(labels, id)
+	}
+	if len(ids) != 2 || ids[0] == ids[1] || !reflect.DeepEqual(ids, labels) {
+		t.Errorf("hooks got connection IDs %v, want the conn_id labels %v of two connections", ids, labels)
+	}
+
+	if _, ok := ConnID(context.Background()); ok {
+		t.Error("got a connection ID from a context without one")
+	}
+}
@@ -0,0 +1,417 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/away-team/go-tracer/tracer"
+)
+
+// ErrorFinisher can be implemented by spans returned from the tracer to record the outcome of an operation natively,
+// for example as an error status, err is nil for successful operations.
+// Spans that don't implement it get error and err labels for failed operations before being finished.
+type ErrorFinisher interface {
+	FinishWithError(err error)
+}
+
+// EventRecorder can be implemented by spans returned from the tracer to record events within them, such as the first row
+// of a query being received. Spans that don't implement it get a label per event instead, holding the time elapsed
+// since the start of the operation, which log entries always get.
+type EventRecorder interface {
+	RecordEvent(name string)
+}
+
+// opCall tracks the instrumentation of a single operation, from startOp until finish
+type opCall struct {
+	*opts
+	ctx   context.Context
+	conn  *wrappedConn
+	op    Op
+	query string
+	// shown is the query as recorded in spans and logs, see WithSecretScanning
+	shown   string
+	args    []driver.NamedValue
+	span    tracer.Span
+	start   time.Time
+	keyvals []interface{}
+
+	// result is the driver.Result or driver.Rows returned by the parent, for hooks
+	result interface{}
+	// hooksRun is the number of hooks whose Before was run
+	hooksRun int
+	// parentQuery is the query passed to the parent driver, it differs from query if a QueryRewriter changed it
+	parentQuery string
+	// caller is the code running the operation, see WithCallerAttribution
+	caller string
+	// queryFingerprint caches the fingerprint of the query, see fingerprint
+	queryFingerprint string
+	// unlabeledCtx is the context of the operation before profiler labels were added, see WithProfilerLabels
+	unlabeledCtx context.Context
+	// traceRegion is the runtime/trace region of the operation, see WithRuntimeTrace
+	traceRegion *trace.Region
+	// holdsSlot is set while the operation holds one of the slots limiting concurrent queries, see WithMaxConcurrentQueries
+	holdsSlot bool
+	// budget is the budget the query is counted against, see Budgeted
+	budget *budget
+	// tenant is the tenant the operation is run for, see WithTenantExtractor
+	tenant string
+	// txExecutions is the number of times the query was run with the same args in the transaction in progress,
+	// see WithDuplicateQueryDetection
+	txExecutions int
+	// phases are the times at which the operation went from one phase to the next, see WithPhaseTimings
+	phases phases
+	// firstRow is the time from the start of a query to its first row being received, 0 until then
+	firstRow time.Duration
+	// finished is set once finish was called, it is called again when recovering from a panic of the parent driver
+	finished bool
+
+	// disabled is set for operations that are not instrumented, all methods are no-ops then
+	disabled bool
+	// sampledOut is set for operations left out by the sampler, they have no span
+	// and are only logged if they fail or are slow
+	sampledOut bool
+	// batch is set for the queries aggregated in a batch, they have no span and are not logged, see BeginBatch
+	batch *batch
+}
+
+// startOp creates the span for op and prepares its log entry. The span is a child of parent if not nil,
+// otherwise of the transaction in progress on the connection or of the span in ctx.
+// The query is recorded when not empty, the args when there are any.
+func (c *wrappedConn) startOp(ctx context.Context, parent tracer.Span, op Op, query string, args []driver.NamedValue) *opCall {
+	call := &opCall{opts: c.opts, ctx: ctx, conn: c, op: op, query: query, shown: query, parentQuery: query, args: args, start: time.Now()}
+
+	mode := contextMode(ctx)
+	if !c.instrumentationEnabled() || mode == modeSkip || (mode != modeForce && !c.opEnabled(op)) {
+		call.disabled = true
+		return call
+	}
+	if c.secretScanning {
+		call.shown = c.shownQuery(query)
+	}
+	if c.missingTraceContext != nil {
+		call.checkTraceContext()
+	}
+	if c.tenants != nil {
+		call.tenant = c.tenants.tenant(ctx)
+	}
+	if c.nPlusOneThreshold > 0 {
+		call.detectNPlusOne()
+	}
+	if c.txQueries != nil && isStatementOp(op) {
+		call.detectDuplicate()
+	}
+
+	if isStatementOp(op) {
+		if b := contextBatch(ctx); b != nil {
+			call.batch = b
+			return call
+		}
+	}
+
+	if c.callerAttribution {
+		call.caller = caller()
+	}
+
+	if mode != modeForce && (!call.sampled() || !call.detailed()) {
+		call.sampledOut = true
+		if c.deadlineWarning > 0 {
+			call.checkDeadline()
+		}
+		return call
+	}
+
+	name := c.opName(op)
+	if query != "" {
+		name = "(" + name + ") " + call.shown
+	}
+	if isStatementOp(op) {
+		if named := contextName(ctx); named != "" {
+			name = named
+		}
+	}
+
+	if parent == nil {
+		parent = c.txParentSpan()
+	}
+	orphan := false
+	if parent == nil {
+		spanCtx := ctx
+		if c.orphanSpans {
+			if spanCtx == nil {
+				spanCtx = context.Background()
+			}
+			orphan = ctx == nil || c.missingTraceContext != nil && c.missingTraceContext.missing(call)
+		}
+		parent = c.GetSpan(spanCtx)
+	}
+	// Room for the labels usually recorded, along with the duration and error of the operation
+	call.keyvals = make([]interface{}, 0, 16)
+	call.span = parent.NewChild(name)
+	call.span.SetLabel("component", "database/sql")
+	call.recordOp()
+	if orphan {
+		call.setLabel("orphan", "true")
+	}
+	if c.deadlineWarning > 0 {
+		call.checkDeadline()
+	}
+
+	return call
+}
+
+// sampled reports whether the sampler, if any, keeps the operation
+func (c *opCall) sampled() bool {
+	sampler := c.currentSampler()
+	return sampler == nil || sampler(c.ctx, c.op, c.query)
+}
+
+// detailed reports whether the query of the operation gets full detail, see WithQueryAllowlist
+func (c *opCall) detailed() bool {
+	return c.queryDetail == nil || !isStatementOp(c.op) || c.queryDetail.detailed(c)
+}
+
+// recordOp records the labels describing the operation itself
+func (c *opCall) recordOp() {
+	if c.component != "" {
+		c.setLabel("component", c.component)
+	}
+	if c.dbName != "" {
+		c.setLabel("db", c.dbName)
+	}
+	if c.dbSystem != "" {
+		c.setLabel("db_system", c.dbSystem)
+	}
+	c.setLabel("conn_id", c.conn.idLabel)
+	if c.conn.dsnInfo != nil {
+		c.conn.dsnInfo.labels(c)
+	}
+	c.setLabel("conn_checkout", strconv.FormatInt(atomic.LoadInt64(&c.conn.checkouts), 10))
+	if c.caller != "" {
+		c.setLabel("caller", c.caller)
+	}
+	if c.contextAttributes != nil && c.ctx != nil {
+		c.setLabels(c.contextAttributes(c.ctx))
+	}
+	if c.tenant != "" {
+		c.setLabel("tenant", c.tenant)
+	}
+	if c.txExecutions > 1 {
+		c.setLabel("duplicate_in_tx", strconv.Itoa(c.txExecutions))
+	}
+	if labels := contextLabels(c.ctx); labels != nil {
+		c.setLabels(labels)
+	}
+	if isStatementOp(c.op) {
+		if name := contextName(c.ctx); name != "" {
+			c.setLabel("name", name)
+		}
+	}
+
+	if c.query != "" {
+		c.setLabel("query", c.shown)
+		if c.tagStatements || c.router != nil {
+			info := parseStatement(c.query)
+			access := info.access(c.query)
+			if c.tagStatements {
+				c.setLabel("statement", info.verb)
+				c.setLabel("access", string(access))
+				if info.table != "" {
+					c.setLabel("table", info.table)
+				}
+			}
+			if c.router != nil {
+				c.setLabel("route", c.router(c.routeContext(), access, c.query))
+			}
+		}
+	}
+	if len(c.args) > 0 {
+		if c.argsSummary {
+			c.setLabel("arg_count", strconv.Itoa(len(c.args)))
+			c.setLabel("args_size", strconv.FormatInt(argsSize(c.args), 10))
+		} else {
+			c.recordArgs()
+		}
+	}
+}
+
+// routeContext returns the context of the operation for the router, the legacy driver methods have none
+func (c *opCall) routeContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
+// fingerprint returns the fingerprint of the query of the operation
+func (c *opCall) fingerprint() string {
+	if c.queryFingerprint == "" {
+		c.queryFingerprint = fingerprint(c.query)
+	}
+
+	return c.queryFingerprint
+}
+
+// setLabel records a key/value pair both on the span and in the log entry of the operation
+func (c *opCall) setLabel(key, value string) {
+	if c.disabled {
+		return
+	}
+	if c.span != nil {
+		c.span.SetLabel(key, value)
+	}
+	c.keyvals = append(c.keyvals, key, value)
+}
+
+// event records that the named event happened during the operation, see EventRecorder
+func (c *opCall) event(name string) {
+	if c.disabled {
+		return
+	}
+
+	elapsed := time.Since(c.start)
+	if recorder, ok := c.span.(EventRecorder); ok {
+		recorder.RecordEvent(name)
+		c.keyvals = append(c.keyvals, name, elapsed.String())
+		return
+	}
+	c.setLabel(name, elapsed.String())
+}
+
+// setLabels records labels in the order of their keys, so that log entries are consistent
+func (c *opCall) setLabels(labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		c.setLabel(k, labels[k])
+	}
+}
+
+// finish records the outcome of the operation, finishes its span and writes its log entry
+func (c *opCall) finish(err error) {
+	if c.finished {
+		return
+	}
+	c.finished = true
+
+	duration := time.Since(c.start)
+	if c.budget != nil {
+		atomic.AddInt64(&c.budget.duration, int64(duration))
+	}
+	c.after(err, duration)
+	c.resetProfilerLabels()
+	c.endTraceRegion()
+	c.releaseSlot()
+
+	if isStatementOp(c.op) && err != driver.ErrSkip {
+		c.conn.holdQuery(c.shown)
+		atomic.AddInt64(&c.conn.queries, 1)
+	}
+	failed := c.failed(err)
+	if failed {
+		atomic.AddInt64(&c.conn.errors, 1)
+	}
+	if c.auditWriter != nil {
+		// Statements are audited whether they are instrumented or not
+		c.audit(err, duration)
+	}
+
+	if c.disabled {
+		return
+	}
+
+	threshold := c.currentSlowQueryThreshold()
+	slow := threshold > 0 && duration >= threshold
+
+	if (c.stats != nil || c.slowQueryReport != nil) && isStatementOp(c.op) {
+		x := execution{tenant: c.tenant, fingerprint: c.fingerprint(), duration: duration, failed: failed, firstRow: c.firstRow}
+		if ider, ok := c.span.(TraceIDer); ok {
+			x.traceID = ider.TraceID()
+		}
+		if c.stats != nil {
+			c.stats.record(x)
+		}
+		if c.slowQueryReport != nil {
+			c.slowQueryReport.record(x)
+		}
+	}
+
+	if c.batch != nil {
+		c.batch.record(c, duration, failed, err)
+		return
+	}
+
+	if c.sampledOut {
+		if !failed && !slow {
+			return
+		}
+		// Operations left out by the sampler are still logged when they fail or are slow, without their labels set so far
+		c.keyvals = c.keyvals[:0]
+		c.recordOp()
+	}
+
+	// The query is rewritten by the hooks once the operation is started
+	if c.parentQuery != c.query {
+		c.setLabel("rewritten_query", c.shownQuery(c.parentQuery))
+	}
+	c.recordCancellation(err)
+	if c.phaseTimings {
+		c.recordPhases(c.start.Add(duration))
+	}
+	if c.stackThreshold > 0 && (failed || duration >= c.stackThreshold) {
+		c.setLabel("stack", callerStack())
+	}
+
+	spanErr := err
+	if !failed {
+		spanErr = nil
+	}
+	if spanErr != nil {
+		c.recordServerError(spanErr)
+		if c.classifyErr != nil {
+			c.setLabel("err_category", string(c.classifyErr(spanErr)))
+		}
+	}
+	if finisher, ok := c.span.(ErrorFinisher); ok {
+		finisher.FinishWithError(spanErr)
+	} else if c.span != nil {
+		if spanErr != nil {
+			c.span.SetLabel("error", "true")
+			c.span.SetLabel("err", fmt.Sprint(spanErr))
+		}
+		c.span.Finish()
+	}
+
+	if slow && c.slowQueryFunc != nil {
+		c.slowQueryFunc(c.ctx, c.query, c.args, duration)
+	}
+	if c.explain != nil && c.span != nil {
+		c.explain.maybeExplain(c, duration)
+	}
+	if c.eventSink != nil {
+		c.writeEvent(spanErr, duration)
+	}
+	c.Log(c.ctx, c.opName(c.op), append(c.keyvals, "duration", duration, "err", err)...)
+}
+
+// failed reports whether err should be recorded as a failure of the operation, see WithErrorFilter
+func (o *opts) failed(err error) bool {
+	if err == nil || err == driver.ErrSkip {
+		return false
+	}
+	if o.ignoreErr != nil && o.ignoreErr(err) {
+		return false
+	}
+
+	return true
+}
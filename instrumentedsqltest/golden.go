@@ -0,0 +1,103 @@
+package instrumentedsqltest
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("instrumentedsqltest.update", false, "write the traces checked by AssertGolden to their golden files")
+
+// volatileLabels are the labels whose values change from one run to the next, they are left out of snapshots
+var volatileLabels = map[string]bool{
+	"caller":             true,
+	"close_duration":     true,
+	"conn_checkout":      true,
+	"conn_lifetime":      true,
+	"deadline_remaining": true,
+	"fetch_duration":     true,
+	"first_row":          true,
+	"plan":               true,
+	"queue_wait":         true,
+	"rows_closed":        true,
+	"stack":              true,
+	"stmt_lifetime":      true,
+}
+
+// Snapshot returns the spans recorded so far in a canonical form: each span on its own line, in the order it was created,
+// indented below its parent and followed by its labels sorted by key, then its events prefixed by *. Labels whose values change from one run to the next,
+// such as durations and stacks, are left out along with the labels in ignored.
+func (t *Tracer) Snapshot(ignored ...string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	skip := make(map[string]bool, len(ignored))
+	for _, k := range ignored {
+		skip[k] = true
+	}
+	children := map[*span][]*span{}
+	for _, s := range t.spans {
+		children[s.parent] = append(children[s.parent], s)
+	}
+
+	var b strings.Builder
+	var write func(parent *span, depth int)
+	write = func(parent *span, depth int) {
+		for _, s := range children[parent] {
+			indent := strings.Repeat("  ", depth)
+			b.WriteString(indent + s.name)
+			if !s.done {
+				b.WriteString(" (unfinished)")
+			}
+			b.WriteString("\n")
+
+			keys := make([]string, 0, len(s.labels))
+			for k := range s.labels {
+				if !volatileLabels[k] && !skip[k] {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				b.WriteString(indent + "  - " + k + ": " + s.labels[k] + "\n")
+			}
+			for _, event := range s.events {
+				b.WriteString(indent + "  * " + event + "\n")
+			}
+
+			write(s, depth+1)
+		}
+	}
+	write(nil, 0)
+
+	return b.String()
+}
+
+// AssertGolden fails the test unless the snapshot of the spans recorded so far matches the golden file at path,
+// see Snapshot. Run the test with -instrumentedsqltest.update to write the snapshot to the file instead,
+// so that changes to the shape of the instrumentation are reviewed along with the golden file.
+func (t *Tracer) AssertGolden(tb testing.TB, path string, ignored ...string) {
+	tb.Helper()
+
+	got := t.Snapshot(ignored...)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatalf("reading golden trace, run with -instrumentedsqltest.update to create it: %v", err)
+	}
+	if got != string(want) {
+		tb.Errorf("trace differs from %s, run with -instrumentedsqltest.update to accept it\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
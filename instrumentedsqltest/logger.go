@@ -0,0 +1,123 @@
+// Package instrumentedsqltest provides a Logger and a Tracer recording the operations instrumented by instrumentedsql,
+// so that tests can check what their code runs against the database and how it is instrumented.
+package instrumentedsqltest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Op is an operation recorded from its log entry
+type Op struct {
+	// Name is the name of the operation, such as sql-conn-query
+	Name  string
+	Query string
+	// Args are the args of the query as formatted by instrumentedsql
+	Args     string
+	Duration time.Duration
+	Err      error
+	// Labels are all the other key/value pairs of the log entry
+	Labels map[string]interface{}
+}
+
+// Logger is an instrumentedsql.Logger recording every log entry as an Op, it is safe for concurrent use
+type Logger struct {
+	mu  sync.Mutex
+	ops []Op
+}
+
+// NewLogger returns a Logger that has recorded nothing
+func NewLogger() *Logger {
+	return &Logger{}
+}
+
+// Log records the entry
+func (l *Logger) Log(ctx context.Context, msg string, keyvals ...interface{}) {
+	op := Op{Name: msg, Labels: map[string]interface{}{}}
+	for n := 0; n+1 < len(keyvals); n += 2 {
+		key := fmt.Sprint(keyvals[n])
+		value := keyvals[n+1]
+		switch key {
+		case "query":
+			op.Query, _ = value.(string)
+		case "args":
+			op.Args, _ = value.(string)
+		case "duration":
+			op.Duration, _ = value.(time.Duration)
+		case "err":
+			op.Err, _ = value.(error)
+		default:
+			op.Labels[key] = value
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ops = append(l.ops, op)
+}
+
+// Ops returns the operations recorded so far, in the order they were logged
+func (l *Logger) Ops() []Op {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Op(nil), l.ops...)
+}
+
+// Names returns the names of the operations recorded so far
+func (l *Logger) Names() []string {
+	ops := l.Ops()
+	names := make([]string, len(ops))
+	for n, op := range ops {
+		names[n] = op.Name
+	}
+
+	return names
+}
+
+// Find returns the operations recorded with the given name
+func (l *Logger) Find(name string) []Op {
+	var found []Op
+	for _, op := range l.Ops() {
+		if op.Name == name {
+			found = append(found, op)
+		}
+	}
+
+	return found
+}
+
+// Reset forgets the operations recorded so far
+func (l *Logger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ops = nil
+}
+
+// AssertNames fails the test unless the names of the operations recorded so far are names, in order
+func (l *Logger) AssertNames(t testing.TB, names ...string) {
+	t.Helper()
+
+	got := l.Names()
+	if fmt.Sprint(got) != fmt.Sprint(names) {
+		t.Errorf("recorded operations %v, want %v", got, names)
+	}
+}
+
+// AssertQuery fails the test unless an operation ran query, it returns the first one that did
+func (l *Logger) AssertQuery(t testing.TB, query string) Op {
+	t.Helper()
+
+	for _, op := range l.Ops() {
+		if op.Query == query {
+			return op
+		}
+	}
+	t.Errorf("no operation recorded for query %q", query)
+
+	return Op{}
+}
@@ -0,0 +1,67 @@
+package instrumentedsqltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	l := NewLogger()
+	err := errors.New("failed")
+	l.Log(context.Background(), "sql-conn-exec", "query", "UPDATE t SET a = 1", "table", "t", "duration", time.Second, "err", err)
+	l.Log(context.Background(), "sql-tx-commit", "duration", time.Millisecond, "err", nil)
+
+	l.AssertNames(t, "sql-conn-exec", "sql-tx-commit")
+	op := l.AssertQuery(t, "UPDATE t SET a = 1")
+	if op.Duration != time.Second || op.Err != err || op.Labels["table"] != "t" {
+		t.Errorf("recorded %+v", op)
+	}
+	if ops := l.Find("sql-tx-commit"); len(ops) != 1 || ops[0].Err != nil {
+		t.Errorf("Find(sql-tx-commit) = %+v", ops)
+	}
+
+	l.Reset()
+	l.AssertNames(t)
+}
+
+func TestTracer(t *testing.T) {
+	tr := NewTracer()
+
+	root := tr.GetSpan(context.Background()).NewChild("sql-tx")
+	child := root.NewChild("sql-tx-commit")
+	child.SetLabel("db", "orders")
+	child.Finish()
+
+	ctx := tr.ContextWithSpan(context.Background(), "request")
+	tr.GetSpan(ctx).NewChild("sql-ping")
+
+	spans := tr.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("recorded %d spans, want 4: %+v", len(spans), spans)
+	}
+	if spans[0].Name != "sql-tx" || spans[0].Parent != "" || spans[0].Finished {
+		t.Errorf("first span %+v", spans[0])
+	}
+	if spans[1].Parent != "sql-tx" || spans[1].Labels["db"] != "orders" || !spans[1].Finished {
+		t.Errorf("second span %+v", spans[1])
+	}
+	if spans[3].Name != "sql-ping" || spans[3].Parent != "request" {
+		t.Errorf("span created from the context %+v", spans[3])
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tr := NewTracer()
+
+	tx := tr.GetSpan(context.Background()).NewChild("sql-tx")
+	exec := tx.NewChild("(sql-stmt-exec) INSERT INTO t VALUES (?)")
+	exec.SetLabel("query", "INSERT INTO t VALUES (?)")
+	exec.SetLabel("args", "{1}")
+	exec.SetLabel("stack", "main.go:12")
+	exec.Finish()
+	tx.NewChild("sql-tx-commit").Finish()
+
+	tr.AssertGolden(t, "testdata/snapshot.golden", "args")
+}
@@ -0,0 +1,130 @@
+package instrumentedsqltest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/away-team/go-tracer/tracer"
+)
+
+// RecordedSpan is a span created by instrumentedsql, as recorded by a Tracer
+type RecordedSpan struct {
+	Name string
+	// Parent is the name of the parent span, it is empty for spans created from a context without a span
+	Parent string
+	Labels map[string]string
+	// Events are the names of the events recorded in the span, in the order they happened
+	Events   []string
+	Finished bool
+}
+
+// Tracer is a tracer.Tracer recording the spans created from it, it is safe for concurrent use
+type Tracer struct {
+	mu    sync.Mutex
+	spans []*span
+}
+
+type span struct {
+	tracer *Tracer
+	parent *span
+	name   string
+	labels map[string]string
+	events []string
+	done   bool
+}
+
+type spanKey struct{}
+
+// NewTracer returns a Tracer that has recorded nothing
+func NewTracer() *Tracer {
+	return &Tracer{}
+}
+
+// ContextWithSpan returns a copy of ctx carrying a span named name, the spans created for operations run with it are its children
+func (t *Tracer) ContextWithSpan(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, spanKey{}, t.newSpan(nil, name))
+}
+
+// GetSpan returns the span carried by ctx, see ContextWithSpan, or a root span which is not recorded itself
+func (t *Tracer) GetSpan(ctx context.Context) tracer.Span {
+	if ctx != nil {
+		if s, ok := ctx.Value(spanKey{}).(*span); ok {
+			return s
+		}
+	}
+
+	return &span{tracer: t}
+}
+
+func (t *Tracer) newSpan(parent *span, name string) *span {
+	s := &span{tracer: t, parent: parent, name: name, labels: map[string]string{}}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, s)
+
+	return s
+}
+
+// Spans returns the spans recorded so far, in the order they were created
+func (t *Tracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spans := make([]RecordedSpan, len(t.spans))
+	for n, s := range t.spans {
+		spans[n] = RecordedSpan{Name: s.name, Labels: make(map[string]string, len(s.labels)), Events: append([]string(nil), s.events...), Finished: s.done}
+		if s.parent != nil {
+			spans[n].Parent = s.parent.name
+		}
+		for k, v := range s.labels {
+			spans[n].Labels[k] = v
+		}
+	}
+
+	return spans
+}
+
+// Reset forgets the spans recorded so far
+func (t *Tracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = nil
+}
+
+func (s *span) NewChild(name string) tracer.Span {
+	parent := s
+	if s.labels == nil {
+		// The unrecorded root span
+		parent = nil
+	}
+
+	return s.tracer.newSpan(parent, name)
+}
+
+func (s *span) SetLabel(key, value string) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	if s.labels != nil {
+		s.labels[key] = value
+	}
+}
+
+// RecordEvent records an event in the span, see instrumentedsql.EventRecorder
+func (s *span) RecordEvent(name string) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	if s.labels != nil {
+		s.events = append(s.events, name)
+	}
+}
+
+func (s *span) Finish() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	s.done = true
+}
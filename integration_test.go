@@ -0,0 +1,184 @@
+//go:build integration
+// +build integration
+
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+// integrationRows is the number of rows written and read back by the workload
+const integrationRows = 1000
+
+// integrationDB is a real database the workload runs against
+type integrationDB struct {
+	name   string
+	driver driver.Driver
+	dsn    string
+	// placeholder returns the placeholder of the nth arg of a query, starting at 1
+	placeholder func(n int) string
+	// slowQuery runs long enough to be canceled
+	slowQuery string
+}
+
+func integrationDBs(t *testing.T) []integrationDB {
+	dbs := []integrationDB{{
+		name:        "sqlite3",
+		driver:      &sqlite3.SQLiteDriver{},
+		dsn:         ":memory:",
+		placeholder: func(int) string { return "?" },
+		slowQuery:   "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c",
+	}}
+
+	// For example postgres://postgres@localhost/postgres?sslmode=disable
+	if dsn := os.Getenv("INSTRUMENTEDSQL_POSTGRES_DSN"); dsn != "" {
+		dbs = append(dbs, integrationDB{
+			name:        "pgx",
+			driver:      stdlib.GetDefaultDriver(),
+			dsn:         dsn,
+			placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+			slowQuery:   "SELECT pg_sleep(10)",
+		})
+	} else {
+		t.Log("INSTRUMENTEDSQL_POSTGRES_DSN is not set, skipping postgres")
+	}
+
+	return dbs
+}
+
+// TestIntegration runs a workload of prepared statements, transactions, large result sets and cancellations
+// against real drivers, to catch the wrapper hiding their interfaces or misreporting their operations
+func TestIntegration(t *testing.T) {
+	for _, idb := range integrationDBs(t) {
+		idb := idb
+		t.Run(idb.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			tr := instrumentedsqltest.NewTracer()
+			db := openBenchDB(t, WrapDriver(idb.driver, WithLogger(logger), WithTracer(tr)), idb.dsn)
+			ctx := context.Background()
+
+			// The database has a single connection, temporary tables are visible to the whole test and cleaned up with it
+			if _, err := db.ExecContext(ctx, "CREATE TEMPORARY TABLE instrumentedsql_it (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Prepared statement in a transaction
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			insert := "INSERT INTO instrumentedsql_it (id, name) VALUES (" + idb.placeholder(1) + ", " + idb.placeholder(2) + ")"
+			stmt, err := tx.PrepareContext(ctx, insert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for n := 0; n < integrationRows; n++ {
+				if _, err := stmt.ExecContext(ctx, n, "name-"+strconv.Itoa(n)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := stmt.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Large result set
+			rows, err := db.QueryContext(ctx, "SELECT id, name FROM instrumentedsql_it ORDER BY id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			read := 0
+			for rows.Next() {
+				var id int
+				var name string
+				if err := rows.Scan(&id, &name); err != nil {
+					t.Fatal(err)
+				}
+				if id != read || name != "name-"+strconv.Itoa(read) {
+					t.Fatalf("read row %d, %q, want %d", id, name, read)
+				}
+				read++
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			rows.Close()
+			if read != integrationRows {
+				t.Errorf("read %d rows, want %d", read, integrationRows)
+			}
+
+			// Cancellation
+			cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			var count int
+			if err := db.QueryRowContext(cancelCtx, idb.slowQuery).Scan(&count); err == nil {
+				t.Fatal("the slow query was not canceled")
+			}
+
+			assertIntegrationOps(t, logger, insert, idb.slowQuery)
+			assertIntegrationSpans(t, tr)
+		})
+	}
+}
+
+func assertIntegrationOps(t *testing.T, logger *instrumentedsqltest.Logger, insert, slowQuery string) {
+	t.Helper()
+
+	execs := 0
+	for _, op := range logger.Find(string(OpSQLStmtExec)) {
+		if op.Query != insert || op.Err != nil {
+			t.Errorf("statement exec %+v", op)
+		}
+		execs++
+	}
+	if execs != integrationRows {
+		t.Errorf("recorded %d statement execs, want %d", execs, integrationRows)
+	}
+	if commits := logger.Find(string(OpSQLTxCommit)); len(commits) != 1 || commits[0].Err != nil {
+		t.Errorf("recorded commits %+v, want a successful one", commits)
+	}
+
+	canceled := logger.AssertQuery(t, slowQuery)
+	if canceled.Err == nil || canceled.Labels["ctx_err"] != context.DeadlineExceeded.Error() {
+		t.Errorf("canceled query recorded as %+v", canceled)
+	}
+	for _, op := range logger.Ops() {
+		if op.Err != nil && op.Query != slowQuery && !errors.Is(op.Err, driver.ErrSkip) {
+			t.Errorf("%s failed: %v", op.Name, op.Err)
+		}
+	}
+}
+
+func assertIntegrationSpans(t *testing.T, tr *instrumentedsqltest.Tracer) {
+	t.Helper()
+
+	execs := 0
+	for _, span := range tr.Spans() {
+		if !span.Finished {
+			t.Errorf("span %q was not finished", span.Name)
+		}
+		if strings.HasPrefix(span.Name, "("+string(OpSQLStmtExec)+")") {
+			if span.Parent != string(OpSQLTx) {
+				t.Errorf("span %q has parent %q, want the transaction", span.Name, span.Parent)
+			}
+			execs++
+		}
+	}
+	if execs != integrationRows {
+		t.Errorf("recorded %d statement exec spans, want %d", execs, integrationRows)
+	}
+}
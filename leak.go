@@ -0,0 +1,48 @@
+package instrumentedsql
+
+import (
+	"context"
+	"time"
+)
+
+// leakDetector warns about rows or transactions still open after a duration, see WithRowsLeakDetection and WithTxLeakDetection
+type leakDetector struct {
+	after time.Duration
+	// stacks is set to record the stack of the goroutine that opened them
+	stacks bool
+}
+
+// watch logs msg along with keyvals unless the returned timer is stopped within the duration of the detector
+func (d *leakDetector) watch(ctx context.Context, l Logger, msg string, keyvals ...interface{}) *time.Timer {
+	if d.stacks {
+		keyvals = append(keyvals, "stack", callerStack())
+	}
+
+	start := time.Now()
+	return time.AfterFunc(d.after, func() {
+		l.Log(ctx, msg, append(keyvals, "age", time.Since(start))...)
+	})
+}
+
+// maxHeldQueries bounds the number of queries recorded for a transaction, see WithConnHoldThreshold
+const maxHeldQueries = 50
+
+// connHold tracks a transaction holding its connection, see WithConnHoldThreshold
+type connHold struct {
+	since   time.Time
+	queries []string
+}
+
+// holdQuery records a query run by the transaction in progress on the connection
+func (c *wrappedConn) holdQuery(query string) {
+	if c.hold != nil && len(c.hold.queries) < maxHeldQueries {
+		c.hold.queries = append(c.hold.queries, query)
+	}
+}
+
+// checkHold logs a sql-conn-held warning if the connection was held since the passed time for longer than the threshold
+func (c *wrappedConn) checkHold(ctx context.Context, since time.Time, queries []string) {
+	if held := time.Since(since); held >= c.connHoldThreshold {
+		c.events.Log(ctx, "sql-conn-held", "conn_id", c.id, "duration", held, "queries", queries)
+	}
+}
@@ -0,0 +1,108 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestRowsLeakDetection(t *testing.T) {
+	for _, leaked := range []bool{false, true} {
+		logger := instrumentedsqltest.NewLogger()
+		conn, err := WrapDriver(&fakeDriver{}, WithLogger(logger), WithRowsLeakDetection(5*time.Millisecond, false)).Open("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := conn.(driver.QueryerContext).QueryContext(context.Background(), "SELECT n FROM t", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !leaked {
+			rows.Close()
+		}
+		time.Sleep(30 * time.Millisecond)
+		if leaked {
+			rows.Close()
+		}
+
+		warnings := logger.Find("sql-rows-leak")
+		if leaked && (len(warnings) != 1 || warnings[0].Query != "SELECT n FROM t" || warnings[0].Labels["age"] == nil) {
+			t.Errorf("logged %+v, want a warning for the leaked rows", warnings)
+		}
+		if !leaked && len(warnings) != 0 {
+			t.Errorf("logged %+v for rows closed in time", warnings)
+		}
+	}
+}
+
+func TestTxLeakDetection(t *testing.T) {
+	for _, leaked := range []bool{false, true} {
+		logger := instrumentedsqltest.NewLogger()
+		conn, err := WrapDriver(&fakeDriver{}, WithLogger(logger), WithTxLeakDetection(5*time.Millisecond, true)).Open("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err := conn.(driver.ConnBeginTx).BeginTx(context.Background(), driver.TxOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !leaked {
+			tx.Commit()
+		}
+		time.Sleep(30 * time.Millisecond)
+		if leaked {
+			tx.Rollback()
+		}
+
+		warnings := logger.Find("sql-tx-leak")
+		if leaked && (len(warnings) != 1 || warnings[0].Labels["stack"] == nil) {
+			t.Errorf("logged %+v, want a warning with the stack of the leaked transaction", warnings)
+		}
+		if !leaked && len(warnings) != 0 {
+			t.Errorf("logged %+v for a transaction committed in time", warnings)
+		}
+	}
+}
+
+func TestConnHoldThreshold(t *testing.T) {
+	ctx := context.Background()
+	for _, threshold := range []time.Duration{time.Nanosecond, time.Hour} {
+		logger := instrumentedsqltest.NewLogger()
+		conn, err := WrapDriver(&fakeDriver{}, WithLogger(logger), WithConnHoldThreshold(threshold)).Open("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err := conn.(driver.ConnBeginTx).BeginTx(ctx, driver.TxOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < maxHeldQueries+10; n++ {
+			if _, err := conn.(driver.ExecerContext).ExecContext(ctx, "UPDATE t SET a = 1", nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		warnings := logger.Find("sql-conn-held")
+		if threshold == time.Hour {
+			if len(warnings) != 0 {
+				t.Errorf("logged %+v under the threshold", warnings)
+			}
+			continue
+		}
+		if len(warnings) != 1 {
+			t.Fatalf("logged %+v, want a single warning for the transaction", warnings)
+		}
+		if queries, _ := warnings[0].Labels["queries"].([]string); len(queries) != maxHeldQueries || queries[0] != "UPDATE t SET a = 1" {
+			t.Errorf("logged queries %+v, want the first %d", queries, maxHeldQueries)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package instrumentedsql
+
+import (
+	"context"
+	"time"
+)
+
+// acquireSlot takes one of the slots limiting the number of concurrent queries, see WithMaxConcurrentQueries.
+// When all of them are taken, the wait is instrumented as a sql-queue-wait operation.
+func (c *opCall) acquireSlot() error {
+	select {
+	case c.querySlots <- struct{}{}:
+		c.holdsSlot = true
+		return nil
+	default:
+	}
+
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	wait := c.conn.startOp(ctx, c.span, OpSQLQueueWait, "", nil)
+	select {
+	case c.querySlots <- struct{}{}:
+		c.holdsSlot = true
+		wait.finish(nil)
+		c.setLabel("queue_wait", time.Since(wait.start).String())
+		return nil
+	case <-ctx.Done():
+		wait.finish(ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// releaseSlot gives back the slot taken by the operation, if any
+func (c *opCall) releaseSlot() {
+	if c.holdsSlot {
+		<-c.querySlots
+		c.holdsSlot = false
+	}
+}
@@ -0,0 +1,90 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+// startedHook signals started when the Before of an exec is called, right before it waits for a slot
+type startedHook struct {
+	started chan struct{}
+}
+
+func (h startedHook) Before(ctx context.Context, op Op, query string, args []driver.NamedValue) (context.Context, error) {
+	if op == OpSQLConnExec {
+		h.started <- struct{}{}
+	}
+	return ctx, nil
+}
+
+func (startedHook) After(ctx context.Context, op Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration) {
+}
+
+func TestMaxConcurrentQueries(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	hook := startedHook{started: make(chan struct{}, 1)}
+	db := openBenchDB(t, WrapDriver(&fakeDriver{rows: 1}, WithLogger(logger), WithHooks(hook), WithMaxConcurrentQueries(1)), "")
+	db.SetMaxOpenConns(3)
+
+	// The rows hold the only slot until they are closed
+	rows, err := db.Query("SELECT a FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := db.ExecContext(ctx, "UPDATE t SET a = 1")
+		done <- err
+	}()
+	<-hook.started
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v once the context of a waiting query was canceled, want %v", err, context.Canceled)
+	}
+
+	go func() {
+		_, err := db.Exec("UPDATE t SET a = 2")
+		done <- err
+	}()
+	<-hook.started
+	time.Sleep(10 * time.Millisecond)
+	rows.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	waits := logger.Find(string(OpSQLQueueWait))
+	if len(waits) != 2 || !errors.Is(waits[0].Err, context.Canceled) || waits[1].Err != nil {
+		t.Errorf("recorded waits %+v, want a canceled one and a successful one", waits)
+	}
+	op := logger.AssertQuery(t, "UPDATE t SET a = 2")
+	if wait, err := time.ParseDuration(op.Labels["queue_wait"].(string)); err != nil || wait < 10*time.Millisecond {
+		t.Errorf("recorded queue_wait %v, want at least 10ms", op.Labels["queue_wait"])
+	}
+}
+
+func TestMaxConcurrentQueriesUnlimited(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		logger := instrumentedsqltest.NewLogger()
+		db := openBenchDB(t, WrapDriver(&fakeDriver{rows: 1}, WithLogger(logger), WithMaxConcurrentQueries(n)), "")
+		db.SetMaxOpenConns(3)
+
+		for i := 0; i < 3; i++ {
+			rows, err := db.Query("SELECT a FROM t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+		}
+		if waits := logger.Find(string(OpSQLQueueWait)); len(waits) != 0 {
+			t.Errorf("WithMaxConcurrentQueries(%d) made queries wait %+v", n, waits)
+		}
+	}
+}
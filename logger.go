@@ -7,6 +7,12 @@ type Logger interface {
 	Log(ctx context.Context, msg string, keyvals ...interface{})
 }
 
+// Flusher can be implemented by loggers and event sinks buffering entries, such as AsyncLogger and PublisherSink,
+// to be flushed by the Flush method of the wrapped driver
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
 type nullLogger struct{}
 
 func (nullLogger) Log(ctx context.Context, msg string, keyvals ...interface{}) {}
@@ -18,3 +24,30 @@ type LoggerFunc func(ctx context.Context, msg string, keyvals ...interface{})
 func (f LoggerFunc) Log(ctx context.Context, msg string, keyvals ...interface{}) {
 	f(ctx, msg, keyvals...)
 }
+
+// identityLogger adds the identity of the wrapped driver to the entries logged outside of operations, such as warnings
+// and reports, whose entries would otherwise not tell which database they are about when several drivers are wrapped
+type identityLogger struct {
+	Logger
+	keyvals []interface{}
+}
+
+func (l identityLogger) Log(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Logger.Log(ctx, msg, append(keyvals[:len(keyvals):len(keyvals)], l.keyvals...)...)
+}
+
+// eventLogger returns the logger of the entries logged outside of operations, see identityLogger
+func (o *opts) eventLogger() Logger {
+	var keyvals []interface{}
+	if o.dbName != "" {
+		keyvals = append(keyvals, "db", o.dbName)
+	}
+	if o.dbSystem != "" {
+		keyvals = append(keyvals, "db_system", o.dbSystem)
+	}
+	if keyvals == nil {
+		return o.Logger
+	}
+
+	return identityLogger{Logger: o.Logger, keyvals: keyvals}
+}
@@ -0,0 +1,34 @@
+package instrumentedsql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+)
+
+// NamedArgsConverter converts the args of a query for parent drivers only implementing the legacy, pre Go 1.8,
+// interfaces, whose methods take args without names, see WithNamedArgs
+type NamedArgsConverter func(args []driver.NamedValue) ([]driver.Value, error)
+
+// NamedArgsAsValues passes named args as sql.NamedArg values, the way some drivers accept them through the legacy interfaces,
+// other args are passed as is
+func NamedArgsAsValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for n, arg := range args {
+		if arg.Name != "" {
+			values[n] = sql.Named(arg.Name, arg.Value)
+			continue
+		}
+		values[n] = arg.Value
+	}
+
+	return values, nil
+}
+
+// toValues converts args for the legacy methods of the parent driver, rejecting named args unless WithNamedArgs was used
+func (o *opts) toValues(args []driver.NamedValue) ([]driver.Value, error) {
+	if o.namedArgs != nil {
+		return o.namedArgs(args)
+	}
+
+	return namedValueToValue(args)
+}
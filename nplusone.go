@@ -0,0 +1,62 @@
+package instrumentedsql
+
+import (
+	"context"
+	"sync"
+)
+
+// maxScopeFingerprints bounds the number of fingerprints counted per request scope, see RequestScope
+const maxScopeFingerprints = 1000
+
+// requestScope counts the executions of every fingerprint run with a context returned by RequestScope
+type requestScope struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// RequestScope returns a copy of ctx marking the scope of a request, such as an HTTP request,
+// within which repeated queries are detected, see WithNPlusOneDetection
+func RequestScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestScopeKey, &requestScope{counts: map[string]int{}})
+}
+
+// contextRequestScope returns the scope set on ctx by RequestScope, ctx may be nil for the legacy driver methods
+func contextRequestScope(ctx context.Context) *requestScope {
+	if ctx == nil {
+		return nil
+	}
+
+	s, _ := ctx.Value(requestScopeKey).(*requestScope)
+	return s
+}
+
+// count adds an execution of fingerprint and returns the number of executions so far
+func (s *requestScope) count(fingerprint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.counts[fingerprint]
+	if !ok && len(s.counts) >= maxScopeFingerprints {
+		return 0
+	}
+	n++
+	s.counts[fingerprint] = n
+
+	return n
+}
+
+// detectNPlusOne logs a sql-n-plus-one warning when the query of the operation was run threshold times
+// within its request scope, along with the code running it
+func (c *opCall) detectNPlusOne() {
+	if !isStatementOp(c.op) {
+		return
+	}
+	scope := contextRequestScope(c.ctx)
+	if scope == nil {
+		return
+	}
+
+	if n := scope.count(c.fingerprint()); n == c.nPlusOneThreshold {
+		c.events.Log(c.ctx, "sql-n-plus-one", "op", c.opName(c.op), "fingerprint", c.fingerprint(), "count", n, "caller", caller())
+	}
+}
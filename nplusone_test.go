@@ -0,0 +1,31 @@
+package instrumentedsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestNPlusOneDetection(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithNPlusOneDetection(3)), "")
+
+	request := RequestScope(context.Background())
+	for id := 0; id < 5; id++ {
+		if _, err := db.ExecContext(request, "UPDATE t SET a = 1 WHERE id = ?", id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(context.Background(), "UPDATE t SET a = 1 WHERE id = ?", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.ExecContext(RequestScope(context.Background()), "UPDATE t SET a = 1 WHERE id = ?", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	warnings := logger.Find("sql-n-plus-one")
+	if len(warnings) != 1 || warnings[0].Labels["fingerprint"] != "UPDATE t SET a = ? WHERE id = ?" || warnings[0].Labels["caller"] == nil {
+		t.Errorf("logged %+v, want a single warning for the request", warnings)
+	}
+}
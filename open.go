@@ -0,0 +1,63 @@
+package instrumentedsql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var (
+	registerMu sync.Mutex
+	registered = map[string]int{}
+)
+
+// Open opens a database on the driver registered under driverName, wrapped with the passed options.
+// Unlike registering the driver returned by WrapDriver, it does not need a name of its own,
+// so it can be called any number of times, with different options, for example from tests.
+func Open(driverName, dsn string, options ...Opt) (*sql.DB, error) {
+	// sql.Open does not connect, the database is only opened to look the driver up
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	parent := db.Driver()
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+
+	wrapped := WrapDriver(parent, options...)
+	if driverCtx, ok := wrapped.(driver.DriverContext); ok {
+		connector, err := driverCtx.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		return sql.OpenDB(connector), nil
+	}
+
+	return sql.OpenDB(dsnConnector{driver: wrapped, dsn: dsn}), nil
+}
+
+// Register wraps parent with the passed options and registers it with the sql package under a name generated from name,
+// such as postgres-instrumented-1, which it returns. The number is incremented on every call for the same name and
+// skips the names already registered directly with the sql package, so Register never panics on duplicates.
+// The name it returns must be passed to sql.Open rather than name itself.
+func Register(name string, parent driver.Driver, options ...Opt) string {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+
+	drivers := sql.Drivers()
+	for {
+		registered[name]++
+		unique := name + "-instrumented-" + strconv.Itoa(registered[name])
+		// Skip the names registered directly with the sql package
+		if n := sort.SearchStrings(drivers, unique); n < len(drivers) && drivers[n] == unique {
+			continue
+		}
+
+		sql.Register(unique, WrapDriver(parent, options...))
+		return unique
+	}
+}
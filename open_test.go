@@ -0,0 +1,55 @@
+package instrumentedsql
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func init() {
+	sql.Register("instrumentedsql-fake", &fakeDriver{})
+	sql.Register("fake-instrumented-1", &fakeDriver{})
+}
+
+func TestOpen(t *testing.T) {
+	for _, name := range []string{"first", "second"} {
+		logger := instrumentedsqltest.NewLogger()
+		db, err := Open("instrumentedsql-fake", "", WithLogger(logger), WithDBName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+
+		op := logger.AssertQuery(t, "UPDATE t SET a = 1")
+		if op.Labels["db"] != name {
+			t.Errorf("query recorded with db %v, want %s", op.Labels["db"], name)
+		}
+	}
+
+	if _, err := Open("instrumentedsql-unknown", ""); err == nil {
+		t.Error("Open() of an unregistered driver succeeded")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	first := Register("fake", &fakeDriver{}, WithLogger(nullLogger{}))
+	second := Register("fake", &fakeDriver{}, WithDBName("second"))
+	// fake-instrumented-1 was registered by init
+	if first == second || first == "fake-instrumented-1" || !strings.HasPrefix(second, "fake-instrumented-") {
+		t.Errorf("Register() = %s, %s, want distinct generated names", first, second)
+	}
+
+	db, err := sql.Open(second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,80 @@
+package instrumentedsql
+
+import "sync/atomic"
+
+// Op identifies a driver operation instrumented by this package
+type Op string
+
+// The operations instrumented by this package, their values are the default names used for spans and log messages
+const (
+	OpSQLConnOpen        Op = "sql-conn-open"
+	OpSQLConnClose       Op = "sql-conn-close"
+	OpSQLPrepare         Op = "sql-prepare"
+	OpSQLConnExec        Op = "sql-conn-exec"
+	OpSQLConnQuery       Op = "sql-conn-query"
+	OpSQLPing            Op = "sql-ping"
+	OpSQLDummyPing       Op = "sql-dummy-ping"
+	OpSQLTx              Op = "sql-tx"
+	OpSQLTxBegin         Op = "sql-tx-begin"
+	OpSQLTxCommit        Op = "sql-tx-commit"
+	OpSQLTxRollback      Op = "sql-tx-rollback"
+	OpSQLStmtClose       Op = "sql-stmt-close"
+	OpSQLStmtExec        Op = "sql-stmt-exec"
+	OpSQLStmtQuery       Op = "sql-stmt-query"
+	OpSQLCopy            Op = "sql-copy"
+	OpSQLBatch           Op = "sql-batch"
+	OpSQLSavepoint       Op = "sql-savepoint"
+	OpSQLResLastInsertID Op = "sql-res-lastInsertId"
+	OpSQLResRowsAffected Op = "sql-res-rowsAffected"
+	OpSQLRows            Op = "sql-rows"
+	OpSQLExplain         Op = "sql-explain"
+	OpSQLQueueWait       Op = "sql-queue-wait"
+)
+
+// opName returns the name to use for op in spans and log messages
+func (o *opts) opName(op Op) string {
+	if name, ok := o.opNames[op]; ok {
+		return name
+	}
+
+	return string(op)
+}
+
+// opEnabled reports whether op should be instrumented
+func (o *opts) opEnabled(op Op) bool {
+	included, excluded := o.opsIncluded, o.opsExcluded
+	if o.config != nil {
+		if v := o.config.load(); v.opsSet {
+			included, excluded = v.opsIncluded, v.opsExcluded
+		}
+	}
+
+	if _, ok := excluded[op]; ok {
+		return false
+	}
+	if included != nil {
+		_, ok := included[op]
+		return ok
+	}
+
+	return true
+}
+
+// instrumentationEnabled reports whether operations are instrumented at all, see WithEnabled
+func (o *opts) instrumentationEnabled() bool {
+	if atomic.LoadInt32(&o.switchedOff) == 1 {
+		return false
+	}
+
+	return o.enabled == nil || o.enabled()
+}
+
+// isStatementOp reports whether op executes a query, as opposed to preparing statements, handling transactions or results
+func isStatementOp(op Op) bool {
+	switch op {
+	case OpSQLConnExec, OpSQLConnQuery, OpSQLStmtExec, OpSQLStmtQuery, OpSQLCopy:
+		return true
+	}
+
+	return false
+}
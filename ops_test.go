@@ -0,0 +1,106 @@
+package instrumentedsql
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+// runOps runs an exec and a transaction committing another one on db
+func runOps(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("UPDATE t SET a = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpNames(t *testing.T) {
+	cases := []struct {
+		name  string
+		names map[Op]string
+		want  []string
+	}{
+		{
+			name: "default",
+			want: []string{"sql-conn-open", "(sql-conn-exec) UPDATE t SET a = 1", "sql-tx", "sql-tx-begin", "(sql-conn-exec) UPDATE t SET a = 2", "sql-tx-commit"},
+		},
+		{
+			name:  "renamed",
+			names: map[Op]string{OpSQLConnExec: "db.exec", OpSQLTx: "db.transaction"},
+			want:  []string{"sql-conn-open", "(db.exec) UPDATE t SET a = 1", "db.transaction", "sql-tx-begin", "(db.exec) UPDATE t SET a = 2", "sql-tx-commit"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			tr := instrumentedsqltest.NewTracer()
+			runOps(t, openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithTracer(tr), WithOpNames(tc.names)), ""))
+
+			var spans []string
+			for _, span := range tr.Spans() {
+				spans = append(spans, span.Name)
+			}
+			if !reflect.DeepEqual(spans, tc.want) {
+				t.Errorf("recorded spans %q, want %q", spans, tc.want)
+			}
+			execName := string(OpSQLConnExec)
+			if name, ok := tc.names[OpSQLConnExec]; ok {
+				execName = name
+			}
+			if execs := logger.Find(execName); len(execs) != 2 {
+				t.Errorf("logged %d execs as %s, want 2", len(execs), execName)
+			}
+		})
+	}
+}
+
+func TestOpsIncludedAndExcluded(t *testing.T) {
+	cases := []struct {
+		name    string
+		options []Opt
+		want    []string
+	}{
+		{
+			name: "all",
+			want: []string{"sql-conn-open", "sql-conn-exec", "sql-tx-begin", "sql-conn-exec", "sql-tx-commit", "sql-tx"},
+		},
+		{
+			name:    "excluded",
+			options: []Opt{WithOpsExcluded(OpSQLConnOpen, OpSQLTx, OpSQLTxBegin, OpSQLTxCommit)},
+			want:    []string{"sql-conn-exec", "sql-conn-exec"},
+		},
+		{
+			name:    "included",
+			options: []Opt{WithOpsIncluded(OpSQLTxBegin), WithOpsIncluded(OpSQLTxCommit)},
+			want:    []string{"sql-tx-begin", "sql-tx-commit"},
+		},
+		{
+			name:    "included and excluded",
+			options: []Opt{WithOpsIncluded(OpSQLTxBegin, OpSQLTxCommit), WithOpsExcluded(OpSQLTxCommit)},
+			want:    []string{"sql-tx-begin"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			runOps(t, openBenchDB(t, WrapDriver(&fakeDriver{}, append(tc.options, WithLogger(logger))...), ""))
+
+			logger.AssertNames(t, tc.want...)
+		})
+	}
+}
@@ -1,20 +1,717 @@
 package instrumentedsql
 
-import "github.com/away-team/go-tracer/tracer"
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/away-team/go-tracer/tracer"
+)
+
+// opts holds the configuration shared by the wrapped driver and everything it hands out
+type opts struct {
+	Logger
+	tracer.Tracer
+	// events logs the entries logged outside of operations, with the identity of the driver, see eventLogger
+	events Logger
+
+	commentApplication string
+	commentQueries     bool
+
+	opNames map[Op]string
+
+	dbName    string
+	dbSystem  string
+	component string
+
+	dsnAttributes  bool
+	argsSummary    bool
+	piiMasking     bool
+	argsHashKey    []byte
+	secretScanning bool
+
+	opsIncluded map[Op]struct{}
+	opsExcluded map[Op]struct{}
+
+	aggregateRows  bool
+	captureResults bool
+
+	ignoreErr   func(err error) bool
+	classifyErr ErrorClassifier
+
+	slowQueryThreshold time.Duration
+	slowQueryFunc      func(ctx context.Context, query string, args []driver.NamedValue, duration time.Duration)
+
+	explainThreshold time.Duration
+	explainInterval  time.Duration
+	explain          *explainer
+
+	sampler     Sampler
+	queryDetail *queryDetail
+
+	contextAttributes func(ctx context.Context) map[string]string
+	tenants           *tenants
+
+	tagStatements bool
+	router        Router
+
+	stats           *queryStats
+	latencyBuckets  []time.Duration
+	maxFingerprints int
+
+	slowQueryReportInterval time.Duration
+	slowQueryReportN        int
+	slowQueryReportFunc     func([]QueryStats)
+	slowQueryReport         *slowQueryReporter
+
+	hooks []Hooks
+
+	rowsLeak *leakDetector
+	txLeak   *leakDetector
+
+	connHoldThreshold time.Duration
+
+	stackThreshold    time.Duration
+	callerAttribution bool
+	profilerLabels    bool
+	runtimeTrace      bool
+	recoverPanics     bool
+
+	retryPolicy    *RetryPolicy
+	circuitBreaker *CircuitBreakerConfig
+	querySlots     chan struct{}
+
+	deadlineWarning time.Duration
+
+	namedArgs NamedArgsConverter
+
+	stmtCacheSize  int
+	stmtCacheStats *StatementCacheStats
+
+	pings *pingMonitor
+
+	missingTraceContext *missingTraceContext
+	orphanSpans         bool
+	nPlusOneThreshold   int
+	budgets             bool
+	duplicateQueries    bool
+	queryCache          *queryCache
+	shadow              *shadower
+	readOnly            readOnlyMode
+	auditWriter         AuditWriter
+	eventSink           EventSink
+	phaseTimings        bool
+
+	// lastConnID is the ID of the last connection opened, accessed atomically
+	lastConnID uint64
+	// detectSystem detects the database system from the first connection or statement wrapped by a Wrapper
+	detectSystem sync.Once
+
+	config  *Config
+	enabled func() bool
+	// switchedOff is set to 1 while the instrumentation is switched off with SetEnabled, accessed atomically
+	switchedOff int32
+}
+
+// active reports whether options acting on operations regardless of the logger and tracer are set,
+// new options of that kind must be added here
+func (o *opts) active() bool {
+	return o.commentQueries || o.stats != nil || o.slowQueryFunc != nil || o.slowQueryReportInterval > 0 ||
+		len(o.hooks) > 0 || o.retryPolicy != nil || o.circuitBreaker != nil || o.querySlots != nil ||
+		o.profilerLabels || o.runtimeTrace || o.namedArgs != nil || o.stmtCacheSize > 0 ||
+		o.pings != nil || o.missingTraceContext != nil || o.nPlusOneThreshold > 0 ||
+		o.queryCache != nil || o.shadow != nil ||
+		o.readOnly != readOnlyOff || o.auditWriter != nil ||
+		o.eventSink != nil || o.budgets
+}
 
 // Opt is a functional option type for the wrapped driver
-type Opt func(*wrappedDriver)
+type Opt func(*opts)
 
-// WithLogger sets the logger of the wrapped driver to the provided logger
+// WithLogger sets the logger of the wrapped driver to the provided logger, see NewAsyncLogger to take it off the path of queries
 func WithLogger(l Logger) Opt {
-	return func(w *wrappedDriver) {
-		w.Logger = l
+	return func(o *opts) {
+		o.Logger = l
 	}
 }
 
 // WithTracer sets the tracer of the wrapped driver to the provided tracer
 func WithTracer(t tracer.Tracer) Opt {
-	return func(w *wrappedDriver) {
-		w.Tracer = t
+	return func(o *opts) {
+		o.Tracer = t
+	}
+}
+
+// WithSQLCommenter enables appending a sqlcommenter (https://google.github.io/sqlcommenter/) comment to outgoing queries,
+// so that database side logs can be correlated with traces. The comment carries the passed application name and,
+// if the span created for the query implements TraceParenter, its traceparent.
+// Only the queries executed on the connection are commented, including by the legacy Exec and Query of driver.Conn.
+// Prepared statements are not, the comment would carry the trace of the prepare rather than of the executions,
+// and make every prepare of a query distinct for the database and the statement cache.
+func WithSQLCommenter(application string) Opt {
+	return func(o *opts) {
+		o.commentQueries = true
+		o.commentApplication = application
+	}
+}
+
+// WithOpNames overrides the names used in spans and log messages for the given operations,
+// operations not present in names keep their default name
+func WithOpNames(names map[Op]string) Opt {
+	return func(o *opts) {
+		if o.opNames == nil {
+			o.opNames = make(map[Op]string, len(names))
+		}
+		for op, name := range names {
+			o.opNames[op] = name
+		}
+	}
+}
+
+// WithDBName sets the logical name of the database, which will be recorded on every span and log message.
+// It also lists the driver in Drivers, so name each driver differently when wrapping several.
+func WithDBName(name string) Opt {
+	return func(o *opts) {
+		o.dbName = name
+	}
+}
+
+// WithDBSystem sets the database system recorded in the db_system label of every span and log message, such as postgresql.
+// It is detected from the type of the parent driver for well known drivers, this is only needed for the others.
+func WithDBSystem(system string) Opt {
+	return func(o *opts) {
+		o.dbSystem = system
+	}
+}
+
+// WithDSNAttributes records the host, port, user and database found in the DSN of connections on all their operations,
+// as the db_host, db_port, db_user and db_database labels. The password is never recorded.
+func WithDSNAttributes() Opt {
+	return func(o *opts) {
+		o.dsnAttributes = true
+	}
+}
+
+// WithArgsSummary records the number of args of queries and their approximate size in bytes, as the arg_count and args_size labels,
+// instead of their values in the args label. This spots queries with huge IN lists without recording any value,
+// and avoids the cost of formatting the args.
+func WithArgsSummary() Opt {
+	return func(o *opts) {
+		o.argsSummary = true
+	}
+}
+
+// WithPIIMasking masks the email addresses, social security numbers and credit card numbers found in the args label,
+// replacing them by their kind such as [email], and records the kinds found in the pii label.
+// Detection is heuristic, it lowers the risk of logging personal data but does not rule it out.
+func WithPIIMasking() Opt {
+	return func(o *opts) {
+		o.piiMasking = true
+	}
+}
+
+// WithArgsHashing records the args of queries hashed with HMAC-SHA256 and key in the args label, instead of their values,
+// so that the queries run for the same identifier can be correlated without exposing it, see HashArg.
+// The key should be a secret of the service, otherwise identifiers can be guessed by hashing candidates.
+// It takes precedence over WithPIIMasking.
+func WithArgsHashing(key []byte) Opt {
+	return func(o *opts) {
+		o.argsHashKey = key
+	}
+}
+
+// WithSecretScanning masks the secrets found in the text of queries, such as the passwords of dblink connection strings,
+// tokens with a known prefix or long high-entropy strings, before queries are recorded in spans and logs.
+// Hooks and the parent driver still get the original queries.
+func WithSecretScanning() Opt {
+	return func(o *opts) {
+		o.secretScanning = true
+	}
+}
+
+// WithComponent sets the component recorded on every span and log message, it defaults to "database/sql" on spans
+func WithComponent(component string) Opt {
+	return func(o *opts) {
+		o.component = component
+	}
+}
+
+// WithOpsExcluded disables instrumentation of the given operations, everything else stays instrumented
+func WithOpsExcluded(ops ...Op) Opt {
+	return func(o *opts) {
+		if o.opsExcluded == nil {
+			o.opsExcluded = make(map[Op]struct{}, len(ops))
+		}
+		for _, op := range ops {
+			o.opsExcluded[op] = struct{}{}
+		}
+	}
+}
+
+// WithOpsIncluded restricts instrumentation to the given operations, it can be passed multiple times to include more.
+// Operations excluded by WithOpsExcluded stay excluded.
+func WithOpsIncluded(ops ...Op) Opt {
+	return func(o *opts) {
+		if o.opsIncluded == nil {
+			o.opsIncluded = make(map[Op]struct{}, len(ops))
+		}
+		for _, op := range ops {
+			o.opsIncluded[op] = struct{}{}
+		}
+	}
+}
+
+// WithRowsAggregation enables a single sql-rows measurement per result set, spanning from the first call to Next until Close.
+// It records the number of rows fetched and the time spent fetching them, rather than instrumenting every row.
+func WithRowsAggregation() Opt {
+	return func(o *opts) {
+		o.aggregateRows = true
+	}
+}
+
+// WithResultCapture makes exec operations fetch RowsAffected and LastInsertId from the parent result as soon as it is returned
+// and record them on the exec span and log message, instead of instrumenting those calls separately.
+// Only use this with drivers for which fetching those values is cheap, which is the case for most of them.
+func WithResultCapture() Opt {
+	return func(o *opts) {
+		o.captureResults = true
+	}
+}
+
+// WithErrorFilter sets a function reporting which errors are expected, such as sql.ErrNoRows or context.Canceled.
+// Operations failing with those errors are not marked as failed on their span, the error is still logged.
+// driver.ErrSkip, which only makes database/sql fall back to another method, is never considered a failure.
+func WithErrorFilter(ignore func(err error) bool) Opt {
+	return func(o *opts) {
+		o.ignoreErr = ignore
+	}
+}
+
+// IgnoreErrors returns an error filter for WithErrorFilter that ignores the passed errors and any error wrapping them
+func IgnoreErrors(errs ...error) func(err error) bool {
+	return func(err error) bool {
+		for _, e := range errs {
+			if errors.Is(err, e) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// WithErrorClassifier sets the classifier used to record the category of errors on failed operations, as the err_category label.
+// DefaultErrorClassifier can be used as is, or as the fallback of a classifier that knows about a specific driver.
+func WithErrorClassifier(classifier ErrorClassifier) Opt {
+	return func(o *opts) {
+		o.classifyErr = classifier
+	}
+}
+
+// WithSlowQueryThreshold calls fn for every operation that took at least threshold, with the context, query and args of the operation.
+// This allows logging slow queries separately without logging every query. The duration of queries includes fetching their rows.
+// Operations left out by the sampler are still logged when they are slow, fn may be nil to only do that.
+// A threshold of 0 detects no slow operations.
+func WithSlowQueryThreshold(threshold time.Duration, fn func(ctx context.Context, query string, args []driver.NamedValue, duration time.Duration)) Opt {
+	return func(o *opts) {
+		o.slowQueryThreshold = threshold
+		o.slowQueryFunc = fn
+	}
+}
+
+// WithExplain makes queries that took at least threshold get explained, on a separate connection and at most once per interval.
+// The plan is recorded by a sql-explain operation that is a child of the slow one.
+// This is only supported for Postgres and MySQL drivers, the option is ignored for other drivers.
+func WithExplain(threshold, interval time.Duration) Opt {
+	return func(o *opts) {
+		o.explainThreshold = threshold
+		o.explainInterval = interval
+	}
+}
+
+// WithSampler sets a sampler deciding which operations are instrumented, see also ProbabilitySampler.
+// Operations left out by the sampler get no span, but are still logged when they fail or exceed the slow query threshold.
+func WithSampler(sampler Sampler) Opt {
+	return func(o *opts) {
+		o.sampler = sampler
+	}
+}
+
+// WithQueryAllowlist limits the full instrumentation of statements to the queries matching one of rules,
+// the others are treated as if left out by the sampler: they get no span and are only logged when they fail or are slow,
+// while still being counted by WithQueryStats. It can be combined with WithQueryDenylist.
+func WithQueryAllowlist(rules ...QueryRule) Opt {
+	return func(o *opts) {
+		o.addQueryRules(rules, false)
+	}
+}
+
+// WithQueryDenylist treats the statements whose query matches one of rules as if left out by the sampler,
+// for example to keep health checks run many times a second from dominating traces and logs, see WithQueryAllowlist
+func WithQueryDenylist(rules ...QueryRule) Opt {
+	return func(o *opts) {
+		o.addQueryRules(rules, true)
+	}
+}
+
+func (o *opts) addQueryRules(rules []QueryRule, deny bool) {
+	if o.queryDetail == nil {
+		o.queryDetail = &queryDetail{}
+	}
+	o.queryDetail.add(rules, deny)
+}
+
+// WithContextAttributes sets a function extracting request scoped attributes from the context of operations,
+// such as a tenant or request ID, which are then recorded on every span and log message
+func WithContextAttributes(fn func(ctx context.Context) map[string]string) Opt {
+	return func(o *opts) {
+		o.contextAttributes = fn
+	}
+}
+
+// WithTenantExtractor records the tenant returned by extract for the context of every operation in the tenant label,
+// and partitions the statistics of WithQueryStats and WithSlowQueryReport by tenant, see QueryStats.
+// At most maxTenants distinct tenants are tracked, 100 if it is not positive, the operations of the tenants seen
+// after that are attributed to OtherTenant so that their number cannot grow without bound.
+func WithTenantExtractor(extract func(ctx context.Context) string, maxTenants int) Opt {
+	return func(o *opts) {
+		o.tenants = newTenants(extract, maxTenants)
+	}
+}
+
+// WithStatementTags records the type of statement (SELECT, INSERT, UPDATE, DELETE, DDL...), whether it reads or writes and,
+// where it can be found, the primary table of every query, as the statement, access and table labels.
+// Queries are parsed by looking at their first keywords only.
+func WithStatementTags() Opt {
+	return func(o *opts) {
+		o.tagStatements = true
+	}
+}
+
+// WithRouter records the route returned by router for every query as the route label, see Router
+func WithRouter(router Router) Opt {
+	return func(o *opts) {
+		o.router = router
+	}
+}
+
+// WithQueryStats enables aggregating statistics per query fingerprint in process, including operations left out by the sampler.
+// They can be retrieved using the Stats method of the wrapped driver.
+func WithQueryStats() Opt {
+	return func(o *opts) {
+		o.stats = newQueryStats(defaultLatencyBuckets, 0)
+	}
+}
+
+// WithLatencyBuckets sets the upper bounds of the latency histograms kept by WithQueryStats and WithSlowQueryReport,
+// from which their percentiles are estimated. The default buckets go from 100µs to 30s,
+// percentiles falling outside of the buckets are estimated as the maximum latency.
+func WithLatencyBuckets(buckets ...time.Duration) Opt {
+	return func(o *opts) {
+		o.latencyBuckets = sortedBuckets(buckets)
+	}
+}
+
+// WithMaxFingerprints caps the number of query fingerprints tracked by WithQueryStats and WithSlowQueryReport at n,
+// so that code generating unique queries, with inlined literal lists for example, cannot grow them without bound.
+// Once n fingerprints are tracked, the least recently executed one is evicted for every new one
+// and its statistics are merged into those of OtherFingerprint.
+func WithMaxFingerprints(n int) Opt {
+	return func(o *opts) {
+		o.maxFingerprints = n
+	}
+}
+
+// WithSlowQueryReport starts a background reporter which, at every interval, reports the n query fingerprints
+// with the highest 99th percentile latency over that interval, along with their call counts and other percentiles.
+// The report is passed to fn, or written to the logger, one message per query, if fn is nil. n <= 0 reports every fingerprint.
+func WithSlowQueryReport(interval time.Duration, n int, fn func([]QueryStats)) Opt {
+	return func(o *opts) {
+		o.slowQueryReportInterval = interval
+		o.slowQueryReportN = n
+		o.slowQueryReportFunc = fn
+	}
+}
+
+// WithHooks adds hooks to run around every operation, Before hooks run in the order they were added and After hooks in reverse order.
+// It can be passed multiple times to add more hooks.
+func WithHooks(hooks ...Hooks) Opt {
+	return func(o *opts) {
+		o.hooks = append(o.hooks, hooks...)
+	}
+}
+
+// WithRowsLeakDetection logs a sql-rows-leak warning, with the query and connection, for rows still not closed after the passed duration.
+// Rows left open hold on to their connection, they are a common cause of pool exhaustion.
+// If stacks is set the stack of the goroutine that ran the query is recorded too, which is costly as it is captured for every query.
+func WithRowsLeakDetection(after time.Duration, stacks bool) Opt {
+	return func(o *opts) {
+		o.rowsLeak = &leakDetector{after: after, stacks: stacks}
+	}
+}
+
+// WithTxLeakDetection logs a sql-tx-leak warning, with the connection, for transactions neither committed nor rolled back
+// after the passed duration, such transactions hold on to their locks. If stacks is set the stack of the goroutine that
+// began the transaction is recorded too.
+func WithTxLeakDetection(after time.Duration, stacks bool) Opt {
+	return func(o *opts) {
+		o.txLeak = &leakDetector{after: after, stacks: stacks}
+	}
+}
+
+// WithConnHoldThreshold logs a sql-conn-held warning when a query and the iteration of its rows, or a transaction,
+// hold their connection for longer than threshold, along with the queries run, up to 50 for transactions.
+// This finds the code pinning a connection for much longer than its queries take.
+func WithConnHoldThreshold(threshold time.Duration) Opt {
+	return func(o *opts) {
+		o.connHoldThreshold = threshold
+	}
+}
+
+// WithStackTraces records the stack of the calling code, as the stack label, for operations that fail or take at least threshold.
+// Frames of this package and of database/sql are left out so that the stack starts with the code using the database.
+func WithStackTraces(threshold time.Duration) Opt {
+	return func(o *opts) {
+		o.stackThreshold = threshold
+	}
+}
+
+// WithCallerAttribution records the function, file and line of the code running every operation as the caller label,
+// the first frame of the stack outside of this package and database/sql. Walking the stack has a cost on every operation.
+func WithCallerAttribution() Opt {
+	return func(o *opts) {
+		o.callerAttribution = true
+	}
+}
+
+// WithProfilerLabels sets the sql_op and sql_query pprof labels, the name of the operation and the fingerprint of its query,
+// on the goroutine running each operation, so that CPU profiles show which queries the driver was busy with.
+// Queries keep their labels until their rows are closed.
+func WithProfilerLabels() Opt {
+	return func(o *opts) {
+		o.profilerLabels = true
+	}
+}
+
+// WithRuntimeTrace emits a runtime/trace region for every operation, and a task for every transaction,
+// so that execution traces show database activity. Queries end their region when their rows are closed,
+// which must be done by the goroutine that ran them.
+func WithRuntimeTrace() Opt {
+	return func(o *opts) {
+		o.runtimeTrace = true
+	}
+}
+
+// WithPanicRecovery records panics of the parent driver on the operation that caused them, with its query and the stack
+// of the panic, before panicking again. Without it such panics escape without any span or log entry.
+func WithPanicRecovery() Opt {
+	return func(o *opts) {
+		o.recoverPanics = true
+	}
+}
+
+// WithRetry retries the queries executed on the connection outside of transactions which fail with a transient error,
+// such as a serialization failure or a deadlock, according to policy. Every attempt is instrumented as its own operation,
+// with the attempt label from the second one on.
+func WithRetry(policy RetryPolicy) Opt {
+	return func(o *opts) {
+		if policy.Retryable == nil {
+			policy.Retryable = retryableByDefault
+		}
+		if policy.Backoff == nil {
+			policy.Backoff = backoffByDefault
+		}
+		o.retryPolicy = &policy
+	}
+}
+
+// WithCircuitBreaker rejects queries with ErrCircuitOpen while the database is failing, as decided by config.
+// The changes of state of the circuit are logged as sql-circuit-breaker. The breaker runs before the hooks.
+func WithCircuitBreaker(config CircuitBreakerConfig) Opt {
+	return func(o *opts) {
+		o.circuitBreaker = &config
+	}
+}
+
+// WithMaxConcurrentQueries limits the number of queries running at the same time through the driver to n,
+// queries wait for their turn, which is instrumented as a sql-queue-wait operation and recorded as the queue_wait label.
+// Queries hold their slot until their rows are closed. n <= 0 means no limit.
+func WithMaxConcurrentQueries(n int) Opt {
+	return func(o *opts) {
+		o.querySlots = nil
+		if n > 0 {
+			o.querySlots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithDeadlineWarning logs a sql-deadline-warning, and records the deadline_remaining label, for operations starting
+// with less than min left before the deadline of their context, which are likely to time out.
+func WithDeadlineWarning(min time.Duration) Opt {
+	return func(o *opts) {
+		o.deadlineWarning = min
+	}
+}
+
+// WithEnabled makes the instrumentation of every operation conditional on enabled, which can be backed by a feature flag
+// to switch it on and off at runtime. The returned driver also has a SetEnabled(bool) method to do so.
+// Hooks and options acting on the operations themselves, such as WithRetry, are not affected.
+func WithEnabled(enabled func() bool) Opt {
+	return func(o *opts) {
+		o.enabled = enabled
+	}
+}
+
+// WithConfig lets the sampler, slow query threshold and operations instrumented be changed at runtime through config
+func WithConfig(config *Config) Opt {
+	return func(o *opts) {
+		o.config = config
+	}
+}
+
+// WithNamedArgs sets how named args, such as those of sqlx or sql.Named, are passed to parent drivers only implementing
+// the legacy interfaces, which take args without names. By default queries with named args fail for these drivers,
+// NamedArgsAsValues passes them on for drivers that accept sql.NamedArg values. It is the default for
+// the MSSQL and Oracle drivers, which do.
+func WithNamedArgs(convert NamedArgsConverter) Opt {
+	return func(o *opts) {
+		o.namedArgs = convert
+	}
+}
+
+// WithStatementCache keeps up to size prepared statements per connection, the least recently used are closed first,
+// so that preparing the same query again reuses the statement of the parent connection rather than preparing it anew.
+// This also applies to the queries database/sql prepares for parent drivers that cannot run queries without preparing them.
+// Prepares record whether they hit the cache in the stmt_cache label, the totals are returned by the StatementCacheStats
+// method of the driver. Statements are shared, drivers that cannot run a statement while rows it returned are open should not use it.
+func WithStatementCache(size int) Opt {
+	return func(o *opts) {
+		o.stmtCacheSize = size
+		o.stmtCacheStats = &StatementCacheStats{}
+	}
+}
+
+// WithPingMonitor counts the successful and failed pings of the connections, the totals are returned by the PingStats method
+// of the driver and pings record the number of consecutive failures in the consecutive_failures label.
+// fn, if not nil, is called once threshold pings failed in a row and then by the first successful ping,
+// so that services can report themselves as not ready while the database is unreachable.
+func WithPingMonitor(threshold int, fn PingFunc) Opt {
+	return func(o *opts) {
+		o.pings = newPingMonitor(threshold, fn)
+	}
+}
+
+// WithMissingTraceContext detects the queries and transactions whose context carries no span according to hasSpan,
+// usually because the caller did not pass on the context of the request, which leaves their spans detached from its trace.
+// The first one run from each call site is logged as sql-missing-trace-context along with its caller,
+// they are all counted by the MissingTraceContexts method of the driver.
+func WithMissingTraceContext(hasSpan func(ctx context.Context) bool) Opt {
+	return func(o *opts) {
+		o.missingTraceContext = &missingTraceContext{hasSpan: hasSpan}
+	}
+}
+
+// WithOrphanSpans instruments the legacy driver methods without a context too, such as Exec and Query on connections,
+// which are otherwise passed to the parent driver as is. Their spans are created from context.Background(),
+// as roots of traces of their own, and labeled orphan so that the code paths still using them can be found.
+// With WithMissingTraceContext, the operations whose context carries no span are labeled orphan as well.
+func WithOrphanSpans() Opt {
+	return func(o *opts) {
+		o.orphanSpans = true
+	}
+}
+
+// WithBudgets keeps the driver wrapped for the budgets set with Budgeted to be tracked when nothing else is recorded,
+// as WrapDriver otherwise returns the parent driver as is
+func WithBudgets() Opt {
+	return func(o *opts) {
+		o.budgets = true
+	}
+}
+
+// WithNPlusOneDetection logs a sql-n-plus-one warning, with the code running the query, when a query fingerprint
+// is run threshold times within the same request, typically by an ORM loading the relations of records one by one.
+// Requests are delimited by RequestScope, queries run outside of one are not counted.
+func WithNPlusOneDetection(threshold int) Opt {
+	return func(o *opts) {
+		o.nPlusOneThreshold = threshold
+	}
+}
+
+// WithDuplicateQueryDetection flags the queries run more than once with the same args within a transaction,
+// which are often redundant reads that the application could cache. Such queries get a duplicate_in_tx label
+// with the number of times they were run, and a sql-duplicate-query warning is logged the first time.
+func WithDuplicateQueryDetection() Opt {
+	return func(o *opts) {
+		o.duplicateQueries = true
+	}
+}
+
+// WithQueryCache serves the SELECTs run with a context returned by Cached from an in-process cache of up to size results,
+// the least recently used are evicted first. Results of more than maxRows rows are not cached, there is no limit if it is 0.
+// Queries record whether they hit the cache in the query_cache label, the totals are returned by the QueryCacheStats method
+// of the driver. Only the queries run without preparing them are cached, and never within a transaction.
+func WithQueryCache(size, maxRows int) Opt {
+	return func(o *opts) {
+		o.queryCache = newQueryCache(size, maxRows)
+	}
+}
+
+// WithShadow mirrors a share of the read queries to the shadow database in the background, once their rows are closed,
+// and compares their latency and optionally their number of rows, to validate a migration such as a major upgrade.
+// A sql-shadow-divergence warning is logged for the queries that diverged. Queries run in transactions are not mirrored,
+// nor the ones run while many mirrored queries are still in progress.
+func WithShadow(s Shadow) Opt {
+	return func(o *opts) {
+		o.shadow = newShadower(s)
+	}
+}
+
+// WithAuditWriter writes an audit record for every INSERT, UPDATE, DELETE and DDL statement run, whether it succeeded or not,
+// to provide evidence of who changed what for compliance. Records hold the fingerprint of the query rather than its args.
+func WithAuditWriter(w AuditWriter) Opt {
+	return func(o *opts) {
+		o.auditWriter = w
+	}
+}
+
+// WithEventSink writes a QueryEvent for every operation logged to sink, see NewJSONEventSink.
+// Like log entries, events are only written for the operations left out by the sampler if they fail or are slow.
+func WithEventSink(sink EventSink) Opt {
+	return func(o *opts) {
+		o.eventSink = sink
+	}
+}
+
+// WithPhaseTimings records how long each phase of operations took, to tell a slow driver from a slow iteration:
+// phase_setup until the parent driver is called, which includes the hooks and waiting for a slot, phase_args converting
+// the args for parent drivers not supporting named values, phase_driver in the parent driver, then for queries
+// phase_first_row from the parent returning to the first row and phase_iteration until the rows are closed,
+// closing them being recorded in close_duration.
+func WithPhaseTimings() Opt {
+	return func(o *opts) {
+		o.phaseTimings = true
+	}
+}
+
+// WithGuard adds a guard which can reject queries before they are sent to the parent driver, such as DenyUnboundedWrites.
+// Guards run as hooks, in the order they were added along with the ones passed to WithHooks.
+func WithGuard(guard Guard) Opt {
+	return WithHooks(guardHook{guard: guard})
+}
+
+// WithReadOnlyGuard reports the statements that may write, see DenyWrites, so that a service can be run against production
+// replicas or during an incident investigation without risking writes. They are labeled read_only_violation and logged
+// as a sql-read-only-violation warning along with the code running them. If enforce is set they are also rejected,
+// otherwise they are allowed, to audit which writes a service would do. Statements are checked once rewritten by the hooks,
+// see QueryRewriter.
+func WithReadOnlyGuard(enforce bool) Opt {
+	return func(o *opts) {
+		o.readOnly = readOnlyLog
+		if enforce {
+			o.readOnly = readOnlyEnforce
+		}
 	}
 }
@@ -0,0 +1,324 @@
+// Package otlp exports the spans and metrics of instrumentedsql directly over OTLP/gRPC to a collector,
+// for services that do not run a tracer of their own.
+//
+// The exporter is configured by the standard OTEL_* environment variables, such as OTEL_EXPORTER_OTLP_ENDPOINT,
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME, the options passed to New take precedence over them:
+//
+//	exporter, err := otlp.New(ctx, otlp.WithServiceName("billing"))
+//	if err != nil {
+//		return err
+//	}
+//	defer exporter.Shutdown(ctx)
+//	sql.Register("instrumented-postgres", instrumentedsql.WrapDriver(&pq.Driver{},
+//		instrumentedsql.WithTracer(exporter), instrumentedsql.WithHooks(exporter.Hooks())))
+package otlp
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/away-team/go-tracer/tracer"
+
+	"github.com/away-team/instrumentedsql"
+)
+
+// instrumentationName is the name of the tracer and meter of the exporter
+const instrumentationName = "github.com/away-team/instrumentedsql/otlp"
+
+// Option configures an Exporter
+type Option func(*config)
+
+type config struct {
+	endpoint      string
+	insecure      bool
+	headers       map[string]string
+	serviceName   string
+	batchTimeout  time.Duration
+	maxBatchSize  int
+	metricsPeriod time.Duration
+}
+
+// WithEndpoint sets the host and port of the collector, it defaults to OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317
+func WithEndpoint(endpoint string) Option {
+	return func(c *config) {
+		c.endpoint = endpoint
+	}
+}
+
+// WithInsecure disables TLS towards the collector, for collectors running as sidecars
+func WithInsecure() Option {
+	return func(c *config) {
+		c.insecure = true
+	}
+}
+
+// WithHeaders sets the gRPC headers sent with every export, such as the API key of a vendor
+func WithHeaders(headers map[string]string) Option {
+	return func(c *config) {
+		c.headers = headers
+	}
+}
+
+// WithServiceName sets the service.name resource attribute, it defaults to OTEL_SERVICE_NAME
+func WithServiceName(name string) Option {
+	return func(c *config) {
+		c.serviceName = name
+	}
+}
+
+// WithBatching sets the maximum time spans wait to be exported and the maximum number of spans per export,
+// the defaults of the OpenTelemetry SDK, which can be set by OTEL_BSP_* environment variables, are used for zero values
+func WithBatching(timeout time.Duration, maxSize int) Option {
+	return func(c *config) {
+		c.batchTimeout = timeout
+		c.maxBatchSize = maxSize
+	}
+}
+
+// WithMetricsPeriod sets the interval between exports of the metrics, it defaults to OTEL_METRIC_EXPORT_INTERVAL or 60s
+func WithMetricsPeriod(period time.Duration) Option {
+	return func(c *config) {
+		c.metricsPeriod = period
+	}
+}
+
+// Exporter is a tracer.Tracer for instrumentedsql.WithTracer exporting its spans over OTLP, see New.
+// Its Hooks record the duration of operations as metrics.
+type Exporter struct {
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+	tracer         trace.Tracer
+	duration       metric.Float64Histogram
+}
+
+// New returns an Exporter connected to the collector, Shutdown must be called to export the last spans and metrics
+func New(ctx context.Context, opts ...Option) (*Exporter, error) {
+	var c config
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	res, err := c.resource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	spanExporter, err := otlptracegrpc.New(ctx, c.traceOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	var batchOpts []sdktrace.BatchSpanProcessorOption
+	if c.batchTimeout > 0 {
+		batchOpts = append(batchOpts, sdktrace.WithBatchTimeout(c.batchTimeout))
+	}
+	if c.maxBatchSize > 0 {
+		batchOpts = append(batchOpts, sdktrace.WithMaxExportBatchSize(c.maxBatchSize))
+	}
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter, batchOpts...), sdktrace.WithResource(res))
+
+	metricExporter, err := otlpmetricgrpc.New(ctx, c.metricOptions()...)
+	if err != nil {
+		tracerProvider.Shutdown(ctx)
+		return nil, err
+	}
+	var readerOpts []sdkmetric.PeriodicReaderOption
+	if c.metricsPeriod > 0 {
+		readerOpts = append(readerOpts, sdkmetric.WithInterval(c.metricsPeriod))
+	}
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, readerOpts...)),
+		sdkmetric.WithResource(res))
+
+	e, err := newExporter(tracerProvider, meterProvider)
+	if err != nil {
+		tracerProvider.Shutdown(ctx)
+		meterProvider.Shutdown(ctx)
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// newExporter returns an Exporter using the passed providers
+func newExporter(tracerProvider *sdktrace.TracerProvider, meterProvider *sdkmetric.MeterProvider) (*Exporter, error) {
+	duration, err := meterProvider.Meter(instrumentationName).Float64Histogram("db.client.operation.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of the database operations, including fetching the rows of queries"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exporter{
+		tracerProvider: tracerProvider,
+		meterProvider:  meterProvider,
+		tracer:         tracerProvider.Tracer(instrumentationName),
+		duration:       duration,
+	}, nil
+}
+
+// resource describes the service, the attributes of the environment are overridden by the options
+func (c config) resource(ctx context.Context) (*resource.Resource, error) {
+	opts := []resource.Option{resource.WithTelemetrySDK(), resource.WithFromEnv()}
+	if c.serviceName != "" {
+		opts = append(opts, resource.WithAttributes(attribute.String("service.name", c.serviceName)))
+	}
+
+	return resource.New(ctx, opts...)
+}
+
+func (c config) traceOptions() []otlptracegrpc.Option {
+	var opts []otlptracegrpc.Option
+	if c.endpoint != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(c.endpoint))
+	}
+	if c.insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	if c.headers != nil {
+		opts = append(opts, otlptracegrpc.WithHeaders(c.headers))
+	}
+
+	return opts
+}
+
+func (c config) metricOptions() []otlpmetricgrpc.Option {
+	var opts []otlpmetricgrpc.Option
+	if c.endpoint != "" {
+		opts = append(opts, otlpmetricgrpc.WithEndpoint(c.endpoint))
+	}
+	if c.insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	if c.headers != nil {
+		opts = append(opts, otlpmetricgrpc.WithHeaders(c.headers))
+	}
+
+	return opts
+}
+
+// Flush exports the spans and metrics recorded so far, or returns the error of ctx if it is done first
+func (e *Exporter) Flush(ctx context.Context) error {
+	if err := e.tracerProvider.ForceFlush(ctx); err != nil {
+		return err
+	}
+
+	return e.meterProvider.ForceFlush(ctx)
+}
+
+// Shutdown exports the spans and metrics recorded so far and closes the connections to the collector
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	err := e.tracerProvider.Shutdown(ctx)
+	if merr := e.meterProvider.Shutdown(ctx); err == nil {
+		err = merr
+	}
+
+	return err
+}
+
+// GetSpan returns the span carried by ctx, the spans of operations are its children, or root spans if there is none
+func (e *Exporter) GetSpan(ctx context.Context) tracer.Span {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &span{exporter: e, ctx: ctx, span: trace.SpanFromContext(ctx), borrowed: true}
+}
+
+// Hooks returns hooks recording the duration of every operation in the db.client.operation.duration histogram,
+// along with its operation and whether it failed
+func (e *Exporter) Hooks() instrumentedsql.Hooks {
+	return durationHooks{exporter: e}
+}
+
+type durationHooks struct {
+	exporter *Exporter
+}
+
+func (h durationHooks) Before(ctx context.Context, op instrumentedsql.Op, query string, args []driver.NamedValue) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h durationHooks) After(ctx context.Context, op instrumentedsql.Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration) {
+	failed := err != nil && err != driver.ErrSkip
+	h.exporter.duration.Record(ctx, duration.Seconds(), metric.WithAttributes(
+		attribute.String("db.operation.name", string(op)),
+		attribute.Bool("error", failed),
+	))
+}
+
+// span is a span of the OpenTelemetry SDK
+type span struct {
+	exporter *Exporter
+	// ctx carries the span, for its children
+	ctx  context.Context
+	span trace.Span
+	// borrowed is set for the span returned by GetSpan, which belongs to the caller and is not modified
+	borrowed bool
+}
+
+// attributeNames maps the labels of instrumentedsql to the semantic conventions of database clients
+var attributeNames = map[string]string{
+	"query":     "db.query.text",
+	"db":        "db.namespace",
+	"db_system": "db.system",
+	"table":     "db.collection.name",
+	"statement": "db.operation.name",
+}
+
+func (s *span) NewChild(name string) tracer.Span {
+	ctx, child := s.exporter.tracer.Start(s.ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return &span{exporter: s.exporter, ctx: ctx, span: child}
+}
+
+func (s *span) SetLabel(key, value string) {
+	if s.borrowed {
+		return
+	}
+	if name, ok := attributeNames[key]; ok {
+		key = name
+	}
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+func (s *span) Finish() {
+	s.FinishWithError(nil)
+}
+
+// FinishWithError sets the status of the span, see instrumentedsql.ErrorFinisher
+func (s *span) FinishWithError(err error) {
+	if s.borrowed {
+		return
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// RecordEvent adds an event to the span, see instrumentedsql.EventRecorder
+func (s *span) RecordEvent(name string) {
+	if s.borrowed {
+		return
+	}
+	s.span.AddEvent(name)
+}
+
+// TraceID returns the ID of the trace of the span, see instrumentedsql.TraceIDer
+func (s *span) TraceID() string {
+	sc := s.span.SpanContext()
+	if !sc.HasTraceID() {
+		return ""
+	}
+
+	return sc.TraceID().String()
+}
@@ -0,0 +1,86 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/away-team/instrumentedsql"
+)
+
+func newTestExporter(t *testing.T) (*Exporter, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	recorder := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	e, err := newExporter(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e, recorder, reader
+}
+
+func TestSpans(t *testing.T) {
+	e, recorder, _ := newTestExporter(t)
+
+	ctx, request := e.tracer.Start(context.Background(), "request")
+	parent := e.GetSpan(ctx)
+	parent.SetLabel("ignored", "true")
+	child := parent.NewChild("sql-conn-query")
+	child.SetLabel("query", "SELECT 1")
+	child.(instrumentedsql.EventRecorder).RecordEvent("first_row")
+	child.(instrumentedsql.ErrorFinisher).FinishWithError(errors.New("boom"))
+	request.End()
+
+	orphan := e.GetSpan(nil).NewChild("sql-conn-exec")
+	orphan.Finish()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("ended %d spans, want 3", len(spans))
+	}
+	query := spans[0]
+	if query.Parent().SpanID() != request.SpanContext().SpanID() || query.SpanKind() != trace.SpanKindClient {
+		t.Errorf("query span is not a client child of the request")
+	}
+	if attrs := query.Attributes(); len(attrs) != 1 || attrs[0].Key != "db.query.text" || attrs[0].Value.AsString() != "SELECT 1" {
+		t.Errorf("query span has attributes %v", attrs)
+	}
+	if query.Status().Code != codes.Error || len(query.Events()) != 2 {
+		t.Errorf("query span has status %v and events %v", query.Status(), query.Events())
+	}
+	if len(spans[1].Attributes()) != 0 {
+		t.Errorf("the span of the request was modified: %v", spans[1].Attributes())
+	}
+	if spans[2].Parent().IsValid() {
+		t.Error("span without a parent in its context is not a root span")
+	}
+	if id := child.(instrumentedsql.TraceIDer).TraceID(); id != request.SpanContext().TraceID().String() {
+		t.Errorf("trace ID is %q", id)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	e, _, reader := newTestExporter(t)
+	hooks := e.Hooks()
+
+	ctx := context.Background()
+	hooks.After(ctx, instrumentedsql.OpSQLConnExec, "UPDATE t SET n = 1", nil, nil, nil, time.Millisecond)
+	hooks.After(ctx, instrumentedsql.OpSQLConnExec, "UPDATE t SET n = 1", nil, nil, errors.New("boom"), time.Second)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	histogram := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64])
+	if len(histogram.DataPoints) != 2 {
+		t.Errorf("recorded %d series, want one per outcome", len(histogram.DataPoints))
+	}
+}
@@ -0,0 +1,25 @@
+package instrumentedsql
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// recoverPanic records a panic of the parent driver on the operation, finishes it and panics again, see WithPanicRecovery.
+// It must be deferred by the operation, so that it can recover.
+func (c *opCall) recoverPanic() {
+	if !c.recoverPanics {
+		return
+	}
+
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	c.setLabel("panic", "true")
+	c.setLabel("stack", string(debug.Stack()))
+	c.finish(fmt.Errorf("panic: %v", r))
+
+	panic(r)
+}
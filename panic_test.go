@@ -0,0 +1,67 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	conn, err := WrapDriver(&fakeDriver{execPanic: "boom"}, WithLogger(logger), WithPanicRecovery()).Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recovered %+v, want the panic of the driver", r)
+			}
+		}()
+		conn.(driver.ExecerContext).ExecContext(context.Background(), "UPDATE t SET a = 1", nil)
+	}()
+
+	execs := logger.Find(string(OpSQLConnExec))
+	if len(execs) != 1 {
+		t.Fatalf("logged %+v, want the exec once", execs)
+	}
+	if err := execs[0].Err; err == nil || err.Error() != "panic: boom" || execs[0].Labels["panic"] != "true" || execs[0].Labels["stack"] == nil {
+		t.Errorf("exec recorded as %+v, want the panic", execs[0])
+	}
+}
+
+func TestPanicRecoveryBeginTx(t *testing.T) {
+	for _, recoverPanics := range []bool{false, true} {
+		tr := instrumentedsqltest.NewTracer()
+		options := []Opt{WithTracer(tr)}
+		if recoverPanics {
+			options = append(options, WithPanicRecovery())
+		}
+		conn, err := WrapDriver(&fakeDriver{beginPanic: "boom"}, options...).Open("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r != "boom" {
+					t.Errorf("recovered %+v, want the panic of the driver", r)
+				}
+			}()
+			conn.(driver.ConnBeginTx).BeginTx(context.Background(), driver.TxOptions{})
+		}()
+		if _, err := conn.(driver.ExecerContext).ExecContext(context.Background(), "UPDATE t SET a = 1", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		// The transaction that failed to begin is over, the next operations of the connection are not part of it
+		for _, span := range tr.Spans() {
+			if span.Name == "sql-tx" && !span.Finished || span.Labels["query"] != "" && span.Parent != "" {
+				t.Errorf("with panic recovery %t recorded %+v", recoverPanics, span)
+			}
+		}
+	}
+}
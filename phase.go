@@ -0,0 +1,56 @@
+package instrumentedsql
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// phases are the times at which an operation went from one phase to the next, see WithPhaseTimings
+type phases struct {
+	// driverStart is when the parent driver was called, once the hooks ran, zero if it was not
+	driverStart time.Time
+	// args is the time spent converting the args for a parent driver not supporting named values
+	args time.Duration
+	// driverDone is when the parent driver returned successfully
+	driverDone time.Time
+	// iterationDone is when the rows returned by a query started being closed
+	iterationDone time.Time
+}
+
+// toValues converts args for the parent driver, timing the conversion
+func (c *opCall) toValues(args []driver.NamedValue) ([]driver.Value, error) {
+	if !c.phaseTimings {
+		return c.opts.toValues(args)
+	}
+
+	start := time.Now()
+	defer func() { c.phases.args += time.Since(start) }()
+
+	return c.opts.toValues(args)
+}
+
+// recordPhases records the time spent in each phase of the operation that ended at end
+func (c *opCall) recordPhases(end time.Time) {
+	p := c.phases
+	if p.driverStart.IsZero() {
+		return
+	}
+
+	driverDone := p.driverDone
+	if driverDone.IsZero() {
+		driverDone = end
+	}
+	c.setLabel("phase_setup", p.driverStart.Sub(c.start).String())
+	if p.args > 0 {
+		c.setLabel("phase_args", p.args.String())
+	}
+	c.setLabel("phase_driver", (driverDone.Sub(p.driverStart) - p.args).String())
+
+	if p.iterationDone.IsZero() {
+		return
+	}
+	if c.firstRow > 0 {
+		c.setLabel("phase_first_row", (c.firstRow - driverDone.Sub(c.start)).String())
+	}
+	c.setLabel("phase_iteration", p.iterationDone.Sub(driverDone).String())
+}
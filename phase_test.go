@@ -0,0 +1,43 @@
+package instrumentedsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestPhaseTimings(t *testing.T) {
+	for _, api := range []fakeAPI{fakeContextAPI, fakeExecerAPI} {
+		logger := instrumentedsqltest.NewLogger()
+		db := openBenchDB(t, WrapDriver(&fakeDriver{rows: 2, api: api}, WithLogger(logger), WithPhaseTimings()), "")
+		ctx := context.Background()
+
+		rows, err := db.QueryContext(ctx, "SELECT n FROM t WHERE id = ?", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+
+		query := logger.Find(string(OpSQLConnQuery))[0]
+		for _, phase := range []string{"phase_setup", "phase_driver", "phase_first_row", "phase_iteration"} {
+			if _, ok := query.Labels[phase]; !ok {
+				t.Errorf("api %d: query has no %s label: %v", api, phase, query.Labels)
+			}
+		}
+		// Only the parent drivers not supporting named values need their args converted
+		if _, ok := query.Labels["phase_args"]; ok != (api == fakeExecerAPI) {
+			t.Errorf("api %d: query has labels %v", api, query.Labels)
+		}
+
+		if _, err := db.ExecContext(ctx, "UPDATE t SET n = 1"); err != nil {
+			t.Fatal(err)
+		}
+		exec := logger.Find(string(OpSQLConnExec))[0]
+		if _, ok := exec.Labels["phase_iteration"]; ok || exec.Labels["phase_driver"] == nil {
+			t.Errorf("api %d: exec has labels %v", api, exec.Labels)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package instrumentedsql
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// piiPattern matches a kind of personal data in the args of queries, see WithPIIMasking
+type piiPattern struct {
+	kind string
+	re   *regexp.Regexp
+	// valid, if not nil, rules out the matches that are not actually personal data
+	valid func(match string) bool
+}
+
+var piiPatterns = []piiPattern{
+	{kind: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{kind: "ssn", re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{kind: "credit_card", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: luhn},
+}
+
+// maskPII returns a copy of args where the personal data found in string and []byte values is replaced by its kind,
+// such as [email], along with the sorted kinds found. args is returned as is if none was found.
+func maskPII(args []driver.NamedValue) ([]driver.NamedValue, []string) {
+	var masked []driver.NamedValue
+	found := map[string]bool{}
+	for n, arg := range args {
+		var s string
+		switch v := arg.Value.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		default:
+			continue
+		}
+
+		m := maskPIIString(s, found)
+		if m == s {
+			continue
+		}
+		if masked == nil {
+			masked = append([]driver.NamedValue(nil), args...)
+		}
+		masked[n].Value = m
+	}
+	if masked == nil {
+		return args, nil
+	}
+
+	kinds := make([]string, 0, len(found))
+	for kind := range found {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	return masked, kinds
+}
+
+// maskPIIString replaces the personal data found in s by its kind, adding the kinds found to found
+func maskPIIString(s string, found map[string]bool) string {
+	for _, p := range piiPatterns {
+		s = p.re.ReplaceAllStringFunc(s, func(match string) string {
+			if p.valid != nil && !p.valid(match) {
+				return match
+			}
+			found[p.kind] = true
+			return "[" + p.kind + "]"
+		})
+	}
+
+	return s
+}
+
+// luhn reports whether the digits of number, ignoring spaces and dashes, pass the Luhn checksum of card numbers
+func luhn(number string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(number)
+
+	sum := 0
+	for n := range digits {
+		d := int(digits[len(digits)-1-n] - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,55 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestMaskPII(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  interface{}
+		kinds []string
+	}{
+		{"contact jane.doe+db@example.com now", "contact [email] now", []string{"email"}},
+		{[]byte("ssn 123-45-6789"), "ssn [ssn]", []string{"ssn"}},
+		{"4111 1111 1111 1111", "[credit_card]", []string{"credit_card"}},
+		// Fails the Luhn checksum
+		{"4111 1111 1111 1112", "4111 1111 1111 1112", nil},
+		{"order 1234567", "order 1234567", nil},
+		{int64(123456789), int64(123456789), nil},
+	}
+
+	for _, test := range tests {
+		args := []driver.NamedValue{{Ordinal: 1, Value: test.value}}
+		masked, kinds := maskPII(args)
+		if !reflect.DeepEqual(masked[0].Value, test.want) {
+			t.Errorf("maskPII(%q) = %q, want %q", test.value, masked[0].Value, test.want)
+		}
+		if !reflect.DeepEqual(kinds, test.kinds) {
+			t.Errorf("maskPII(%q) found %v, want %v", test.value, kinds, test.kinds)
+		}
+		if !reflect.DeepEqual(args[0].Value, test.value) {
+			t.Errorf("maskPII(%q) modified its args", test.value)
+		}
+	}
+}
+
+func TestPIIMasking(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithPIIMasking()), "")
+
+	if _, err := db.ExecContext(context.Background(), "UPDATE users SET email = ? WHERE id = ?", "jane@example.com", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := logger.Find(string(OpSQLConnExec))[0]
+	if exec.Labels["pii"] != "email" || exec.Args == "" || strings.Contains(exec.Args, "jane@example.com") {
+		t.Errorf("logged %+v, want the email masked", exec)
+	}
+}
@@ -0,0 +1,65 @@
+package instrumentedsql
+
+import (
+	"context"
+	"sync"
+)
+
+// PingStats counts the pings of all the connections of the driver, see WithPingMonitor
+type PingStats struct {
+	Successes int64
+	Failures  int64
+	// ConsecutiveFailures is the number of pings that failed since the last successful one
+	ConsecutiveFailures int64
+}
+
+// PingFunc is called by WithPingMonitor when pings start failing, with the error of the last one,
+// and when they succeed again, with a nil error
+type PingFunc func(ctx context.Context, stats PingStats, err error)
+
+// pingMonitor tracks the outcome of pings across the connections of the driver
+type pingMonitor struct {
+	threshold int64
+	fn        PingFunc
+
+	mu    sync.Mutex
+	stats PingStats
+}
+
+func newPingMonitor(threshold int, fn PingFunc) *pingMonitor {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	return &pingMonitor{threshold: int64(threshold), fn: fn}
+}
+
+// record adds the outcome of a ping, err is nil if it succeeded, and calls fn if pings started failing or recovered
+func (m *pingMonitor) record(ctx context.Context, err error) PingStats {
+	m.mu.Lock()
+	var notify bool
+	if err == nil {
+		m.stats.Successes++
+		notify = m.stats.ConsecutiveFailures >= m.threshold
+		m.stats.ConsecutiveFailures = 0
+	} else {
+		m.stats.Failures++
+		m.stats.ConsecutiveFailures++
+		notify = m.stats.ConsecutiveFailures == m.threshold
+	}
+	stats := m.stats
+	m.mu.Unlock()
+
+	if notify && m.fn != nil {
+		m.fn(ctx, stats, err)
+	}
+
+	return stats
+}
+
+func (m *pingMonitor) snapshot() PingStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stats
+}
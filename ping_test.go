@@ -0,0 +1,33 @@
+package instrumentedsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPingMonitor(t *testing.T) {
+	parent := &fakeDriver{}
+	var notified []error
+	wrapped := WrapDriver(parent, WithPingMonitor(2, func(ctx context.Context, stats PingStats, err error) {
+		notified = append(notified, err)
+	}))
+	db := openBenchDB(t, wrapped, "")
+	ctx := context.Background()
+
+	unreachable := errors.New("unreachable")
+	for _, pingErr := range []error{nil, unreachable, nil, unreachable, unreachable, unreachable, nil, nil} {
+		parent.pingErr = pingErr
+		if err := db.PingContext(ctx); err != pingErr {
+			t.Fatalf("PingContext() = %v, want %v", err, pingErr)
+		}
+	}
+
+	if len(notified) != 2 || notified[0] != unreachable || notified[1] != nil {
+		t.Errorf("notified %v, want the failure then the recovery", notified)
+	}
+	stats := wrapped.(interface{ PingStats() PingStats }).PingStats()
+	if stats != (PingStats{Successes: 4, Failures: 4}) {
+		t.Errorf("PingStats() = %+v", stats)
+	}
+}
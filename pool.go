@@ -0,0 +1,64 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// ErrNoPoolReport is returned by ReportPoolStats when it has no report function and the pool does not use a wrapped driver
+var ErrNoPoolReport = errors.New("instrumentedsql: no report function for the pool statistics")
+
+// PoolStatsSource is a connection pool whose statistics can be sampled, such as *sql.DB
+type PoolStatsSource interface {
+	Stats() sql.DBStats
+}
+
+// ReportPoolStats samples the statistics of the connection pool of db every interval and passes them to report,
+// until ctx is done, then returns the error of ctx. It blocks, so it is meant to be run in its own goroutine.
+// When report is nil and db was opened with a wrapped driver, the statistics are logged with the logger of the driver,
+// otherwise ErrNoPoolReport is returned right away.
+func ReportPoolStats(ctx context.Context, db PoolStatsSource, interval time.Duration, report func(sql.DBStats)) error {
+	if report == nil {
+		d, ok := poolDriver(db)
+		if !ok {
+			return ErrNoPoolReport
+		}
+		report = logPoolStats(d.events)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			report(db.Stats())
+		}
+	}
+}
+
+// poolDriver returns the wrapped driver of db if it has one, such as the driver of a *sql.DB
+func poolDriver(db PoolStatsSource) (wrappedDriver, bool) {
+	withDriver, ok := db.(interface{ Driver() driver.Driver })
+	if !ok {
+		return wrappedDriver{}, false
+	}
+	d, ok := withDriver.Driver().(wrappedDriver)
+
+	return d, ok
+}
+
+// logPoolStats returns a report function writing the statistics of the pool to l
+func logPoolStats(l Logger) func(sql.DBStats) {
+	return func(stats sql.DBStats) {
+		l.Log(context.Background(), "sql-pool-stats",
+			"max_open", stats.MaxOpenConnections, "open", stats.OpenConnections, "in_use", stats.InUse, "idle", stats.Idle,
+			"wait_count", stats.WaitCount, "wait_duration", stats.WaitDuration,
+			"max_idle_closed", stats.MaxIdleClosed, "max_lifetime_closed", stats.MaxLifetimeClosed)
+	}
+}
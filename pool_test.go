@@ -0,0 +1,60 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+// fakePool is a PoolStatsSource returning fixed statistics
+type fakePool struct {
+	stats sql.DBStats
+}
+
+func (p fakePool) Stats() sql.DBStats {
+	return p.stats
+}
+
+func TestReportPoolStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reports := make(chan sql.DBStats)
+	go func() {
+		<-reports
+		cancel()
+	}()
+
+	pool := fakePool{stats: sql.DBStats{OpenConnections: 3, InUse: 2}}
+	err := ReportPoolStats(ctx, pool, time.Millisecond, func(stats sql.DBStats) {
+		if stats != pool.stats {
+			t.Errorf("reported %+v, want %+v", stats, pool.stats)
+		}
+		select {
+		case reports <- stats:
+		default:
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("ReportPoolStats() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestReportPoolStatsLogged(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger)), "")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := ReportPoolStats(ctx, db, time.Millisecond, nil); err != context.DeadlineExceeded {
+		t.Errorf("ReportPoolStats() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(logger.Find("sql-pool-stats")) == 0 {
+		t.Error("no sql-pool-stats logged")
+	}
+
+	if err := ReportPoolStats(ctx, fakePool{}, time.Millisecond, nil); err != ErrNoPoolReport {
+		t.Errorf("ReportPoolStats() without a report function = %v, want %v", err, ErrNoPoolReport)
+	}
+}
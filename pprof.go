@@ -0,0 +1,30 @@
+package instrumentedsql
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// setProfilerLabels labels the goroutine running the operation with its name and the fingerprint of its query,
+// see WithProfilerLabels. The labels of the context of the operation are restored by finish.
+func (c *opCall) setProfilerLabels() {
+	c.unlabeledCtx = c.ctx
+	if c.unlabeledCtx == nil {
+		c.unlabeledCtx = context.Background()
+	}
+
+	labels := pprof.Labels("sql_op", c.opName(c.op))
+	if c.query != "" {
+		labels = pprof.Labels("sql_op", c.opName(c.op), "sql_query", c.fingerprint())
+	}
+
+	c.ctx = pprof.WithLabels(c.unlabeledCtx, labels)
+	pprof.SetGoroutineLabels(c.ctx)
+}
+
+// resetProfilerLabels restores the labels the goroutine had before the operation
+func (c *opCall) resetProfilerLabels() {
+	if c.unlabeledCtx != nil {
+		pprof.SetGoroutineLabels(c.unlabeledCtx)
+	}
+}
@@ -0,0 +1,63 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"runtime/pprof"
+	"sync"
+	"testing"
+	"time"
+)
+
+// profilerLabelsHook records the pprof labels of the contexts passed to its Before
+type profilerLabelsHook struct {
+	mu     *sync.Mutex
+	labels *[][3]string
+}
+
+func (h profilerLabelsHook) Before(ctx context.Context, op Op, query string, args []driver.NamedValue) (context.Context, error) {
+	sqlOp, _ := pprof.Label(ctx, "sql_op")
+	sqlQuery, _ := pprof.Label(ctx, "sql_query")
+	handler, _ := pprof.Label(ctx, "handler")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.labels = append(*h.labels, [3]string{sqlOp, sqlQuery, handler})
+
+	return ctx, nil
+}
+
+func (profilerLabelsHook) After(ctx context.Context, op Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration) {
+}
+
+func TestProfilerLabels(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		var (
+			mu     sync.Mutex
+			labels [][3]string
+		)
+		options := []Opt{WithHooks(profilerLabelsHook{mu: &mu, labels: &labels})}
+		if enabled {
+			options = append(options, WithProfilerLabels())
+		}
+		db := openBenchDB(t, WrapDriver(&fakeDriver{}, options...), "")
+		if err := db.Ping(); err != nil {
+			t.Fatal(err)
+		}
+		labels = nil
+
+		ctx := pprof.WithLabels(context.Background(), pprof.Labels("handler", "users"))
+		if _, err := db.ExecContext(ctx, "UPDATE t SET a = 1 WHERE id = 2"); err != nil {
+			t.Fatal(err)
+		}
+
+		// The labels of the caller are kept
+		want := [3]string{"", "", "users"}
+		if enabled {
+			want = [3]string{string(OpSQLConnExec), "UPDATE t SET a = ? WHERE id = ?", "users"}
+		}
+		if len(labels) != 1 || labels[0] != want {
+			t.Errorf("with profiler labels %t the exec ran with labels %q, want %q", enabled, labels, want)
+		}
+	}
+}
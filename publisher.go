@@ -0,0 +1,209 @@
+package instrumentedsql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSinkClosed is returned for the events written to a PublisherSink once it is closed
+var ErrSinkClosed = errors.New("instrumentedsql: event sink closed")
+
+// Publisher ships batches of events to a broker such as Kafka or Kinesis, see NewPublisherSink.
+// A batch holds one JSON encoded QueryEvent per line, it is not reused once Publish returned.
+type Publisher interface {
+	Publish(ctx context.Context, batch []byte) error
+}
+
+// PublisherFunc is an adapter which allows a function to be used as a Publisher
+type PublisherFunc func(ctx context.Context, batch []byte) error
+
+// Publish calls f(ctx, batch)
+func (f PublisherFunc) Publish(ctx context.Context, batch []byte) error {
+	return f(ctx, batch)
+}
+
+// PublisherConfig configures a PublisherSink, the zero value of its fields picks a default
+type PublisherConfig struct {
+	// BatchSize is the maximum number of events per batch, 100 by default
+	BatchSize int
+	// FlushInterval is the maximum time an event waits for its batch to be full, 1s by default
+	FlushInterval time.Duration
+	// BufferSize is the number of events buffered while batches are published, 10 times the batch size by default
+	BufferSize int
+	// Block makes queries wait for room in the buffer when it is full, until their context is done,
+	// instead of dropping their events
+	Block bool
+	// OnError is called, if not nil, with the errors of Publish. The batch that failed is dropped.
+	OnError func(err error)
+}
+
+// PublisherSink is an EventSink publishing batches of events from a background goroutine, see NewPublisherSink
+type PublisherSink struct {
+	publisher Publisher
+	config    PublisherConfig
+	events    chan publisherEntry
+	dropped   uint64
+	failed    uint64
+	done      chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type publisherEntry struct {
+	event QueryEvent
+	// flushed is set for the entries marking a flush, it is closed once the events buffered before are published
+	flushed chan struct{}
+}
+
+// NewPublisherSink returns a PublisherSink publishing events in batches to publisher, so that they can be analyzed offline
+// without this package depending on any broker client. Close must be called to stop it.
+func NewPublisherSink(publisher Publisher, config PublisherConfig) *PublisherSink {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 10 * config.BatchSize
+	}
+
+	s := &PublisherSink{publisher: publisher, config: config, events: make(chan publisherEntry, config.BufferSize), done: make(chan struct{})}
+	go s.run()
+
+	return s
+}
+
+func (s *PublisherSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	var batch bytes.Buffer
+	enc := json.NewEncoder(&batch)
+	count := 0
+	publish := func() {
+		if count == 0 {
+			return
+		}
+		if err := s.publisher.Publish(context.Background(), batch.Bytes()); err != nil {
+			atomic.AddUint64(&s.failed, uint64(count))
+			if s.config.OnError != nil {
+				s.config.OnError(err)
+			}
+		}
+		// The publisher may still hold the previous batch
+		batch = bytes.Buffer{}
+		enc = json.NewEncoder(&batch)
+		count = 0
+	}
+
+	for {
+		select {
+		case e, ok := <-s.events:
+			if !ok {
+				publish()
+				return
+			}
+			if e.flushed != nil {
+				publish()
+				close(e.flushed)
+				continue
+			}
+			if err := enc.Encode(e.event); err != nil {
+				atomic.AddUint64(&s.failed, 1)
+				continue
+			}
+			count++
+			if count >= s.config.BatchSize {
+				publish()
+			}
+		case <-ticker.C:
+			publish()
+		}
+	}
+}
+
+// WriteEvent buffers the event, when the buffer is full it waits for room or for ctx to be done if the sink blocks,
+// otherwise the event is dropped
+func (s *PublisherSink) WriteEvent(ctx context.Context, event QueryEvent) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		atomic.AddUint64(&s.dropped, 1)
+		return ErrSinkClosed
+	}
+
+	select {
+	case s.events <- publisherEntry{event: event}:
+		return nil
+	default:
+	}
+	if !s.config.Block {
+		atomic.AddUint64(&s.dropped, 1)
+		return nil
+	}
+
+	select {
+	case s.events <- publisherEntry{event: event}:
+		return nil
+	case <-ctx.Done():
+		atomic.AddUint64(&s.dropped, 1)
+		return ctx.Err()
+	}
+}
+
+// Flush waits until the events buffered so far are published, or returns the error of ctx if it is done first
+func (s *PublisherSink) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil
+	}
+	select {
+	case s.events <- publisherEntry{flushed: flushed}:
+	case <-ctx.Done():
+		s.mu.RUnlock()
+		return ctx.Err()
+	}
+	s.mu.RUnlock()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns the number of events dropped so far because the buffer was full or the sink closed
+func (s *PublisherSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Failed returns the number of events lost so far because they could not be encoded or published
+func (s *PublisherSink) Failed() uint64 {
+	return atomic.LoadUint64(&s.failed)
+}
+
+// Close stops the sink once the buffered events are published, events written afterwards are dropped
+func (s *PublisherSink) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+}
@@ -0,0 +1,95 @@
+package instrumentedsql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPublisherSink(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]byte
+	publisher := PublisherFunc(func(ctx context.Context, batch []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, batch)
+		return nil
+	})
+	sink := NewPublisherSink(publisher, PublisherConfig{BatchSize: 2, FlushInterval: time.Hour})
+	defer sink.Close()
+	d := WrapDriver(&fakeDriver{}, WithEventSink(sink), WithOpsExcluded(OpSQLConnOpen, OpSQLConnClose)).(wrappedDriver)
+	db := openBenchDB(t, d, "")
+
+	for n := 0; n < 3; n++ {
+		if _, err := db.ExecContext(context.Background(), "UPDATE t SET n = ?", n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 2 {
+		t.Fatalf("published %d batches, want a full one and the flushed one", len(batches))
+	}
+	lines := bytes.Split(bytes.TrimSpace(batches[0]), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("first batch has %d events, want 2", len(lines))
+	}
+	var event QueryEvent
+	if err := json.Unmarshal(lines[1], &event); err != nil || event.Op != string(OpSQLConnExec) {
+		t.Errorf("event is %+v, %v", event, err)
+	}
+}
+
+func TestPublisherSinkBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	var failures int
+	publisher := PublisherFunc(func(ctx context.Context, batch []byte) error {
+		<-release
+		return errors.New("broker unavailable")
+	})
+
+	for _, block := range []bool{false, true} {
+		sink := NewPublisherSink(publisher, PublisherConfig{BatchSize: 1, BufferSize: 1, Block: block, OnError: func(error) { failures++ }})
+
+		// The first event is being published, the second one is buffered
+		if err := sink.WriteEvent(context.Background(), QueryEvent{}); err != nil {
+			t.Fatal(err)
+		}
+		for len(sink.events) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if err := sink.WriteEvent(context.Background(), QueryEvent{}); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := sink.WriteEvent(ctx, QueryEvent{})
+		cancel()
+		if block && err != context.DeadlineExceeded || !block && err != nil {
+			t.Errorf("block %v: writing to a full sink returned %v", block, err)
+		}
+		if sink.Dropped() != 1 {
+			t.Errorf("block %v: dropped %d events, want 1", block, sink.Dropped())
+		}
+
+		go func() {
+			for n := 0; n < 2; n++ {
+				release <- struct{}{}
+			}
+		}()
+		sink.Close()
+		if sink.Failed() != 2 {
+			t.Errorf("block %v: %d events failed, want 2", block, sink.Failed())
+		}
+	}
+	if failures != 4 {
+		t.Errorf("OnError was called %d times, want 4", failures)
+	}
+}
@@ -0,0 +1,212 @@
+package instrumentedsql
+
+import (
+	"container/list"
+	"context"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueryCacheStats counts the lookups in the query cache, see WithQueryCache
+type QueryCacheStats struct {
+	// Hits is the number of queries served from the cache
+	Hits int64
+	// Misses is the number of cacheable queries run on the parent connection, including the ones whose entry had expired
+	Misses int64
+	// Evictions is the number of entries removed to make room for new ones
+	Evictions int64
+	// Entries is the number of results in the cache
+	Entries int64
+}
+
+// Cached returns a copy of ctx whose SELECTs can be served from the query cache for up to ttl, see WithQueryCache.
+// It is meant for hot queries of reference data that can be slightly stale, results are not invalidated by writes.
+func Cached(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, cacheTTLKey, ttl)
+}
+
+// contextCacheTTL returns the time to live set on ctx by Cached, ctx may be nil for the legacy driver methods
+func contextCacheTTL(ctx context.Context) time.Duration {
+	if ctx == nil {
+		return 0
+	}
+
+	ttl, _ := ctx.Value(cacheTTLKey).(time.Duration)
+	return ttl
+}
+
+// queryCache holds the results of queries by query and args, the least recently used are evicted first
+type queryCache struct {
+	size    int
+	maxRows int
+	stats   QueryCacheStats
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds *cachedResult, the most recently used first
+	lru list.List
+}
+
+// cachedResult is the result of a query, it is not modified once cached
+type cachedResult struct {
+	key     string
+	columns []string
+	rows    [][]driver.Value
+	expires time.Time
+}
+
+func newQueryCache(size, maxRows int) *queryCache {
+	return &queryCache{size: size, maxRows: maxRows, entries: make(map[string]*list.Element, size)}
+}
+
+// get returns the result cached for key if it has not expired
+func (c *queryCache) get(key string) (*cachedResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		atomic.AddInt64(&c.stats.Misses, 1)
+		return nil, false
+	}
+	result := e.Value.(*cachedResult)
+	if time.Now().After(result.expires) {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+		atomic.AddInt64(&c.stats.Misses, 1)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(e)
+	atomic.AddInt64(&c.stats.Hits, 1)
+	return result, true
+}
+
+// put caches result, replacing the one cached for the same key if any
+func (c *queryCache) put(result *cachedResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[result.key]; ok {
+		c.lru.Remove(e)
+	}
+	c.entries[result.key] = c.lru.PushFront(result)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Remove(c.lru.Back()).(*cachedResult)
+		delete(c.entries, oldest.key)
+		atomic.AddInt64(&c.stats.Evictions, 1)
+	}
+}
+
+func (c *queryCache) snapshot() QueryCacheStats {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+
+	return QueryCacheStats{
+		Hits:      atomic.LoadInt64(&c.stats.Hits),
+		Misses:    atomic.LoadInt64(&c.stats.Misses),
+		Evictions: atomic.LoadInt64(&c.stats.Evictions),
+		Entries:   int64(entries),
+	}
+}
+
+// cacheable returns the time to live of the result of query if it can be cached, 0 otherwise.
+// Queries run in transactions are not cached, as they may read their own writes.
+func (c *wrappedConn) cacheable(ctx context.Context, query string) time.Duration {
+	if c.queryCache == nil || c.inTx {
+		return 0
+	}
+	ttl := contextCacheTTL(ctx)
+	if ttl <= 0 || parseStatement(query).verb != statementSelect {
+		return 0
+	}
+
+	return ttl
+}
+
+// cacheKey returns the key of the result of query run with args on the connection, results are not shared across DSNs
+// as they may connect to different databases
+func (c *wrappedConn) cacheKey(query string, args []driver.NamedValue) string {
+	return c.dsn + "\x00" + duplicateKey(query, args)
+}
+
+// cacheRows returns rows caching their result under key for ttl once they were all fetched, or rows if ttl is 0
+func (c *wrappedConn) cacheRows(ttl time.Duration, key string, rows driver.Rows) driver.Rows {
+	if ttl == 0 {
+		return rows
+	}
+
+	return &cachingRows{Rows: rows, cache: c.queryCache, result: &cachedResult{key: key, expires: time.Now().Add(ttl)}}
+}
+
+// cachedRows serves a cached result
+type cachedRows struct {
+	result *cachedResult
+	next   int
+}
+
+func (r *cachedRows) Columns() []string {
+	return r.result.columns
+}
+
+func (r *cachedRows) Close() error {
+	return nil
+}
+
+func (r *cachedRows) Next(dest []driver.Value) error {
+	if r.next == len(r.result.rows) {
+		return io.EOF
+	}
+	for n, v := range r.result.rows[r.next] {
+		// Callers may modify the bytes they scan, such as into sql.RawBytes
+		if b, ok := v.([]byte); ok {
+			v = append([]byte(nil), b...)
+		}
+		dest[n] = v
+	}
+	r.next++
+
+	return nil
+}
+
+// cachingRows records the rows fetched from the parent driver, the result is cached once they were all fetched
+// unless there were more than the maximum rows per result
+type cachingRows struct {
+	driver.Rows
+	cache  *queryCache
+	result *cachedResult
+	// skip is set once the result was cached, or once more rows than can be cached were fetched
+	skip bool
+}
+
+func (r *cachingRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch {
+	case err == io.EOF:
+		if !r.skip {
+			r.result.columns = r.Columns()
+			r.cache.put(r.result)
+			r.skip = true
+		}
+	case err != nil || r.skip:
+	case r.cache.maxRows > 0 && len(r.result.rows) == r.cache.maxRows:
+		r.skip = true
+		r.result.rows = nil
+	default:
+		row := make([]driver.Value, len(dest))
+		for n, v := range dest {
+			// Drivers may reuse the buffers of the values of the previous row
+			if b, ok := v.([]byte); ok {
+				v = append([]byte(nil), b...)
+			}
+			row[n] = v
+		}
+		r.result.rows = append(r.result.rows, row)
+	}
+
+	return err
+}
@@ -0,0 +1,141 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestQueryCache(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	d := WrapDriver(&fakeDriver{rows: 3}, WithLogger(logger), WithQueryCache(1, 3)).(wrappedDriver)
+	db := openBenchDB(t, d, "")
+	cached := Cached(context.Background(), time.Hour)
+
+	count := func(ctx context.Context, query string, args ...interface{}) int {
+		t.Helper()
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var n, last int
+		for ; rows.Next(); n++ {
+			if err := rows.Scan(&last); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n > 0 && last != 0 {
+			t.Errorf("last row is %d, want 0", last)
+		}
+		return n
+	}
+
+	for n := 0; n < 3; n++ {
+		if got := count(cached, "SELECT n FROM t WHERE id = ?", 1); got != 3 {
+			t.Fatalf("query returned %d rows, want 3", got)
+		}
+	}
+	// Not marked as cacheable
+	count(context.Background(), "SELECT n FROM t WHERE id = ?", 1)
+	// Other args evict the first result
+	count(cached, "SELECT n FROM t WHERE id = ?", 2)
+	count(cached, "SELECT n FROM t WHERE id = ?", 1)
+
+	want := QueryCacheStats{Hits: 2, Misses: 3, Evictions: 2, Entries: 1}
+	if got := d.QueryCacheStats(); got != want {
+		t.Errorf("stats are %+v, want %+v", got, want)
+	}
+
+	var labels []interface{}
+	for _, op := range logger.Find(string(OpSQLConnQuery)) {
+		labels = append(labels, op.Labels["query_cache"])
+	}
+	if len(labels) != 6 || labels[0] != "miss" || labels[1] != "hit" || labels[3] != nil {
+		t.Errorf("query_cache labels are %v", labels)
+	}
+
+	tx, err := db.BeginTx(cached, &sql.TxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 2; n++ {
+		rows, err := tx.QueryContext(cached, "SELECT n FROM t WHERE id = ?", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.QueryCacheStats(); got != want {
+		t.Errorf("queries in transactions changed the stats to %+v", got)
+	}
+}
+
+func TestQueryCacheDSNs(t *testing.T) {
+	d := WrapDriver(&fakeDriver{rows: 3}, WithQueryCache(10, 0)).(wrappedDriver)
+	cached := Cached(context.Background(), time.Hour)
+	for _, dsn := range []string{"db1", "db2"} {
+		rows, err := openBenchDB(t, d, dsn).QueryContext(cached, "SELECT n FROM t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+	}
+
+	if got := d.QueryCacheStats(); got.Hits != 0 || got.Entries != 2 {
+		t.Errorf("stats are %+v, want a result per DSN", got)
+	}
+}
+
+func TestCachedRowsCopyBytes(t *testing.T) {
+	result := &cachedResult{columns: []string{"b"}, rows: [][]driver.Value{{[]byte("abc")}}}
+	dest := make([]driver.Value, 1)
+	if err := (&cachedRows{result: result}).Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	dest[0].([]byte)[0] = 'x'
+
+	if err := (&cachedRows{result: result}).Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(dest[0].([]byte)); got != "abc" {
+		t.Errorf("cached value is %q after the caller modified it, want abc", got)
+	}
+}
+
+func TestQueryCacheLimits(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		maxRows int
+		ttl     time.Duration
+	}{
+		{name: "too many rows", maxRows: 2, ttl: time.Hour},
+		{name: "expired", ttl: time.Nanosecond},
+	} {
+		d := WrapDriver(&fakeDriver{rows: 3}, WithQueryCache(10, test.maxRows)).(wrappedDriver)
+		db := openBenchDB(t, d, "")
+		for n := 0; n < 2; n++ {
+			rows, err := db.QueryContext(Cached(context.Background(), test.ttl), "SELECT n FROM t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rows.Next() {
+			}
+			rows.Close()
+		}
+
+		if got := d.QueryCacheStats(); got.Hits != 0 || got.Misses != 2 {
+			t.Errorf("%s: stats are %+v, want only misses", test.name, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package instrumentedsql
+
+import (
+	"database/sql/driver"
+	"sort"
+	"sync"
+)
+
+// DriverInfo describes a driver wrapped with WithDBName and its statistics, see Drivers
+type DriverInfo struct {
+	// Name is the name passed to WithDBName
+	Name string
+	// System is the database system of the parent driver, see WithDBSystem
+	System string
+	// Driver is the wrapped driver
+	Driver driver.Driver
+
+	Stats               []QueryStats
+	StatementCacheStats StatementCacheStats
+	QueryCacheStats     QueryCacheStats
+	PingStats           PingStats
+}
+
+// wrappedDrivers holds the drivers wrapped with WithDBName by name
+var wrappedDrivers = struct {
+	sync.Mutex
+	byName map[string]wrappedDriver
+}{byName: map[string]wrappedDriver{}}
+
+func registerDriver(d wrappedDriver) {
+	wrappedDrivers.Lock()
+	defer wrappedDrivers.Unlock()
+
+	wrappedDrivers.byName[d.dbName] = d
+}
+
+// Drivers returns the drivers wrapped in the process with WithDBName along with their statistics, sorted by name,
+// so that services wrapping several drivers can report on all of them. Only the last driver wrapped with a name is returned.
+func Drivers() []DriverInfo {
+	wrappedDrivers.Lock()
+	drivers := make([]wrappedDriver, 0, len(wrappedDrivers.byName))
+	for _, d := range wrappedDrivers.byName {
+		drivers = append(drivers, d)
+	}
+	wrappedDrivers.Unlock()
+
+	infos := make([]DriverInfo, len(drivers))
+	for n, d := range drivers {
+		infos[n] = DriverInfo{
+			Name:                d.dbName,
+			System:              d.dbSystem,
+			Driver:              d,
+			Stats:               d.Stats(),
+			StatementCacheStats: d.StatementCacheStats(),
+			QueryCacheStats:     d.QueryCacheStats(),
+			PingStats:           d.PingStats(),
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return infos
+}
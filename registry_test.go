@@ -0,0 +1,36 @@
+package instrumentedsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestDrivers(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	orders := WrapDriver(&fakeDriver{api: fakeBareAPI}, WithLogger(logger), WithDBName("test-orders"), WithDBSystem("postgresql"))
+	WrapDriver(&fakeDriver{}, WithQueryStats(), WithDBName("test-users"))
+	WrapDriver(&fakeDriver{}, WithLogger(logger))
+
+	db := openBenchDB(t, orders, "")
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Logged outside of an operation, the identity of the driver is added to it
+	ping := logger.Find(string(OpSQLDummyPing))
+	if len(ping) != 1 || ping[0].Labels["db"] != "test-orders" || ping[0].Labels["db_system"] != "postgresql" {
+		t.Errorf("dummy ping logged as %+v", ping)
+	}
+
+	found := map[string]DriverInfo{}
+	for _, info := range Drivers() {
+		found[info.Name] = info
+	}
+	if info := found["test-orders"]; info.System != "postgresql" || info.Driver != orders || info.Stats != nil {
+		t.Errorf("got %+v for test-orders", info)
+	}
+	if _, ok := found["test-users"]; !ok {
+		t.Errorf("test-users is not listed in %+v", found)
+	}
+}
@@ -0,0 +1,98 @@
+package instrumentedsql
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowQueryReporter periodically reports the slowest query fingerprints of the last interval, see WithSlowQueryReport
+type slowQueryReporter struct {
+	interval time.Duration
+	n        int
+	report   func([]QueryStats)
+
+	mu      sync.Mutex
+	current *queryStats
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	// stopped is closed once run reported the last interval and returned
+	stopped chan struct{}
+}
+
+func newSlowQueryReporter(interval time.Duration, n int, buckets []time.Duration, maxFingerprints int, report func([]QueryStats)) *slowQueryReporter {
+	return &slowQueryReporter{interval: interval, n: n, report: report, current: newQueryStats(buckets, maxFingerprints),
+		stop: make(chan struct{}), stopped: make(chan struct{})}
+}
+
+// record adds an execution to the statistics of the current interval
+func (r *slowQueryReporter) record(x execution) {
+	r.mu.Lock()
+	current := r.current
+	r.mu.Unlock()
+
+	current.record(x)
+}
+
+// run reports the slowest queries at every interval until the reporter is closed
+func (r *slowQueryReporter) run() {
+	defer close(r.stopped)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.reportInterval()
+		case <-r.stop:
+			r.reportInterval()
+			return
+		}
+	}
+}
+
+// close stops the reporter once it reported the interval in progress, or returns the error of ctx if it is done first
+func (r *slowQueryReporter) close(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.stop) })
+
+	select {
+	case <-r.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reportInterval reports the slowest queries since the last call and starts a new interval
+func (r *slowQueryReporter) reportInterval() {
+	r.mu.Lock()
+	last := r.current
+	r.current = newQueryStats(last.buckets, last.maxFingerprints)
+	r.mu.Unlock()
+
+	stats := last.snapshot()
+	if len(stats) == 0 {
+		return
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].P99 > stats[j].P99 })
+	if r.n > 0 && len(stats) > r.n {
+		stats = stats[:r.n]
+	}
+
+	r.report(stats)
+}
+
+// logSlowQueries returns a report function writing one log message per query to l
+func logSlowQueries(l Logger) func([]QueryStats) {
+	return func(stats []QueryStats) {
+		for n, s := range stats {
+			l.Log(context.Background(), "sql-slow-query-report",
+				"rank", n+1, "fingerprint", s.Fingerprint, "count", s.Count, "errors", s.Errors,
+				"p50", s.P50, "p95", s.P95, "p99", s.P99, "max", s.Max)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package instrumentedsql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSlowQueryReport(t *testing.T) {
+	cases := []struct {
+		n    int
+		want []string
+	}{
+		{n: 2, want: []string{"SELECT c", "SELECT b"}},
+		{n: 0, want: []string{"SELECT c", "SELECT b", "SELECT a"}},
+		{n: -1, want: []string{"SELECT c", "SELECT b", "SELECT a"}},
+	}
+
+	for _, tc := range cases {
+		var reports [][]string
+		r := newSlowQueryReporter(time.Hour, tc.n, defaultLatencyBuckets, 0, func(stats []QueryStats) {
+			var fingerprints []string
+			for _, s := range stats {
+				fingerprints = append(fingerprints, s.Fingerprint)
+			}
+			reports = append(reports, fingerprints)
+		})
+		go r.run()
+
+		r.record(execution{fingerprint: "SELECT a", duration: time.Millisecond})
+		r.record(execution{fingerprint: "SELECT b", duration: 100 * time.Millisecond})
+		r.record(execution{fingerprint: "SELECT c", duration: time.Second})
+		if err := r.close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := [][]string{tc.want}; !reflect.DeepEqual(reports, want) {
+			t.Errorf("n = %d reported %q, want %q", tc.n, reports, want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package instrumentedsql
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy configures the retries of queries failing with transient errors, see WithRetry
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a query is run at most, including the first one
+	MaxAttempts int
+	// Retryable reports whether a query failing with err should be retried,
+	// by default serialization failures and deadlocks are, as classified by DefaultErrorClassifier
+	Retryable func(err error) bool
+	// Backoff returns how long to wait before the passed attempt, starting at 2,
+	// by default 10ms doubled for every attempt
+	Backoff func(attempt int) time.Duration
+}
+
+// retryableByDefault reports whether err is a serialization failure or a deadlock
+func retryableByDefault(err error) bool {
+	return DefaultErrorClassifier(err) == ErrorCategorySerialization
+}
+
+// backoffByDefault waits 10ms before the second attempt, doubling for every following one
+func backoffByDefault(attempt int) time.Duration {
+	return 10 * time.Millisecond << uint(attempt-2)
+}
+
+// retry runs attempt until it succeeds, fails with an error that is not retryable, the attempts run out or ctx is done.
+// Queries are not retried within transactions, the whole transaction would have to be.
+func (c *wrappedConn) retry(ctx context.Context, attempt func(attempt int) error) error {
+	for n := 1; ; n++ {
+		err := attempt(n)
+		if err == nil || c.retryPolicy == nil || c.inTx || n >= c.retryPolicy.MaxAttempts || !c.retryPolicy.Retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(c.retryPolicy.Backoff(n + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package instrumentedsql
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Retryable: retryableByDefault, Backoff: func(int) time.Duration { return 0 }}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		inTx     bool
+		attempts int
+	}{
+		{"success", []error{nil}, false, 1},
+		{"retried", []error{sqlStateErr("40001"), nil}, false, 2},
+		{"attempts exhausted", []error{sqlStateErr("40P01"), sqlStateErr("40P01"), sqlStateErr("40P01"), nil}, false, 3},
+		{"not retryable", []error{sqlStateErr("23505"), nil}, false, 1},
+		{"in transaction", []error{sqlStateErr("40001"), nil}, true, 1},
+	}
+
+	for _, test := range tests {
+		c := &wrappedConn{opts: &opts{retryPolicy: &policy}, inTx: test.inTx}
+
+		attempts := 0
+		err := c.retry(context.Background(), func(attempt int) error {
+			attempts++
+			if attempt != attempts {
+				t.Errorf("%s: attempt %d, want %d", test.name, attempt, attempts)
+			}
+			return test.errs[attempt-1]
+		})
+
+		if attempts != test.attempts {
+			t.Errorf("%s: %d attempts, want %d", test.name, attempts, test.attempts)
+		}
+		if want := test.errs[attempts-1]; err != want {
+			t.Errorf("%s: err = %v, want %v", test.name, err, want)
+		}
+	}
+}
+
+func TestBackoffByDefault(t *testing.T) {
+	if got := backoffByDefault(2); got != 10*time.Millisecond {
+		t.Errorf("backoffByDefault(2) = %v, want 10ms", got)
+	}
+	if got := backoffByDefault(4); got != 40*time.Millisecond {
+		t.Errorf("backoffByDefault(4) = %v, want 40ms", got)
+	}
+}
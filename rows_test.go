@@ -0,0 +1,69 @@
+package instrumentedsql
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestRowsEvents(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	tr := instrumentedsqltest.NewTracer()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{rows: 2}, WithLogger(logger), WithTracer(tr)), "")
+
+	if err := countRows(db.Query("SELECT a FROM t")); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	for _, span := range tr.Spans() {
+		if strings.HasPrefix(span.Name, "("+string(OpSQLConnQuery)+")") {
+			events = span.Events
+		}
+	}
+	if !reflect.DeepEqual(events, []string{"first_row", "rows_closed"}) {
+		t.Errorf("query span has events %q", events)
+	}
+	op := logger.AssertQuery(t, "SELECT a FROM t")
+	if op.Labels["first_row"] == nil || op.Labels["rows_closed"] == nil {
+		t.Errorf("query logged with labels %v", op.Labels)
+	}
+}
+
+func TestRowsCloseErrors(t *testing.T) {
+	closeErr := errors.New("truncated")
+	nextErr := errors.New("protocol error")
+
+	tests := []struct {
+		name     string
+		driver   *fakeDriver
+		err      error
+		closeErr interface{}
+	}{
+		{name: "close", driver: &fakeDriver{rows: 2, closeErr: closeErr}, err: closeErr},
+		{name: "next and close", driver: &fakeDriver{rows: 2, nextErr: nextErr, closeErr: closeErr}, err: nextErr, closeErr: closeErr.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			db := openBenchDB(t, WrapDriver(tt.driver, WithLogger(logger)), "")
+
+			rows, err := db.Query("SELECT a FROM t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rows.Next() {
+			}
+			rows.Close()
+
+			op := logger.AssertQuery(t, "SELECT a FROM t")
+			if op.Err != tt.err || op.Labels["close_err"] != tt.closeErr || op.Labels["close_duration"] == nil {
+				t.Errorf("query logged with error %v and labels %v", op.Err, op.Labels)
+			}
+		})
+	}
+}
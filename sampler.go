@@ -0,0 +1,16 @@
+package instrumentedsql
+
+import (
+	"context"
+	"math/rand"
+)
+
+// Sampler decides whether an operation gets instrumented, see WithSampler
+type Sampler func(ctx context.Context, op Op, query string) bool
+
+// ProbabilitySampler returns a sampler instrumenting the given fraction of operations, between 0 and 1
+func ProbabilitySampler(fraction float64) Sampler {
+	return func(ctx context.Context, op Op, query string) bool {
+		return fraction >= 1 || rand.Float64() < fraction
+	}
+}
@@ -0,0 +1,81 @@
+package instrumentedsql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+// selectSampler keeps the operations running a SELECT
+func selectSampler(ctx context.Context, op Op, query string) bool {
+	return strings.HasPrefix(query, "SELECT")
+}
+
+func TestSampler(t *testing.T) {
+	deadlock := errors.New("deadlock")
+	cases := []struct {
+		name      string
+		driver    *fakeDriver
+		threshold time.Duration
+		query     string
+		wantLog   bool
+		wantSpan  bool
+	}{
+		{name: "sampled in", driver: &fakeDriver{}, query: "SELECT a FROM t", wantLog: true, wantSpan: true},
+		{name: "sampled out", driver: &fakeDriver{}, query: "UPDATE t SET a = 1"},
+		{name: "sampled out failing", driver: &fakeDriver{execErr: deadlock}, query: "UPDATE t SET a = 1", wantLog: true},
+		{name: "sampled out slow", driver: &fakeDriver{}, threshold: time.Nanosecond, query: "UPDATE t SET a = 1", wantLog: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			tr := instrumentedsqltest.NewTracer()
+			d := WrapDriver(tc.driver, WithLogger(logger), WithTracer(tr), WithSampler(selectSampler), WithSlowQueryThreshold(tc.threshold, nil))
+			db := openBenchDB(t, d, "")
+
+			db.Exec(tc.query)
+
+			var logged, traced bool
+			for _, op := range logger.Ops() {
+				logged = logged || op.Query == tc.query
+			}
+			for _, span := range tr.Spans() {
+				traced = traced || span.Labels["query"] == tc.query
+			}
+			if logged != tc.wantLog || traced != tc.wantSpan {
+				t.Errorf("logged %t and traced %t, want %t and %t", logged, traced, tc.wantLog, tc.wantSpan)
+			}
+		})
+	}
+}
+
+func TestProbabilitySampler(t *testing.T) {
+	cases := []struct {
+		fraction float64
+		min, max int
+	}{
+		{fraction: -1, min: 0, max: 0},
+		{fraction: 0, min: 0, max: 0},
+		{fraction: 0.5, min: 400, max: 600},
+		{fraction: 1, min: 1000, max: 1000},
+		{fraction: 2, min: 1000, max: 1000},
+	}
+
+	for _, tc := range cases {
+		sampler := ProbabilitySampler(tc.fraction)
+		kept := 0
+		for n := 0; n < 1000; n++ {
+			if sampler(context.Background(), OpSQLConnExec, "UPDATE t SET a = 1") {
+				kept++
+			}
+		}
+		if kept < tc.min || kept > tc.max {
+			t.Errorf("ProbabilitySampler(%v) kept %d operations out of 1000, want between %d and %d", tc.fraction, kept, tc.min, tc.max)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package instrumentedsql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/away-team/go-tracer/tracer"
+)
+
+// savepoint is a savepoint of the transaction in progress on a connection, it is instrumented as a sql-savepoint operation
+// whose span is the parent of the operations run until it is released or rolled back to
+type savepoint struct {
+	name string
+	call *opCall
+}
+
+// trackSavepoint starts or ends the instrumentation of savepoints once query ran successfully in a transaction
+func (c *wrappedConn) trackSavepoint(ctx context.Context, query string) {
+	lex := sqlLexer{query: query}
+	switch strings.ToUpper(lex.nextWord()) {
+	case "SAVEPOINT":
+		name := lex.nextWord()
+		call := c.startOp(ctx, nil, OpSQLSavepoint, query, nil)
+		call.setLabel("savepoint", name)
+		c.savepoints = append(c.savepoints, savepoint{name: name, call: call})
+	case "RELEASE":
+		c.endSavepoint(lex.nextWordSkipping("SAVEPOINT"), "released")
+	case "ROLLBACK":
+		if isOneOf(lex.nextWordSkipping("WORK", "TRANSACTION"), "TO") {
+			// The savepoint still exists afterwards, but the operations run from now on are no longer part of it
+			c.endSavepoint(lex.nextWordSkipping("SAVEPOINT"), "rolled_back")
+		}
+	}
+}
+
+// endSavepoint finishes the savepoint called name and the ones created after it
+func (c *wrappedConn) endSavepoint(name, outcome string) {
+	for n := len(c.savepoints) - 1; n >= 0; n-- {
+		if strings.EqualFold(c.savepoints[n].name, name) {
+			c.endSavepoints(n, outcome)
+			return
+		}
+	}
+}
+
+// endSavepoints finishes the savepoints from the nth one on, the most recent first
+func (c *wrappedConn) endSavepoints(n int, outcome string) {
+	for i := len(c.savepoints) - 1; i >= n; i-- {
+		c.savepoints[i].call.setLabel("outcome", outcome)
+		c.savepoints[i].call.finish(nil)
+	}
+	c.savepoints = c.savepoints[:n]
+}
+
+// txParentSpan returns the parent of the spans of operations run in the transaction in progress,
+// the most recent savepoint if any
+func (c *wrappedConn) txParentSpan() tracer.Span {
+	for n := len(c.savepoints) - 1; n >= 0; n-- {
+		if span := c.savepoints[n].call.span; span != nil {
+			return span
+		}
+	}
+
+	return c.txSpan
+}
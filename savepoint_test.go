@@ -0,0 +1,37 @@
+package instrumentedsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestSavepoints(t *testing.T) {
+	tr := instrumentedsqltest.NewTracer()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithTracer(tr)), "")
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		"SAVEPOINT outer_sp",
+		"INSERT INTO a VALUES (1)",
+		`SAVEPOINT "inner_sp"`,
+		"INSERT INTO b VALUES (1)",
+		"ROLLBACK TO SAVEPOINT inner_sp",
+		"RELEASE outer_sp",
+		"SAVEPOINT last_sp",
+	} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr.AssertGolden(t, "testdata/savepoints.golden", "conn_id", "component")
+}
@@ -0,0 +1,67 @@
+package instrumentedsql
+
+import (
+	"math"
+	"regexp"
+)
+
+// minSecretLength and minSecretEntropy are the length and entropy in bits per character
+// from which a token is considered to be a secret, such as a generated API key
+const (
+	minSecretLength  = 20
+	minSecretEntropy = 4.0
+)
+
+// secretPatterns match known kinds of secrets, the whole match is masked
+var secretPatterns = []*regexp.Regexp{
+	// Private keys in PEM format
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	// Passwords of connection strings, such as the ones passed to dblink
+	regexp.MustCompile(`(?i)\b(?:password|passwd|pwd)\s*=\s*[^\s';]+`),
+	// Tokens of well known services, whose prefix tells what they are
+	regexp.MustCompile(`\b(?:AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|xox[abprs]-[A-Za-z0-9-]{10,}|[sr]k_(?:live|test)_[A-Za-z0-9]{16,})\b`),
+}
+
+// secretToken matches the tokens whose entropy is checked
+var secretToken = regexp.MustCompile(`[A-Za-z0-9+/_=-]{20,}`)
+
+// maskSecrets returns query with the secrets it contains replaced by [secret], see WithSecretScanning
+func maskSecrets(query string) string {
+	for _, re := range secretPatterns {
+		query = re.ReplaceAllString(query, "[secret]")
+	}
+
+	return secretToken.ReplaceAllStringFunc(query, func(token string) string {
+		if len(token) < minSecretLength || entropy(token) < minSecretEntropy {
+			return token
+		}
+		return "[secret]"
+	})
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+
+	return h
+}
+
+// shownQuery returns query as recorded in spans and logs, with its secrets masked if WithSecretScanning is used
+func (o *opts) shownQuery(query string) string {
+	if !o.secretScanning || query == "" {
+		return query
+	}
+
+	return maskSecrets(query)
+}
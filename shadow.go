@@ -0,0 +1,145 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// shadowTimeout bounds the time spent running a single mirrored query
+const shadowTimeout = 10 * time.Second
+
+// maxShadowQueries is the number of mirrored queries run at once, queries are not mirrored while they are all in progress
+const maxShadowQueries = 16
+
+// Shadow configures the mirroring of read queries to a second database, such as a new major version being validated,
+// see WithShadow
+type Shadow struct {
+	// DB is the database the queries are mirrored to, it can be opened with another wrapped driver to trace them
+	DB *sql.DB
+	// Ratio is the share of the read queries mirrored, from 0 to 1
+	Ratio float64
+	// CompareRows makes the queries whose rows were all fetched diverge when the shadow returns a different number of rows
+	CompareRows bool
+	// MaxSlowdown makes the queries diverge when the shadow takes more than MaxSlowdown times as long,
+	// latency is not compared if it is 0
+	MaxSlowdown float64
+	// OnResult is called, if not nil, with the result of every mirrored query
+	OnResult func(ShadowResult)
+}
+
+// ShadowResult compares a query run on the primary database with its mirror, see Shadow
+type ShadowResult struct {
+	// Query is the query run on both databases, as rewritten by the hooks, see QueryRewriter
+	Query string
+	// Primary and Shadow are the time the query took on each database, including fetching its rows
+	Primary time.Duration
+	Shadow  time.Duration
+	// PrimaryRows and ShadowRows are the number of rows returned, PrimaryRows is -1 if they were not all fetched
+	PrimaryRows int64
+	ShadowRows  int64
+	// Err is the error of the mirrored query, if any
+	Err error
+	// Diverged is set if the shadow failed, or if it differed from the primary according to the Shadow options
+	Diverged bool
+}
+
+// shadower mirrors queries in the background, see WithShadow
+type shadower struct {
+	Shadow
+	slots chan struct{}
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	// running tracks the mirrored queries in progress, for Flush
+	running sync.WaitGroup
+}
+
+func newShadower(s Shadow) *shadower {
+	return &shadower{Shadow: s, slots: make(chan struct{}, maxShadowQueries), rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// maybeMirror runs the query call sent to the parent driver on the shadow database in the background if it is a read sampled by the ratio,
+// rows is the number of rows the primary returned or -1 if they were not all fetched.
+// SELECT INTO and locking reads are not mirrored, as they create tables or take locks on the shadow database.
+func (s *shadower) maybeMirror(call *opCall, rows int64) {
+	if call.conn.inTx || QueryAccess(call.parentQuery) != AccessRead || !s.sample() {
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		return
+	}
+
+	primary := time.Since(call.start)
+	// The args belong to database/sql once the query is done
+	args := append([]driver.NamedValue(nil), call.args...)
+	s.running.Add(1)
+	go func() {
+		defer func() {
+			<-s.slots
+			s.running.Done()
+		}()
+		s.mirror(call, args, primary, rows)
+	}()
+}
+
+func (s *shadower) sample() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rand.Float64() < s.Ratio
+}
+
+func (s *shadower) mirror(call *opCall, args []driver.NamedValue, primary time.Duration, primaryRows int64) {
+	result := ShadowResult{Query: call.parentQuery, Primary: primary, PrimaryRows: primaryRows}
+	start := time.Now()
+	result.ShadowRows, result.Err = s.run(call.parentQuery, args)
+	result.Shadow = time.Since(start)
+	result.Diverged = result.Err != nil ||
+		s.CompareRows && primaryRows >= 0 && result.ShadowRows != primaryRows ||
+		s.MaxSlowdown > 0 && float64(result.Shadow) > float64(primary)*s.MaxSlowdown
+
+	if result.Diverged {
+		keyvals := []interface{}{"query", call.shownQuery(call.parentQuery), "primary", result.Primary, "shadow", result.Shadow,
+			"primary_rows", result.PrimaryRows, "shadow_rows", result.ShadowRows}
+		if result.Err != nil {
+			keyvals = append(keyvals, "err", result.Err.Error())
+		}
+		call.events.Log(context.Background(), "sql-shadow-divergence", keyvals...)
+	}
+	if s.OnResult != nil {
+		s.OnResult(result)
+	}
+}
+
+// run runs query on the shadow database and returns the number of rows it returned
+func (s *shadower) run(query string, args []driver.NamedValue) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+
+	shadowArgs := make([]interface{}, len(args))
+	for n, arg := range args {
+		shadowArgs[n] = arg.Value
+		if arg.Name != "" {
+			shadowArgs[n] = sql.Named(arg.Name, arg.Value)
+		}
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, shadowArgs...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var n int64
+	for rows.Next() {
+		n++
+	}
+
+	return n, rows.Err()
+}
@@ -0,0 +1,124 @@
+package instrumentedsql
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestShadow(t *testing.T) {
+	var mu sync.Mutex
+	var results []ShadowResult
+	logger := instrumentedsqltest.NewLogger()
+	d := WrapDriver(&fakeDriver{rows: 2}, WithLogger(logger), WithShadow(Shadow{
+		DB:          openBenchDB(t, &fakeDriver{rows: 3}, ""),
+		Ratio:       1,
+		CompareRows: true,
+		OnResult: func(r ShadowResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, r)
+		},
+	})).(wrappedDriver)
+	db := openBenchDB(t, d, "")
+	ctx := context.Background()
+
+	// All the rows are fetched
+	rows, err := db.QueryContext(ctx, "SELECT n FROM t WHERE id = ?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	// Only the first row is fetched
+	rows, err = db.QueryContext(ctx, "SELECT n FROM t WHERE id = ?", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Next()
+	rows.Close()
+
+	// Writes are not mirrored
+	if _, err := db.ExecContext(ctx, "UPDATE t SET n = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("mirrored %d queries, want 2", len(results))
+	}
+	for _, r := range results {
+		if r.ShadowRows != 3 || r.Err != nil {
+			t.Errorf("shadow returned %d rows and %v", r.ShadowRows, r.Err)
+		}
+		if diverged := r.PrimaryRows == 2; r.Diverged != diverged {
+			t.Errorf("query with %d primary rows diverged: %v, want %v", r.PrimaryRows, r.Diverged, diverged)
+		}
+	}
+	if warnings := logger.Find("sql-shadow-divergence"); len(warnings) != 1 || warnings[0].Labels["shadow_rows"] != int64(3) {
+		t.Errorf("logged %+v, want a single divergence", warnings)
+	}
+}
+
+func TestShadowSkipsWritingSelects(t *testing.T) {
+	mirrored := 0
+	d := WrapDriver(&fakeDriver{}, WithShadow(Shadow{
+		DB:       openBenchDB(t, &fakeDriver{}, ""),
+		Ratio:    1,
+		OnResult: func(ShadowResult) { mirrored++ },
+	})).(wrappedDriver)
+	db := openBenchDB(t, d, "")
+	ctx := context.Background()
+
+	for _, query := range []string{"SELECT * INTO archive FROM t", "SELECT n FROM t FOR UPDATE", "SELECT n FROM t FOR SHARE"} {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+	}
+
+	if err := d.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if mirrored != 0 {
+		t.Errorf("mirrored %d queries, want none", mirrored)
+	}
+}
+
+func TestShadowRewrittenQuery(t *testing.T) {
+	shadow := &fakeDriver{rows: 1}
+	var results []ShadowResult
+	d := WrapDriver(&fakeDriver{rows: 1}, WithHooks(schemaRewriter{}), WithShadow(Shadow{
+		DB:       openBenchDB(t, shadow, ""),
+		Ratio:    1,
+		OnResult: func(r ShadowResult) { results = append(results, r) },
+	})).(wrappedDriver)
+	db := openBenchDB(t, d, "")
+
+	rows, err := db.Query("SELECT n FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The shadow runs the query the primary ran
+	if sent := shadow.sentQueries(); len(results) != 1 || results[0].Query != "SELECT n FROM tenant1.t" || !reflect.DeepEqual(sent, []string{"SELECT n FROM tenant1.t"}) {
+		t.Errorf("mirrored %+v, sent %q to the shadow, want the rewritten query", results, sent)
+	}
+}
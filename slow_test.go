@@ -0,0 +1,73 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestSlowQueryThreshold(t *testing.T) {
+	cases := []struct {
+		name      string
+		threshold time.Duration
+		want      []string
+	}{
+		{name: "slower than the threshold", threshold: time.Nanosecond, want: []string{"UPDATE t SET a = 1"}},
+		{name: "faster than the threshold", threshold: time.Hour},
+		{name: "no threshold"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var slow []string
+			fn := func(ctx context.Context, query string, args []driver.NamedValue, duration time.Duration) {
+				slow = append(slow, query)
+			}
+			db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithSlowQueryThreshold(tc.threshold, fn)), "")
+			if err := db.Ping(); err != nil {
+				t.Fatal(err)
+			}
+			slow = nil
+
+			if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(slow, tc.want) {
+				t.Errorf("reported slow queries %q, want %q", slow, tc.want)
+			}
+		})
+	}
+}
+
+func TestSlowQueryThresholdSampledOut(t *testing.T) {
+	cases := []struct {
+		name      string
+		threshold time.Duration
+		want      []string
+	}{
+		{name: "slower than the threshold", threshold: time.Nanosecond, want: []string{string(OpSQLConnExec)}},
+		{name: "faster than the threshold", threshold: time.Hour},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			dropAll := func(ctx context.Context, op Op, query string) bool { return false }
+			db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithSampler(dropAll), WithSlowQueryThreshold(tc.threshold, nil)), "")
+			if err := db.Ping(); err != nil {
+				t.Fatal(err)
+			}
+			logger.Reset()
+
+			// Slow operations left out by the sampler are logged without fn
+			if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+				t.Fatal(err)
+			}
+			logger.AssertNames(t, tc.want...)
+		})
+	}
+}
@@ -2,128 +2,519 @@ package instrumentedsql
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
-	"fmt"
+	"io"
+	"runtime/trace"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/kr/pretty"
 	"github.com/pkg/errors"
 
 	"github.com/away-team/go-tracer/tracer"
 )
 
 type wrappedDriver struct {
-	Logger
-	tracer.Tracer
+	*opts
 	parent driver.Driver
 }
 
 type wrappedConn struct {
-	Logger
-	tracer.Tracer
-	parent driver.Conn
+	*opts
+	// id identifies the connection among the ones opened by the driver, it is recorded as the conn_id label
+	id      uint64
+	idLabel string
+	dsn     string
+	parent  driver.Conn
+	caps    connCapabilities
+	// dsnInfo is what the DSN tells about the server, see WithDSNAttributes
+	dsnInfo *dsnInfo
+	// stmts caches the prepared statements of the connection, see WithStatementCache
+	stmts *stmtCache
+
+	// checkouts is the number of times the connection was taken from the pool of database/sql
+	checkouts int64
+	// opened is when the connection was opened
+	opened time.Time
+	// queries, errors and txs count the statements run on the connection, the operations that failed
+	// and the transactions begun, for the summary recorded when it is closed. They are accessed atomically.
+	queries int64
+	errors  int64
+	txs     int64
+	// hold tracks the transaction in progress on the connection, see WithConnHoldThreshold
+	hold *connHold
+	// inTx is set while a transaction is in progress on the connection, queries are not retried then
+	inTx bool
+	// txStart is when the transaction in progress began
+	txStart time.Time
+	// txTraceCtx is the context of the runtime/trace task of the transaction in progress, see WithRuntimeTrace
+	txTraceCtx context.Context
+
+	// txSpan is the span of the transaction in progress on the connection, if any
+	txSpan tracer.Span
+	// savepoints are the savepoints of the transaction in progress, the most recent last
+	savepoints []savepoint
+	// txQueries counts the executions of every query and args in the transaction in progress, see WithDuplicateQueryDetection
+	txQueries map[string]int
 }
 
 type wrappedTx struct {
-	Logger
-	tracer.Tracer
+	*opts
 	ctx    context.Context
+	conn   *wrappedConn
 	parent driver.Tx
+
+	// call is the instrumentation of the whole transaction, it is finished on Commit or Rollback
+	call *opCall
+	// leak is the timer of the leak detection, see WithTxLeakDetection
+	leak *time.Timer
+	// traceTask is the runtime/trace task of the transaction, see WithRuntimeTrace
+	traceTask *trace.Task
 }
 
 type wrappedStmt struct {
-	Logger
-	tracer.Tracer
+	*opts
 	ctx    context.Context
+	conn   *wrappedConn
 	query  string
 	parent driver.Stmt
+	caps   stmtCapabilities
+	// copy is set for COPY ... FROM STDIN statements, see copyExec
+	copy *copyState
+	// cached is set for statements shared through the statement cache of the connection, see WithStatementCache
+	cached *cachedStmt
+	// usage tracks the use of the statement from its prepare until it is closed
+	usage *stmtUsage
+}
+
+// stmtUsage is recorded when statements are closed, to spot statements prepared to be executed only once
+type stmtUsage struct {
+	prepared time.Time
+	// executions is accessed atomically
+	executions int64
 }
 
 type wrappedResult struct {
-	Logger
-	tracer.Tracer
+	*opts
 	ctx    context.Context
+	conn   *wrappedConn
 	parent driver.Result
 }
 
+// capturedResult is a result whose values were already fetched from the parent, see WithResultCapture
+type capturedResult struct {
+	lastInsertID    int64
+	lastInsertIDErr error
+	rowsAffected    int64
+	rowsAffectedErr error
+}
+
+// wrappedRows finishes the operation of its query when it is closed, so that it records the number of rows fetched
 type wrappedRows struct {
-	Logger
-	tracer.Tracer
+	*opts
 	ctx    context.Context
+	conn   *wrappedConn
+	query  string
 	parent driver.Rows
+
+	// queryCall is the instrumentation of the query that returned the rows, it is finished on Close
+	queryCall *opCall
+	// rowsCall is the aggregated instrumentation of the iteration, see WithRowsAggregation
+	rowsCall  *opCall
+	rowCount  int64
+	fetchTime time.Duration
+	fetchErr  error
+	// fetched is set once all the rows were fetched
+	fetched bool
+
+	// leak is the timer of the leak detection, see WithRowsLeakDetection
+	leak *time.Timer
 }
 
 // WrapDriver will wrap the passed SQL driver and return a new sql driver that uses it and also logs and traces calls using the passed logger and tracer
 // The returned driver will still have to be registered with the sql package before it can be used.
 //
+// When neither a logger nor a tracer are passed, nor any option acting on the operations themselves such as WithHooks,
+// the passed driver is returned as is, so that disabled instrumentation costs nothing.
+//
 // Important note: Seeing as the context passed into the various instrumentation calls this package calls,
-// Any call without a context passed will not be instrumented. Please be sure to use the ___Context() and BeginTx() function calls added in Go 1.8
-// instead of the older calls which do not accept a context.
-func WrapDriver(driver driver.Driver, opts ...Opt) driver.Driver {
-	d := wrappedDriver{parent: driver}
+// Any call without a context passed will not be instrumented, unless WithOrphanSpans is used. Please be sure to use the ___Context()
+// and BeginTx() function calls added in Go 1.8 instead of the older calls which do not accept a context.
+func WrapDriver(driver driver.Driver, options ...Opt) driver.Driver {
+	o := newOpts(driver, options)
+	if o == nil {
+		// Nothing would be recorded
+		return driver
+	}
 
-	for _, opt := range opts {
-		opt(&d)
+	d := wrappedDriver{opts: o, parent: driver}
+	d.startReporting()
+	if d.dbName != "" {
+		registerDriver(d)
 	}
 
-	if d.Logger == nil {
-		d.Logger = nullLogger{}
+	return d
+}
+
+// newOpts applies options and completes them with defaults, it returns nil if nothing would be recorded.
+// parent is the driver, connection or statement being wrapped. The background reporting is started by startReporting.
+func newOpts(parent interface{}, options []Opt) *opts {
+	o := &opts{}
+	for _, opt := range options {
+		opt(o)
 	}
-	if d.Tracer == nil {
-		d.Tracer = tracer.NewNullTracer()
+
+	if o.Logger == nil && o.Tracer == nil && !o.active() {
+		return nil
 	}
 
-	return d
+	if o.dbSystem == "" {
+		o.dbSystem = dbSystem(parent)
+	}
+	if o.Logger == nil {
+		o.Logger = nullLogger{}
+	}
+	if o.Tracer == nil {
+		o.Tracer = tracer.NewNullTracer()
+	}
+	o.events = o.eventLogger()
+	if o.namedArgs == nil && namedValueSystems[o.dbSystem] {
+		o.namedArgs = NamedArgsAsValues
+	}
+	if o.latencyBuckets == nil {
+		o.latencyBuckets = defaultLatencyBuckets
+	}
+	if o.stats != nil {
+		// WithLatencyBuckets and WithMaxFingerprints may come after WithQueryStats
+		o.stats = newQueryStats(o.latencyBuckets, o.maxFingerprints)
+	}
+	if o.circuitBreaker != nil {
+		o.hooks = append([]Hooks{newCircuitBreaker(*o.circuitBreaker, o.events)}, o.hooks...)
+	}
+	if o.slowQueryReportInterval > 0 {
+		report := o.slowQueryReportFunc
+		if report == nil {
+			report = logSlowQueries(o.events)
+		}
+		o.slowQueryReport = newSlowQueryReporter(o.slowQueryReportInterval, o.slowQueryReportN, o.latencyBuckets, o.maxFingerprints, report)
+	}
+	// EXPLAINs run on connections of their own, which only a driver can open
+	if d, ok := parent.(driver.Driver); ok && o.explainThreshold > 0 {
+		switch o.dbSystem {
+		case systemPostgres, systemMySQL:
+			o.explain = &explainer{parent: d, threshold: o.explainThreshold, interval: o.explainInterval}
+		}
+	}
+
+	return o
+}
+
+// Stats returns a snapshot of the statistics aggregated per query fingerprint, the queries that took the most time overall first.
+// It returns nil unless the driver was wrapped using WithQueryStats.
+func (d wrappedDriver) Stats() []QueryStats {
+	if d.stats == nil {
+		return nil
+	}
+
+	return d.stats.snapshot()
+}
+
+// PingStats returns the number of successful and failed pings of the connections,
+// they are all zero unless the driver was wrapped using WithPingMonitor
+func (d wrappedDriver) PingStats() PingStats {
+	if d.pings == nil {
+		return PingStats{}
+	}
+
+	return d.pings.snapshot()
+}
+
+// MissingTraceContexts returns the number of queries and transactions run without a span in their context,
+// it is zero unless the driver was wrapped using WithMissingTraceContext
+func (d wrappedDriver) MissingTraceContexts() int64 {
+	if d.missingTraceContext == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&d.missingTraceContext.count)
+}
+
+// QueryCacheStats returns the number of hits, misses and evictions of the query cache and the number of results it holds,
+// they are all zero unless the driver was wrapped using WithQueryCache
+func (d wrappedDriver) QueryCacheStats() QueryCacheStats {
+	if d.queryCache == nil {
+		return QueryCacheStats{}
+	}
+
+	return d.queryCache.snapshot()
+}
+
+// StatementCacheStats returns the number of hits, misses and evictions of the statement caches of the connections,
+// they are all zero unless the driver was wrapped using WithStatementCache
+func (d wrappedDriver) StatementCacheStats() StatementCacheStats {
+	if d.stmtCacheStats == nil {
+		return StatementCacheStats{}
+	}
+
+	return StatementCacheStats{
+		Hits:      atomic.LoadInt64(&d.stmtCacheStats.Hits),
+		Misses:    atomic.LoadInt64(&d.stmtCacheStats.Misses),
+		Evictions: atomic.LoadInt64(&d.stmtCacheStats.Evictions),
+	}
+}
+
+// Flush waits for the background work of the driver, such as EXPLAINs of slow queries and mirrored queries, to be done,
+// then flushes the event sink and the logger if they implement Flusher. It returns the error of ctx if it is done first.
+func (d wrappedDriver) Flush(ctx context.Context) error {
+	if d.explain != nil {
+		if err := wait(ctx, &d.explain.running); err != nil {
+			return err
+		}
+	}
+	if d.shadow != nil {
+		if err := wait(ctx, &d.shadow.running); err != nil {
+			return err
+		}
+	}
+
+	if flusher, ok := d.eventSink.(Flusher); ok {
+		if err := flusher.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := d.Logger.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+
+	return nil
+}
+
+// startReporting starts the background reporting of the slow queries if configured, it is stopped by Shutdown
+func (o *opts) startReporting() {
+	if o.slowQueryReport != nil {
+		go o.slowQueryReport.run()
+	}
+}
+
+// wait waits for wg unless ctx is done first
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops the background reporting of the driver, reporting the slow queries of the interval in progress,
+// then flushes it, see Flush. It is meant to be called once the databases using the driver are closed, when the service stops,
+// so that the telemetry of its last queries is not lost. It returns the error of ctx if it is done first.
+func (d wrappedDriver) Shutdown(ctx context.Context) error {
+	if d.slowQueryReport != nil {
+		if err := d.slowQueryReport.close(ctx); err != nil {
+			return err
+		}
+	}
+
+	return d.Flush(ctx)
+}
+
+// SetEnabled switches the instrumentation of operations on or off at runtime, it is on by default, see also WithEnabled
+func (d wrappedDriver) SetEnabled(enabled bool) {
+	var off int32
+	if !enabled {
+		off = 1
+	}
+	atomic.StoreInt32(&d.switchedOff, off)
 }
 
 func (d wrappedDriver) Open(name string) (driver.Conn, error) {
-	conn, err := d.parent.Open(name)
-	if err != nil {
+	return d.openConn(context.Background(), name, func(context.Context) (driver.Conn, error) {
+		return d.parent.Open(name)
+	})
+}
+
+// OpenConnector lets database/sql open connections with a context, so that their opening is traced as part of the request doing it
+func (d wrappedDriver) OpenConnector(name string) (driver.Connector, error) {
+	if driverCtx, ok := d.parent.(driver.DriverContext); ok {
+		parent, err := driverCtx.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+
+		return wrappedConnector{driver: d, dsn: name, parent: parent}, nil
+	}
+
+	return wrappedConnector{driver: d, dsn: name, parent: dsnConnector{driver: d.parent, dsn: name}}, nil
+}
+
+// openConn opens a connection with open and wraps it
+func (d wrappedDriver) openConn(ctx context.Context, dsn string, open func(context.Context) (driver.Conn, error)) (conn driver.Conn, err error) {
+	c := d.newConn(dsn)
+	call := c.startOp(ctx, nil, OpSQLConnOpen, "", nil)
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if ctx, err = call.before(); err != nil {
+		return nil, err
+	}
+
+	if c.parent, err = open(ctx); err != nil {
 		return nil, err
 	}
+	c.caps = detectConnCapabilities(c.parent)
+	c.opened = time.Now()
+
+	return c, nil
+}
+
+// newConn returns a connection to dsn with the next ID, whose parent is yet to be set
+func (o *opts) newConn(dsn string) *wrappedConn {
+	id := atomic.AddUint64(&o.lastConnID, 1)
+	c := &wrappedConn{opts: o, id: id, idLabel: strconv.FormatUint(id, 10), dsn: dsn, checkouts: 1}
+	if o.dsnAttributes {
+		info := parseDSN(dsn)
+		c.dsnInfo = &info
+	}
+	if o.stmtCacheSize > 0 {
+		c.stmts = newStmtCache(o.stmtCacheSize, o.stmtCacheStats)
+	}
+
+	return c
+}
+
+type wrappedConnector struct {
+	driver wrappedDriver
+	dsn    string
+	parent driver.Connector
+}
+
+func (c wrappedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.openConn(ctx, c.dsn, c.parent.Connect)
+}
+
+func (c wrappedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Close is called by database/sql when the DB is closed
+func (c wrappedConnector) Close() error {
+	if closer, ok := c.parent.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
 
-	return wrappedConn{Tracer: d.Tracer, Logger: d.Logger, parent: conn}, nil
+// dsnConnector opens connections with drivers that don't implement driver.DriverContext
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
 }
 
-func (c wrappedConn) Prepare(query string) (driver.Stmt, error) {
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (c *wrappedConn) Prepare(query string) (driver.Stmt, error) {
 	parent, err := c.parent.Prepare(query)
 	if err != nil {
 		return nil, err
 	}
 
-	return wrappedStmt{Tracer: c.Tracer, Logger: c.Logger, query: query, parent: parent}, nil
+	return c.wrapStmt(nil, query, parent), nil
 }
 
-func (c wrappedConn) Close() error {
+func (c *wrappedConn) Close() (err error) {
+	call := c.startOp(context.Background(), nil, OpSQLConnClose, "", nil)
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return err
+	}
+
+	call.setLabel("conn_lifetime", time.Since(c.opened).String())
+	call.setLabel("conn_queries", strconv.FormatInt(atomic.LoadInt64(&c.queries), 10))
+	call.setLabel("conn_errors", strconv.FormatInt(atomic.LoadInt64(&c.errors), 10))
+	call.setLabel("conn_txs", strconv.FormatInt(atomic.LoadInt64(&c.txs), 10))
+	if c.stmts != nil {
+		c.stmts.close()
+	}
+
 	return c.parent.Close()
 }
 
-func (c wrappedConn) Begin() (driver.Tx, error) {
+// ResetSession is called by database/sql before reusing a connection from its pool
+func (c *wrappedConn) ResetSession(ctx context.Context) error {
+	atomic.AddInt64(&c.checkouts, 1)
+
+	if resetter := c.caps.resetter; resetter != nil {
+		return resetter.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+// CheckNamedValue lets the parent driver convert the args of queries, such as sql.Out args.
+// Returning driver.ErrSkip makes database/sql fall back to its default conversion.
+func (c *wrappedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker := c.caps.checker; checker != nil {
+		return checker.CheckNamedValue(nv)
+	}
+
+	return driver.ErrSkip
+}
+
+func (c *wrappedConn) Begin() (driver.Tx, error) {
 	tx, err := c.parent.Begin()
 	if err != nil {
 		return nil, err
 	}
 
-	return wrappedTx{Tracer: c.Tracer, Logger: c.Logger, parent: tx}, nil
+	return &wrappedTx{opts: c.opts, conn: c, parent: tx}, nil
 }
 
-func (c wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
-	span := c.GetSpan(ctx).NewChild("sql-tx-begin")
-	span.SetLabel("component", "database/sql")
+func (c *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	txCall := c.startOp(ctx, nil, OpSQLTx, "", nil)
+	c.txSpan = txCall.span
 	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
+		// The transaction did not begin, because of an error or of a panic of the parent driver
+		if tx == nil {
+			c.txSpan = nil
+			txCall.finish(err)
 		}
-		span.Finish()
-		c.Log(ctx, "sql-tx-begin", "err", err)
 	}()
+	defer txCall.recoverPanic()
 
-	if connBeginTx, ok := c.parent.(driver.ConnBeginTx); ok {
+	call := c.startOp(ctx, nil, OpSQLTxBegin, "", nil)
+	call.setLabel("isolation", sql.IsolationLevel(opts.Isolation).String())
+	call.setLabel("read_only", strconv.FormatBool(opts.ReadOnly))
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if ctx, err = call.before(); err != nil {
+		return nil, err
+	}
+
+	if connBeginTx := c.caps.beginTx; connBeginTx != nil {
 		tx, err = connBeginTx.BeginTx(ctx, opts)
 		if err != nil {
 			return nil, err
 		}
 
-		return wrappedTx{Tracer: c.Tracer, Logger: c.Logger, ctx: ctx, parent: tx}, nil
+		return c.wrapTx(ctx, txCall, tx), nil
 	}
 
 	tx, err = c.parent.Begin()
@@ -131,69 +522,122 @@ func (c wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx dri
 		return nil, err
 	}
 
-	return wrappedTx{Tracer: c.Tracer, Logger: c.Logger, ctx: ctx, parent: tx}, nil
+	return c.wrapTx(ctx, txCall, tx), nil
 }
 
-func (c wrappedConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
-	span := c.GetSpan(ctx).NewChild(fmt.Sprintf("(sql-prepare) %s", query))
-	span.SetLabel("component", "database/sql")
-	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
-		}
-		span.Finish()
-		c.Log(ctx, "sql-prepare", "err", err)
-	}()
+func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	call := c.startOp(ctx, nil, OpSQLPrepare, query, nil)
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
 
-	if connPrepareCtx, ok := c.parent.(driver.ConnPrepareContext); ok {
-		stmt, err := connPrepareCtx.PrepareContext(ctx, query)
+	if ctx, err = call.before(); err != nil {
+		return nil, err
+	}
+
+	if c.stmts != nil && !isCopyFromStdin(query) {
+		cached, hit, err := c.stmts.get(call.parentQuery, func() (driver.Stmt, error) {
+			return c.prepareParent(ctx, call.parentQuery)
+		})
 		if err != nil {
 			return nil, err
 		}
+		if hit {
+			call.setLabel("stmt_cache", "hit")
+		} else {
+			call.setLabel("stmt_cache", "miss")
+		}
+
+		wrapped := c.wrapStmt(ctx, query, cached.stmt)
+		wrapped.cached = cached
+		return wrapped, nil
+	}
 
-		return wrappedStmt{Tracer: c.Tracer, Logger: c.Logger, ctx: ctx, parent: stmt}, nil
+	stmt, err = c.prepareParent(ctx, call.parentQuery)
+	if err != nil {
+		return nil, err
 	}
 
-	return c.Prepare(query)
+	// The prepare context is kept for the legacy methods of the statement, which do not get a context of their own
+	return c.wrapStmt(ctx, query, stmt), nil
 }
 
-func (c wrappedConn) Exec(query string, args []driver.Value) (driver.Result, error) {
-	if execer, ok := c.parent.(driver.Execer); ok {
+// prepareParent prepares query on the parent connection
+func (c *wrappedConn) prepareParent(ctx context.Context, query string) (driver.Stmt, error) {
+	if connPrepareCtx := c.caps.prepareContext; connPrepareCtx != nil {
+		return connPrepareCtx.PrepareContext(ctx, query)
+	}
+
+	return c.parent.Prepare(query)
+}
+
+func (c *wrappedConn) Exec(query string, args []driver.Value) (res driver.Result, err error) {
+	execer := c.caps.execer
+	if execer == nil {
+		return nil, driver.ErrSkip
+	}
+	if !c.orphanSpans {
 		res, err := execer.Exec(query, args)
 		if err != nil {
 			return nil, err
 		}
 
-		return wrappedResult{Tracer: c.Tracer, Logger: c.Logger, parent: res}, nil
+		return wrappedResult{opts: c.opts, conn: c, parent: res}, nil
 	}
 
-	return nil, driver.ErrSkip
+	call := c.startOp(nil, nil, OpSQLConnExec, query, valueToNamedValue(args))
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return nil, err
+	}
+
+	res, err = execer.Exec(c.commentQuery(call.span, call.parentQuery), args)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.wrapResult(nil, call, res), nil
 }
 
-func (c wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (r driver.Result, err error) {
-	span := c.GetSpan(ctx).NewChild(fmt.Sprintf("(sql-conn-exec) %s", query))
-	span.SetLabel("component", "database/sql")
-	span.SetLabel("query", query)
-	span.SetLabel("args", pretty.Sprint(args))
-	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
-		}
-		span.Finish()
-		c.Log(ctx, "sql-conn-exec", "query", query, "args", pretty.Sprint(args), "err", err)
-	}()
+func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (r driver.Result, err error) {
+	err = c.retry(ctx, func(attempt int) error {
+		r, err = c.execContext(ctx, query, args, attempt)
+		return err
+	})
+	if err == nil && c.inTx {
+		c.trackSavepoint(ctx, query)
+	}
 
-	if execContext, ok := c.parent.(driver.ExecerContext); ok {
-		res, err := execContext.ExecContext(ctx, query, args)
+	return r, err
+}
+
+// execContext runs an attempt at the query, see WithRetry
+func (c *wrappedConn) execContext(ctx context.Context, query string, args []driver.NamedValue, attempt int) (r driver.Result, err error) {
+	call := c.startOp(ctx, nil, OpSQLConnExec, query, args)
+	if attempt > 1 {
+		call.setLabel("attempt", strconv.Itoa(attempt))
+	}
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if ctx, err = call.before(); err != nil {
+		return nil, err
+	}
+
+	parentQuery := c.commentQuery(call.span, call.parentQuery)
+
+	if execContext := c.caps.execerContext; execContext != nil {
+		res, err := execContext.ExecContext(ctx, parentQuery, args)
 		if err != nil {
 			return nil, err
 		}
 
-		return wrappedResult{Tracer: c.Tracer, Logger: c.Logger, ctx: ctx, parent: res}, nil
+		return c.wrapResult(ctx, call, res), nil
 	}
 
 	// Fallback implementation
-	dargs, err := namedValueToValue(args)
+	dargs, err := call.toValues(args)
 	if err != nil {
 		return nil, err
 	}
@@ -204,65 +648,134 @@ func (c wrappedConn) ExecContext(ctx context.Context, query string, args []drive
 		return nil, ctx.Err()
 	}
 
-	return c.Exec(query, dargs)
+	execer := c.caps.execer
+	if execer == nil {
+		return nil, driver.ErrSkip
+	}
+
+	res, err := execer.Exec(parentQuery, dargs)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.wrapResult(ctx, call, res), nil
 }
 
-func (c wrappedConn) Ping(ctx context.Context) (err error) {
-	if pinger, ok := c.parent.(driver.Pinger); ok {
-		span := c.GetSpan(ctx).NewChild("sql-ping")
-		span.SetLabel("component", "database/sql")
-		defer func() {
-			if err != nil {
-				span.SetLabel("err", fmt.Sprint(err))
+func (c *wrappedConn) Ping(ctx context.Context) (err error) {
+	if pinger := c.caps.pinger; pinger != nil {
+		call := c.startOp(ctx, nil, OpSQLPing, "", nil)
+		defer func() { call.finish(err) }()
+		defer call.recoverPanic()
+
+		if ctx, err = call.before(); err != nil {
+			return err
+		}
+
+		err = pinger.Ping(ctx)
+		if c.pings != nil {
+			pingErr := err
+			if !c.failed(err) {
+				pingErr = nil
 			}
-			span.Finish()
-			c.Log(ctx, "sql-ping", "err", err)
-		}()
+			stats := c.pings.record(ctx, pingErr)
+			call.setLabel("consecutive_failures", strconv.FormatInt(stats.ConsecutiveFailures, 10))
+		}
 
-		return pinger.Ping(ctx)
+		return err
 	}
 
-	c.Log(ctx, "sql-dummy-ping")
+	if c.opEnabled(OpSQLDummyPing) {
+		c.events.Log(ctx, c.opName(OpSQLDummyPing))
+	}
 
 	return nil
 }
 
-func (c wrappedConn) Query(query string, args []driver.Value) (driver.Rows, error) {
-	if queryer, ok := c.parent.(driver.Queryer); ok {
+func (c *wrappedConn) Query(query string, args []driver.Value) (rows driver.Rows, err error) {
+	queryer := c.caps.queryer
+	if queryer == nil {
+		return nil, driver.ErrSkip
+	}
+	if !c.orphanSpans {
 		rows, err := queryer.Query(query, args)
 		if err != nil {
 			return nil, err
 		}
 
-		return wrappedRows{Tracer: c.Tracer, Logger: c.Logger, parent: rows}, nil
+		return &wrappedRows{opts: c.opts, conn: c, query: query, parent: rows}, nil
+	}
+
+	call := c.startOp(nil, nil, OpSQLConnQuery, query, valueToNamedValue(args))
+	defer func() {
+		// On success the call is finished when the rows are closed
+		if err != nil {
+			call.finish(err)
+		}
+	}()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return nil, err
 	}
 
-	return nil, driver.ErrSkip
+	rows, err = queryer.Query(c.commentQuery(call.span, call.parentQuery), args)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.wrapRows(nil, call, query, rows), nil
+}
+
+func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	err = c.retry(ctx, func(attempt int) error {
+		rows, err = c.queryContext(ctx, query, args, attempt)
+		return err
+	})
+
+	return rows, err
 }
 
-func (c wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
-	span := c.GetSpan(ctx).NewChild(fmt.Sprintf("(sql-conn-query), %s", query))
-	span.SetLabel("component", "database/sql")
-	span.SetLabel("query", query)
-	span.SetLabel("args", pretty.Sprint(args))
+// queryContext runs an attempt at the query, see WithRetry
+func (c *wrappedConn) queryContext(ctx context.Context, query string, args []driver.NamedValue, attempt int) (rows driver.Rows, err error) {
+	call := c.startOp(ctx, nil, OpSQLConnQuery, query, args)
+	if attempt > 1 {
+		call.setLabel("attempt", strconv.Itoa(attempt))
+	}
 	defer func() {
+		// On success the call is finished when the rows are closed
 		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
+			call.finish(err)
 		}
-		span.Finish()
-		c.Log(ctx, "sql-conn-query", "query", query, "args", pretty.Sprint(args), "err", err)
 	}()
+	defer call.recoverPanic()
+
+	if ctx, err = call.before(); err != nil {
+		return nil, err
+	}
 
-	if queryerContext, ok := c.parent.(driver.QueryerContext); ok {
-		rows, err := queryerContext.QueryContext(ctx, query, args)
+	var cacheKey string
+	cacheTTL := c.cacheable(ctx, query)
+	if cacheTTL > 0 {
+		cacheKey = c.cacheKey(query, args)
+		if result, ok := c.queryCache.get(cacheKey); ok {
+			call.setLabel("query_cache", "hit")
+			return c.wrapRows(ctx, call, query, &cachedRows{result: result}), nil
+		}
+		call.setLabel("query_cache", "miss")
+	}
+
+	parentQuery := c.commentQuery(call.span, call.parentQuery)
+
+	if queryerContext := c.caps.queryerContext; queryerContext != nil {
+		rows, err := queryerContext.QueryContext(ctx, parentQuery, args)
 		if err != nil {
 			return nil, err
 		}
 
-		return wrappedRows{Tracer: c.Tracer, Logger: c.Logger, ctx: ctx, parent: rows}, nil
+		return c.wrapRows(ctx, call, query, c.cacheRows(cacheTTL, cacheKey, rows)), nil
 	}
 
-	dargs, err := namedValueToValue(args)
+	dargs, err := call.toValues(args)
 	if err != nil {
 		return nil, err
 	}
@@ -273,47 +786,95 @@ func (c wrappedConn) QueryContext(ctx context.Context, query string, args []driv
 		return nil, ctx.Err()
 	}
 
-	return c.Query(query, dargs)
+	queryer := c.caps.queryer
+	if queryer == nil {
+		return nil, driver.ErrSkip
+	}
+
+	rows, err = queryer.Query(parentQuery, dargs)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.wrapRows(ctx, call, query, c.cacheRows(cacheTTL, cacheKey, rows)), nil
 }
 
-func (t wrappedTx) Commit() (err error) {
-	span := t.GetSpan(t.ctx).NewChild("sql-tx-commit")
-	span.SetLabel("component", "database/sql")
+func (t *wrappedTx) Commit() (err error) {
+	// Savepoints still open end along with the transaction
+	t.conn.endSavepoints(0, "ended_with_tx")
+	call := t.conn.startOp(t.ctx, nil, OpSQLTxCommit, "", nil)
 	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
-		}
-		span.Finish()
-		t.Log(t.ctx, "sql-tx-commit", "err", err)
+		call.finish(err)
+		t.end(err)
 	}()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return err
+	}
 
 	return t.parent.Commit()
 }
 
-func (t wrappedTx) Rollback() (err error) {
-	span := t.GetSpan(t.ctx).NewChild("sql-tx-rollback")
-	span.SetLabel("component", "database/sql")
+func (t *wrappedTx) Rollback() (err error) {
+	// Savepoints still open end along with the transaction
+	t.conn.endSavepoints(0, "ended_with_tx")
+	call := t.conn.startOp(t.ctx, nil, OpSQLTxRollback, "", nil)
 	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
-		}
-		span.Finish()
-		t.Log(t.ctx, "sql-tx-rollback", "err", err)
+		call.finish(err)
+		t.end(err)
 	}()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return err
+	}
 
 	return t.parent.Rollback()
 }
 
+// end finishes the instrumentation of the transaction once it has been committed or rolled back
+func (t *wrappedTx) end(err error) {
+	t.conn.inTx = false
+	t.conn.txStart = time.Time{}
+	t.conn.txQueries = nil
+	if t.leak != nil {
+		t.leak.Stop()
+	}
+	if hold := t.conn.hold; hold != nil {
+		t.conn.hold = nil
+		t.conn.checkHold(t.ctx, hold.since, hold.queries)
+	}
+	if t.traceTask != nil {
+		t.traceTask.End()
+		t.traceTask = nil
+		t.conn.txTraceCtx = nil
+	}
+	if t.call == nil {
+		return
+	}
+
+	t.conn.txSpan = nil
+	t.call.finish(err)
+	t.call = nil
+}
+
 func (s wrappedStmt) Close() (err error) {
-	span := s.GetSpan(s.ctx).NewChild("sql-stmt-close")
-	span.SetLabel("component", "database/sql")
-	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
-		}
-		span.Finish()
-		s.Log(s.ctx, "sql-stmt-close", "err", err)
-	}()
+	s.abandonCopy()
+
+	call := s.conn.startOp(s.ctx, nil, OpSQLStmtClose, s.query, nil)
+	call.setLabel("stmt_lifetime", time.Since(s.usage.prepared).String())
+	call.setLabel("executions", strconv.FormatInt(atomic.LoadInt64(&s.usage.executions), 10))
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return err
+	}
+
+	if s.cached != nil {
+		return s.conn.stmts.release(s.cached)
+	}
 
 	return s.parent.Close()
 }
@@ -322,72 +883,86 @@ func (s wrappedStmt) NumInput() int {
 	return s.parent.NumInput()
 }
 
+// CheckNamedValue lets the parent statement, or else the parent connection, convert the args of the statement.
+// database/sql looks for a checker on the statement before the connection, so both have to be consulted.
+func (s wrappedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker := s.caps.checker; checker != nil {
+		return checker.CheckNamedValue(nv)
+	}
+
+	return s.conn.CheckNamedValue(nv)
+}
+
 func (s wrappedStmt) Exec(args []driver.Value) (res driver.Result, err error) {
-	span := s.GetSpan(s.ctx).NewChild(fmt.Sprintf("(sql-stmt-exec) %s", s.query))
-	span.SetLabel("component", "database/sql")
-	span.SetLabel("query", s.query)
-	span.SetLabel("args", pretty.Sprint(args))
-	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
-		}
-		span.Finish()
-		s.Log(s.ctx, "sql-stmt-exec", "query", s.query, "args", pretty.Sprint(args), "err", err)
-	}()
+	atomic.AddInt64(&s.usage.executions, 1)
+	if s.copy != nil {
+		return s.copyExec(s.ctx, valueToNamedValue(args))
+	}
+
+	call := s.conn.startOp(s.ctx, nil, OpSQLStmtExec, s.query, valueToNamedValue(args))
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return nil, err
+	}
 
 	res, err = s.parent.Exec(args)
 	if err != nil {
 		return nil, err
 	}
 
-	return wrappedResult{Tracer: s.Tracer, Logger: s.Logger, ctx: s.ctx, parent: res}, nil
+	return s.conn.wrapResult(s.ctx, call, res), nil
 }
 
 func (s wrappedStmt) Query(args []driver.Value) (rows driver.Rows, err error) {
-	span := s.GetSpan(s.ctx).NewChild(fmt.Sprintf("(sql-stmt-query) %s", s.query))
-	span.SetLabel("component", "database/sql")
-	span.SetLabel("query", s.query)
-	span.SetLabel("args", pretty.Sprint(args))
+	atomic.AddInt64(&s.usage.executions, 1)
+	call := s.conn.startOp(s.ctx, nil, OpSQLStmtQuery, s.query, valueToNamedValue(args))
 	defer func() {
+		// On success the call is finished when the rows are closed
 		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
+			call.finish(err)
 		}
-		span.Finish()
-		s.Log(s.ctx, "sql-stmt-query", "query", s.query, "args", pretty.Sprint(args), "err", err)
 	}()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return nil, err
+	}
 
 	rows, err = s.parent.Query(args)
 	if err != nil {
 		return nil, err
 	}
 
-	return wrappedRows{Tracer: s.Tracer, Logger: s.Logger, ctx: s.ctx, parent: rows}, nil
+	return s.conn.wrapRows(s.ctx, call, s.query, rows), nil
 }
 
 func (s wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (res driver.Result, err error) {
-	span := s.GetSpan(ctx).NewChild(fmt.Sprintf("(sql-stmt-exec) %s", s.query))
-	span.SetLabel("component", "database/sql")
-	span.SetLabel("query", s.query)
-	span.SetLabel("args", pretty.Sprint(args))
-	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
-		}
-		span.Finish()
-		s.Log(ctx, "sql-stmt-exec", "query", s.query, "args", pretty.Sprint(args), "err", err)
-	}()
+	atomic.AddInt64(&s.usage.executions, 1)
+	if s.copy != nil {
+		return s.copyExec(ctx, args)
+	}
+
+	call := s.conn.startOp(ctx, nil, OpSQLStmtExec, s.query, args)
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if ctx, err = call.before(); err != nil {
+		return nil, err
+	}
 
-	if stmtExecContext, ok := s.parent.(driver.StmtExecContext); ok {
+	if stmtExecContext := s.caps.execContext; stmtExecContext != nil {
 		res, err := stmtExecContext.ExecContext(ctx, args)
 		if err != nil {
 			return nil, err
 		}
 
-		return wrappedResult{Tracer: s.Tracer, Logger: s.Logger, ctx: ctx, parent: res}, nil
+		return s.conn.wrapResult(ctx, call, res), nil
 	}
 
 	// Fallback implementation
-	dargs, err := namedValueToValue(args)
+	dargs, err := call.toValues(args)
 	if err != nil {
 		return nil, err
 	}
@@ -398,32 +973,40 @@ func (s wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue)
 		return nil, ctx.Err()
 	}
 
-	return s.Exec(dargs)
+	// Call the parent directly rather than s.Exec, which would instrument the call again using the prepare context
+	res, err = s.parent.Exec(dargs)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.conn.wrapResult(ctx, call, res), nil
 }
 
 func (s wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
-	span := s.GetSpan(ctx).NewChild(fmt.Sprintf("(sql-stmt-query) %s", s.query))
-	span.SetLabel("component", "database/sql")
-	span.SetLabel("query", s.query)
-	span.SetLabel("args", pretty.Sprint(args))
+	atomic.AddInt64(&s.usage.executions, 1)
+	call := s.conn.startOp(ctx, nil, OpSQLStmtQuery, s.query, args)
 	defer func() {
+		// On success the call is finished when the rows are closed
 		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
+			call.finish(err)
 		}
-		span.Finish()
-		s.Log(ctx, "sql-stmt-query", "query", s.query, "args", pretty.Sprint(args), "err", err)
 	}()
+	defer call.recoverPanic()
 
-	if stmtQueryContext, ok := s.parent.(driver.StmtQueryContext); ok {
+	if ctx, err = call.before(); err != nil {
+		return nil, err
+	}
+
+	if stmtQueryContext := s.caps.queryContext; stmtQueryContext != nil {
 		rows, err := stmtQueryContext.QueryContext(ctx, args)
 		if err != nil {
 			return nil, err
 		}
 
-		return wrappedRows{Tracer: s.Tracer, Logger: s.Logger, ctx: ctx, parent: rows}, nil
+		return s.conn.wrapRows(ctx, call, s.query, rows), nil
 	}
 
-	dargs, err := namedValueToValue(args)
+	dargs, err := call.toValues(args)
 	if err != nil {
 		return nil, err
 	}
@@ -434,47 +1017,217 @@ func (s wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue)
 		return nil, ctx.Err()
 	}
 
-	return s.Query(dargs)
+	rows, err = s.parent.Query(dargs)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.conn.wrapRows(ctx, call, s.query, rows), nil
 }
 
 func (r wrappedResult) LastInsertId() (id int64, err error) {
-	span := r.GetSpan(r.ctx).NewChild("sql-res-lastInsertId")
-	span.SetLabel("component", "database/sql")
-	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
-		}
-		span.Finish()
-		r.Log(r.ctx, "sql-res-lastInsertId", "err", err)
-	}()
+	call := r.conn.startOp(r.ctx, nil, OpSQLResLastInsertID, "", nil)
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return 0, err
+	}
 
 	return r.parent.LastInsertId()
 }
 
 func (r wrappedResult) RowsAffected() (num int64, err error) {
-	span := r.GetSpan(r.ctx).NewChild("sql-res-rowsAffected")
-	span.SetLabel("component", "database/sql")
-	defer func() {
-		if err != nil {
-			span.SetLabel("err", fmt.Sprint(err))
-		}
-		span.Finish()
-		r.Log(r.ctx, "sql-res-rowsAffected", "err", err)
-	}()
+	call := r.conn.startOp(r.ctx, nil, OpSQLResRowsAffected, "", nil)
+	defer func() { call.finish(err) }()
+	defer call.recoverPanic()
+
+	if _, err = call.before(); err != nil {
+		return 0, err
+	}
 
 	return r.parent.RowsAffected()
 }
 
-func (r wrappedRows) Columns() []string {
+func (r capturedResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, r.lastInsertIDErr
+}
+
+func (r capturedResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, r.rowsAffectedErr
+}
+
+// wrapResult wraps the result of the exec operation instrumented by call.
+// When results are captured their values are recorded on call rather than instrumented separately.
+func (c *wrappedConn) wrapResult(ctx context.Context, call *opCall, res driver.Result) driver.Result {
+	call.result = res
+	if c.phaseTimings {
+		call.phases.driverDone = time.Now()
+	}
+
+	if !c.captureResults {
+		return wrappedResult{opts: c.opts, ctx: ctx, conn: c, parent: res}
+	}
+
+	var r capturedResult
+	r.lastInsertID, r.lastInsertIDErr = res.LastInsertId()
+	if r.lastInsertIDErr == nil {
+		call.setLabel("last_insert_id", strconv.FormatInt(r.lastInsertID, 10))
+	}
+	r.rowsAffected, r.rowsAffectedErr = res.RowsAffected()
+	if r.rowsAffectedErr == nil {
+		call.setLabel("rows_affected", strconv.FormatInt(r.rowsAffected, 10))
+	}
+
+	return r
+}
+
+// wrapStmt wraps stmt, prepared with query on the connection, tracking its usage until it is closed
+func (c *wrappedConn) wrapStmt(ctx context.Context, query string, stmt driver.Stmt) wrappedStmt {
+	wrapped := wrappedStmt{opts: c.opts, conn: c, ctx: ctx, query: query, parent: stmt, caps: detectStmtCapabilities(stmt),
+		usage: &stmtUsage{prepared: time.Now()}}
+	if isCopyFromStdin(query) {
+		wrapped.copy = &copyState{}
+	}
+
+	return wrapped
+}
+
+func (c *wrappedConn) wrapTx(ctx context.Context, call *opCall, tx driver.Tx) driver.Tx {
+	wrapped := &wrappedTx{opts: c.opts, ctx: ctx, conn: c, call: call, parent: tx}
+	atomic.AddInt64(&c.txs, 1)
+	c.inTx = true
+	c.txStart = call.start
+	if c.connHoldThreshold > 0 {
+		c.hold = &connHold{since: call.start}
+	}
+	if c.duplicateQueries {
+		c.txQueries = map[string]int{}
+	}
+	if c.runtimeTrace {
+		wrapped.traceTask = c.startTraceTask(ctx)
+	}
+	if c.txLeak != nil {
+		wrapped.leak = c.txLeak.watch(ctx, c.events, "sql-tx-leak", "conn_id", c.id)
+	}
+
+	return wrapped
+}
+
+// wrapRows wraps the rows returned by the query operation instrumented by call, which is finished once they are closed
+func (c *wrappedConn) wrapRows(ctx context.Context, call *opCall, query string, rows driver.Rows) driver.Rows {
+	call.result = rows
+	if c.phaseTimings {
+		call.phases.driverDone = time.Now()
+	}
+
+	wrapped := &wrappedRows{opts: c.opts, conn: c, ctx: ctx, query: query, queryCall: call, parent: rows}
+	if c.rowsLeak != nil {
+		wrapped.leak = c.rowsLeak.watch(ctx, c.events, "sql-rows-leak", "query", c.shownQuery(query), "conn_id", c.id)
+	}
+
+	return wrapped
+}
+
+func (r *wrappedRows) Columns() []string {
 	return r.parent.Columns()
 }
 
-func (r wrappedRows) Close() error {
-	return r.parent.Close()
+func (r *wrappedRows) Close() (err error) {
+	start := time.Now()
+	err = r.parent.Close()
+	closeDuration := time.Since(start)
+
+	if r.leak != nil {
+		r.leak.Stop()
+	}
+	if r.connHoldThreshold > 0 && r.queryCall != nil && r.conn.hold == nil {
+		// Within a transaction the connection is held until it ends
+		r.conn.checkHold(r.ctx, r.queryCall.start, []string{r.conn.shownQuery(r.query)})
+	}
+
+	if r.queryCall != nil {
+		r.queryCall.phases.iterationDone = start
+		r.queryCall.event("rows_closed")
+		r.queryCall.setLabel("close_duration", closeDuration.String())
+		if err != nil && r.fetchErr != nil {
+			// The query is finished with the error that ended the iteration
+			r.queryCall.setLabel("close_err", err.Error())
+		}
+		if r.shadow != nil && err == nil && r.fetchErr == nil {
+			r.mirror()
+		}
+	}
+	if r.rowsCall != nil {
+		r.rowsCall.setLabel("fetch_duration", r.fetchTime.String())
+		r.finishCall(r.rowsCall, err)
+		r.rowsCall = nil
+	}
+	if r.queryCall != nil {
+		r.finishCall(r.queryCall, err)
+		r.queryCall = nil
+	}
+
+	return err
 }
 
-func (r wrappedRows) Next(dest []driver.Value) (err error) {
-	return r.parent.Next(dest)
+// mirror runs the query on the shadow database, unless its rows were served from the query cache, see WithShadow
+func (r *wrappedRows) mirror() {
+	if _, ok := r.parent.(*cachedRows); ok {
+		return
+	}
+
+	rows := int64(-1)
+	if r.fetched {
+		rows = r.rowCount
+	}
+	r.shadow.maybeMirror(r.queryCall, rows)
+}
+
+// finishCall records the iteration results on call and finishes it, an error ending the iteration takes precedence over closeErr
+func (r *wrappedRows) finishCall(call *opCall, closeErr error) {
+	call.setLabel("rows", strconv.FormatInt(r.rowCount, 10))
+	if r.fetchErr != nil {
+		call.finish(r.fetchErr)
+		return
+	}
+
+	call.finish(closeErr)
+}
+
+func (r *wrappedRows) Next(dest []driver.Value) (err error) {
+	var start time.Time
+	if r.aggregateRows {
+		if r.rowsCall == nil {
+			var parent tracer.Span
+			if r.queryCall != nil {
+				parent = r.queryCall.span
+			}
+			r.rowsCall = r.conn.startOp(r.ctx, parent, OpSQLRows, r.query, nil)
+		}
+		start = time.Now()
+	}
+
+	err = r.parent.Next(dest)
+
+	if r.aggregateRows {
+		r.fetchTime += time.Since(start)
+	}
+
+	switch err {
+	case nil:
+		r.rowCount++
+		if r.rowCount == 1 && r.queryCall != nil {
+			r.queryCall.firstRow = time.Since(r.queryCall.start)
+			r.queryCall.event("first_row")
+		}
+	case io.EOF:
+		r.fetched = true
+	default:
+		r.fetchErr = err
+	}
+
+	return err
 }
 
 // namedValueToValue is a helper function copied from the database/sql package
@@ -488,3 +1241,12 @@ func namedValueToValue(named []driver.NamedValue) ([]driver.Value, error) {
 	}
 	return dargs, nil
 }
+
+// valueToNamedValue converts the arguments of the legacy driver methods into named values, with ordinals starting at 1
+func valueToNamedValue(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for n, arg := range args {
+		named[n] = driver.NamedValue{Ordinal: n + 1, Value: arg}
+	}
+	return named
+}
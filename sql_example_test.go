@@ -54,3 +54,16 @@ func ExampleWrapDriver_justLogging() {
 	// Proceed to handle connection errors and use the database as usual
 	_, _ = db, err
 }
+
+// Open wraps a registered driver and opens a database on it, without registering the wrapped driver.
+// This example uses a mysql driver registered under the name mysql
+func ExampleOpen() {
+	logger := instrumentedsql.LoggerFunc(func(ctx context.Context, msg string, keyvals ...interface{}) {
+		log.Printf("%s %v", msg, keyvals)
+	})
+
+	db, err := instrumentedsql.Open("mysql", "connString", instrumentedsql.WithLogger(logger))
+
+	// Proceed to handle connection errors and use the database as usual
+	_, _ = db, err
+}
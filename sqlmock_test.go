@@ -0,0 +1,182 @@
+//go:build sqlmock
+// +build sqlmock
+
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+var sqlmockDSNs uint64
+
+// openSQLMock opens a database on a wrapped sqlmock connection, whose expectations must all be met by the end of the test.
+// Queries are matched exactly, so that any change the wrapper made to them would show.
+func openSQLMock(t *testing.T, opts ...Opt) (*sql.DB, sqlmock.Sqlmock) {
+	dsn := fmt.Sprintf("instrumentedsql-sqlmock-%d", atomic.AddUint64(&sqlmockDSNs, 1))
+	mockDB, mock, err := sqlmock.NewWithDSN(dsn, sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+
+	db := openBenchDB(t, WrapDriver(mockDB.Driver(), opts...), dsn)
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return db, mock
+}
+
+func TestSQLMockExec(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db, mock := openSQLMock(t, WithLogger(logger))
+	mock.ExpectExec("UPDATE users SET name = ? WHERE id = ?").WithArgs("bob", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	res, err := db.Exec("UPDATE users SET name = ? WHERE id = ?", "bob", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		t.Errorf("RowsAffected() = %d, %v, want 1", n, err)
+	}
+	logger.AssertQuery(t, "UPDATE users SET name = ? WHERE id = ?")
+}
+
+func TestSQLMockQuery(t *testing.T) {
+	db, mock := openSQLMock(t, WithLogger(nullLogger{}))
+	mock.ExpectQuery("SELECT id, name FROM users WHERE id > ?").WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice").AddRow(2, "bob"))
+
+	rows, err := db.Query("SELECT id, name FROM users WHERE id > ?", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(names) != "[alice bob]" {
+		t.Errorf("read %v, want [alice bob]", names)
+	}
+}
+
+func TestSQLMockTx(t *testing.T) {
+	db, mock := openSQLMock(t, WithLogger(nullLogger{}))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users (name) VALUES (?)").WithArgs("carol").WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM users").WillReturnError(errors.New("denied"))
+	mock.ExpectRollback()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tx.Exec("INSERT INTO users (name) VALUES (?)", "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := res.LastInsertId(); err != nil || id != 3 {
+		t.Errorf("LastInsertId() = %d, %v, want 3", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("DELETE FROM users"); err == nil || err.Error() != "denied" {
+		t.Errorf("Exec() = %v, want the error expected by the mock", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLMockPrepared(t *testing.T) {
+	db, mock := openSQLMock(t, WithLogger(nullLogger{}))
+	prep := mock.ExpectPrepare("SELECT name FROM users WHERE id = ?")
+	prep.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("alice"))
+	prep.ExpectExec().WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+	prep.WillBeClosed()
+
+	stmt, err := db.Prepare("SELECT name FROM users WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err := stmt.QueryRow(1).Scan(&name); err != nil || name != "alice" {
+		t.Errorf("QueryRow() = %q, %v, want alice", name, err)
+	}
+	if _, err := stmt.Exec(2); err != nil {
+		t.Error(err)
+	}
+	if err := stmt.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLMockPing(t *testing.T) {
+	db, mock := openSQLMock(t, WithLogger(nullLogger{}))
+	mock.ExpectPing()
+
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSQLMockOutArgs checks that the args the default conversion of database/sql rejects still reach sqlmock,
+// which accepts them in its CheckNamedValue
+func TestSQLMockOutArgs(t *testing.T) {
+	db, mock := openSQLMock(t, WithLogger(nullLogger{}))
+	var out string
+	mock.ExpectExec("CALL get_name(?, ?)").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(driver.ResultNoRows)
+
+	if _, err := db.Exec("CALL get_name(?, ?)", 1, sql.Out{Dest: &out}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSQLMockAllOptions runs a query with most options enabled, none of them may change what sqlmock sees
+func TestSQLMockAllOptions(t *testing.T) {
+	db, mock := openSQLMock(t,
+		WithLogger(nullLogger{}),
+		WithStatementTags(),
+		WithQueryStats(),
+		WithCallerAttribution(),
+		WithRowsAggregation(),
+		WithResultCapture(),
+		WithMaxConcurrentQueries(1),
+	)
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+
+	var n int
+	if err := db.QueryRow("SELECT 1").Scan(&n); err != nil || n != 1 {
+		t.Errorf("QueryRow() = %d, %v, want 1", n, err)
+	}
+}
@@ -0,0 +1,65 @@
+package instrumentedsql
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// maxStackFrames bounds the number of frames recorded by callerStack
+const maxStackFrames = 32
+
+// packagePath is the import path of this package, its frames are left out of stacks
+var packagePath = reflect.TypeOf(opts{}).PkgPath()
+
+// callerStack returns the stack of the calling goroutine, without the frames of this package, database/sql and the runtime,
+// so that it starts with the code using the database
+func callerStack() string {
+	var b strings.Builder
+	for _, frame := range callerFrames(maxStackFrames) {
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+	}
+
+	return b.String()
+}
+
+// caller returns the function and location of the code using the database, see WithCallerAttribution
+func caller() string {
+	frames := callerFrames(1)
+	if len(frames) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s %s:%d", frames[0].Function, frames[0].File, frames[0].Line)
+}
+
+// callerFrames returns up to max frames of the calling goroutine, without the frames of this package, database/sql and the runtime
+func callerFrames(max int) []runtime.Frame {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+
+	var found []runtime.Frame
+	for len(found) < max {
+		frame, more := frames.Next()
+		if !internalFrame(frame.Function) {
+			found = append(found, frame)
+		}
+		if !more {
+			break
+		}
+	}
+
+	return found
+}
+
+// internalFrame reports whether function belongs to this package, database/sql or the runtime
+func internalFrame(function string) bool {
+	for _, pkg := range []string{packagePath, "database/sql", "runtime"} {
+		if strings.HasPrefix(function, pkg+".") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,22 @@
+package instrumentedsql
+
+import "testing"
+
+func TestInternalFrame(t *testing.T) {
+	tests := []struct {
+		function string
+		want     bool
+	}{
+		{packagePath + ".(*opCall).finish", true},
+		{"database/sql.(*DB).QueryContext", true},
+		{"runtime.goexit", true},
+		{"github.com/acme/app/store.(*Users).Get", false},
+		{"database/sqlx.Get", false},
+	}
+
+	for _, test := range tests {
+		if got := internalFrame(test.function); got != test.want {
+			t.Errorf("internalFrame(%q) = %v, want %v", test.function, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package instrumentedsql
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The statement types reported for queries, apart from these the leading keyword of the query is used
+const (
+	statementSelect = "SELECT"
+	statementInsert = "INSERT"
+	statementUpdate = "UPDATE"
+	statementDelete = "DELETE"
+	statementDDL    = "DDL"
+)
+
+// Access tells whether a statement only reads data or may write it, see QueryAccess
+type Access string
+
+// The accesses returned by QueryAccess
+const (
+	AccessRead  Access = "read"
+	AccessWrite Access = "write"
+)
+
+// QueryAccess tells whether query only reads data, and could be sent to a replica, or may write it.
+// Statements it does not recognize as reads are considered writes, it cannot tell that a SELECT calling
+// a function with side effects, such as nextval, writes.
+func QueryAccess(query string) Access {
+	return parseStatement(query).access(query)
+}
+
+// access tells whether the statement parsed from query reads or writes
+func (s statementInfo) access(query string) Access {
+	switch s.verb {
+	case statementSelect:
+		// Locking reads and SELECT INTO must run on the primary
+		lex := sqlLexer{query: query}
+		for n := 0; n < maxLexedWords; n++ {
+			word := lex.nextTopLevelWord()
+			switch {
+			case word == "":
+				return AccessRead
+			case isOneOf(word, "INTO"):
+				return AccessWrite
+			case isOneOf(word, "FOR") && isOneOf(lex.nextWordSkipping("NO", "KEY"), "UPDATE", "SHARE"):
+				return AccessWrite
+			}
+		}
+		return AccessRead
+	case "SHOW", "EXPLAIN", "DESCRIBE", "DESC", "VALUES", "TABLE":
+		return AccessRead
+	case "COPY":
+		if hasTopLevelKeyword(query, "TO") {
+			return AccessRead
+		}
+	}
+
+	return AccessWrite
+}
+
+// Router picks the route of a query, such as primary or replica, from its access.
+// The route is only recorded, which connection runs the query is still decided by database/sql.
+type Router func(ctx context.Context, access Access, query string) string
+
+// statementInfo is what the lightweight parsing of a query tells about it
+type statementInfo struct {
+	// verb is the type of statement, such as SELECT or DDL
+	verb string
+	// table is the primary table the statement operates on, if it could be found
+	table string
+}
+
+// parseStatement finds the type and primary table of a statement by looking at its first keywords,
+// it does not validate the query and gives up on anything it does not understand
+func parseStatement(query string) statementInfo {
+	lex := sqlLexer{query: query}
+
+	first := lex.nextWord()
+	if strings.EqualFold(first, "WITH") {
+		// Skip the common table expressions preceding the actual statement
+		for n := 0; n < maxLexedWords; n++ {
+			first = lex.nextTopLevelWord()
+			if first == "" || isOneOf(first, "SELECT", "INSERT", "UPDATE", "DELETE") {
+				break
+			}
+		}
+	}
+
+	verb := strings.ToUpper(first)
+	switch verb {
+	case statementSelect:
+		return statementInfo{verb: verb, table: lex.wordAfter("FROM")}
+	case statementInsert, "REPLACE":
+		return statementInfo{verb: statementInsert, table: lex.wordAfter("INTO")}
+	case statementUpdate:
+		return statementInfo{verb: verb, table: lex.nextWordSkipping("LOW_PRIORITY", "IGNORE", "ONLY")}
+	case statementDelete:
+		return statementInfo{verb: verb, table: lex.wordAfter("FROM")}
+	case "COPY":
+		table := lex.nextWord()
+		if lex.depth != 0 {
+			// COPY (query) TO
+			table = ""
+		}
+		return statementInfo{verb: verb, table: table}
+	case "CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME", "COMMENT":
+		return statementInfo{verb: statementDDL, table: lex.ddlObject()}
+	}
+
+	return statementInfo{verb: verb}
+}
+
+// hasTopLevelKeyword reports whether keyword appears in query outside of parentheses, comments and literals
+func hasTopLevelKeyword(query, keyword string) bool {
+	lex := sqlLexer{query: query}
+	for n := 0; n < maxLexedWords; n++ {
+		word := lex.nextTopLevelWord()
+		if word == "" {
+			return false
+		}
+		if strings.EqualFold(word, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sqlLexer splits a query into words, skipping comments, literals and punctuation, while keeping track of parentheses
+type sqlLexer struct {
+	query string
+	pos   int
+	depth int
+}
+
+// maxLexedWords bounds the work done for a single query, the keywords we look for are always near its start
+const maxLexedWords = 256
+
+// nextWord returns the next identifier or keyword, quoted identifiers are returned without their quotes.
+// It returns an empty string at the end of the query.
+func (l *sqlLexer) nextWord() string {
+	for l.pos < len(l.query) {
+		r, size := utf8.DecodeRuneInString(l.query[l.pos:])
+		switch {
+		case r == '(':
+			l.depth++
+			l.pos += size
+		case r == ')':
+			l.depth--
+			l.pos += size
+		case r == '-' && strings.HasPrefix(l.query[l.pos:], "--"):
+			l.skipUntil("\n")
+		case r == '/' && strings.HasPrefix(l.query[l.pos:], "/*"):
+			l.pos += 2
+			l.skipUntil("*/")
+		case r == '\'':
+			// Backslashes are not escapes in standard SQL, a MySQL literal with an escaped quote only ends early
+			l.pos += stringLiteralLen(l.query[l.pos:], false)
+		case r == '"' || r == '`':
+			return l.quotedIdentifier(string(r)) + l.identifierTail()
+		case r == '[':
+			return l.quotedIdentifier("]") + l.identifierTail()
+		case isWordRune(r):
+			start := l.pos
+			for l.pos < len(l.query) {
+				r, size := utf8.DecodeRuneInString(l.query[l.pos:])
+				if !isWordRune(r) {
+					break
+				}
+				l.pos += size
+			}
+			return l.query[start:l.pos] + l.identifierTail()
+		default:
+			l.pos += size
+		}
+	}
+
+	return ""
+}
+
+// quotedIdentifier returns the identifier quoted from the current position until end, or until the end of the query
+// if the quote is not closed
+func (l *sqlLexer) quotedIdentifier(end string) string {
+	start := l.pos + 1
+	i := strings.Index(l.query[start:], end)
+	if i < 0 {
+		l.pos = len(l.query)
+		return l.query[start:]
+	}
+	l.pos = start + i + len(end)
+
+	return l.query[start : start+i]
+}
+
+// identifierTail returns the rest of a dotted identifier, such as the table in schema.table
+func (l *sqlLexer) identifierTail() string {
+	if l.pos < len(l.query) && l.query[l.pos] == '.' {
+		l.pos++
+		return "." + l.nextWord()
+	}
+
+	return ""
+}
+
+// skipUntil moves past the next occurrence of end, or to the end of the query
+func (l *sqlLexer) skipUntil(end string) {
+	i := strings.Index(l.query[l.pos:], end)
+	if i < 0 {
+		l.pos = len(l.query)
+		return
+	}
+	l.pos += i + len(end)
+}
+
+// nextTopLevelWord returns the next word which is not within parentheses
+func (l *sqlLexer) nextTopLevelWord() string {
+	for n := 0; n < maxLexedWords; n++ {
+		word := l.nextWord()
+		if word == "" || l.depth == 0 {
+			return word
+		}
+	}
+
+	return ""
+}
+
+// wordAfter returns the word following the first top level occurrence of keyword
+func (l *sqlLexer) wordAfter(keyword string) string {
+	for n := 0; n < maxLexedWords; n++ {
+		word := l.nextTopLevelWord()
+		if word == "" {
+			return ""
+		}
+		if strings.EqualFold(word, keyword) {
+			table := l.nextWordSkipping("ONLY")
+			if l.depth != 0 {
+				// A subquery rather than a table
+				return ""
+			}
+			return table
+		}
+	}
+
+	return ""
+}
+
+// nextWordSkipping returns the next word that is none of the passed keywords
+func (l *sqlLexer) nextWordSkipping(keywords ...string) string {
+	for n := 0; n < maxLexedWords; n++ {
+		word := l.nextWord()
+		if !isOneOf(word, keywords...) {
+			return word
+		}
+	}
+
+	return ""
+}
+
+// ddlObject returns the name of the object a DDL statement operates on
+func (l *sqlLexer) ddlObject() string {
+	for n := 0; n < maxLexedWords; n++ {
+		word := l.nextWord()
+		switch {
+		case word == "":
+			return ""
+		case isOneOf(word, "TABLE", "INDEX", "VIEW", "SEQUENCE", "SCHEMA", "DATABASE", "TYPE", "FUNCTION", "TRIGGER"):
+			return l.nextWordSkipping("IF", "NOT", "EXISTS", "ONLY", "CONCURRENTLY")
+		}
+	}
+
+	return ""
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isOneOf(word string, keywords ...string) bool {
+	for _, k := range keywords {
+		if strings.EqualFold(word, k) {
+			return true
+		}
+	}
+
+	return false
+}
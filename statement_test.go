@@ -0,0 +1,69 @@
+package instrumentedsql
+
+import "testing"
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		query string
+		want  statementInfo
+	}{
+		{"SELECT id, name FROM users WHERE id = $1", statementInfo{"SELECT", "users"}},
+		{"  -- lookup\n/* hint */ select * from public.\"Users\" u", statementInfo{"SELECT", "public.Users"}},
+		{"SELECT (SELECT max(id) FROM b) FROM a", statementInfo{"SELECT", "a"}},
+		{"SELECT * FROM (SELECT 1) t", statementInfo{"SELECT", ""}},
+		{"SELECT 'from x' FROM `db`.`t`", statementInfo{"SELECT", "db.t"}},
+		{"WITH r AS (SELECT * FROM a) DELETE FROM b USING r", statementInfo{"DELETE", "b"}},
+		{"INSERT INTO orders (id) VALUES (?)", statementInfo{"INSERT", "orders"}},
+		{"REPLACE INTO orders VALUES (1)", statementInfo{"INSERT", "orders"}},
+		{"UPDATE ONLY accounts SET balance = 0", statementInfo{"UPDATE", "accounts"}},
+		{"CREATE TABLE IF NOT EXISTS events (id int)", statementInfo{"DDL", "events"}},
+		{"DROP INDEX CONCURRENTLY idx_a", statementInfo{"DDL", "idx_a"}},
+		{`COPY "users" ("name", "age") FROM STDIN`, statementInfo{"COPY", "users"}},
+		{"COPY (SELECT * FROM users) TO STDOUT", statementInfo{"COPY", ""}},
+		{"begin", statementInfo{"BEGIN", ""}},
+		{`SELECT 'C:\' AS "p'ath" FROM files`, statementInfo{"SELECT", "files"}},
+		{`SELECT * FROM "users`, statementInfo{"SELECT", "users"}},
+		{"", statementInfo{"", ""}},
+	}
+
+	for _, test := range tests {
+		if got := parseStatement(test.query); got != test.want {
+			t.Errorf("parseStatement(%q) = %+v, want %+v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestLexerUnterminated(t *testing.T) {
+	for _, query := range []string{`SELECT * FROM "`, "SELECT a FROM [", "SELECT a FROM `", `SELECT 'C:\' AS "p'ath"`, "SELECT 'a", "SELECT /* a"} {
+		parseStatement(query)
+		QueryAccess(query)
+		isCopyFromStdin(query)
+		fingerprint(query)
+	}
+}
+
+func TestQueryAccess(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Access
+	}{
+		{"SELECT * FROM users", AccessRead},
+		{"select * from users where name = 'for update'", AccessRead},
+		{"WITH r AS (SELECT 1) SELECT * FROM r", AccessRead},
+		{"SELECT * FROM users FOR UPDATE", AccessWrite},
+		{"SELECT * FROM users FOR NO KEY UPDATE SKIP LOCKED", AccessWrite},
+		{"SELECT * INTO archive FROM users", AccessWrite},
+		{"SHOW TABLES", AccessRead},
+		{"INSERT INTO users VALUES (1)", AccessWrite},
+		{"WITH r AS (SELECT 1) DELETE FROM users", AccessWrite},
+		{"VACUUM", AccessWrite},
+		{"COPY users FROM STDIN", AccessWrite},
+		{"COPY (SELECT * FROM users) TO STDOUT", AccessRead},
+	}
+
+	for _, test := range tests {
+		if got := QueryAccess(test.query); got != test.want {
+			t.Errorf("QueryAccess(%q) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package instrumentedsql
+
+import (
+	"container/list"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultLatencyBuckets are the upper bounds of the latency histograms kept per query
+var defaultLatencyBuckets = []time.Duration{
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second,
+	10 * time.Second, 30 * time.Second,
+}
+
+// sortedBuckets returns a sorted copy of buckets without duplicates, so that they can be searched
+func sortedBuckets(buckets []time.Duration) []time.Duration {
+	sorted := append([]time.Duration(nil), buckets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	unique := sorted[:0]
+	for n, b := range sorted {
+		if n == 0 || b != sorted[n-1] {
+			unique = append(unique, b)
+		}
+	}
+
+	return unique
+}
+
+// OtherFingerprint is the fingerprint under which the executions of the queries evicted from the statistics are aggregated,
+// see WithMaxFingerprints
+const OtherFingerprint = "other"
+
+// QueryStats are the statistics aggregated for all executions of queries sharing a fingerprint, see WithQueryStats.
+// The percentiles are estimated from a histogram, they are the upper bound of the bucket they fall in, capped by Max.
+type QueryStats struct {
+	// Tenant is the tenant the queries were run for, see WithTenantExtractor
+	Tenant string
+	// Fingerprint is the normalized query, with literals and placeholders replaced by ?
+	Fingerprint string
+	Count       int64
+	Errors      int64
+	Total       time.Duration
+	Min         time.Duration
+	Max         time.Duration
+	P50         time.Duration
+	P95         time.Duration
+	P99         time.Duration
+	// FirstRows is the number of queries that returned at least one row, the FirstRow percentiles estimate the time
+	// from the start of those queries to their first row being received, which excludes the time spent iterating
+	FirstRows   int64
+	FirstRowP50 time.Duration
+	FirstRowP95 time.Duration
+	FirstRowP99 time.Duration
+	// Exemplars are the latest executions recorded in each bucket of the latency histogram that were traced,
+	// by increasing upper bound. They are only recorded for spans implementing TraceIDer.
+	Exemplars []Exemplar
+}
+
+// Exemplar links an execution counted in a latency histogram to its trace, see QueryStats
+type Exemplar struct {
+	// UpperBound is the upper bound of the bucket of the execution, math.MaxInt64 for durations above the last bucket
+	UpperBound time.Duration
+	TraceID    string
+	Duration   time.Duration
+	Time       time.Time
+}
+
+// TraceIDer can be implemented by spans returned from the tracer to expose the ID of their trace,
+// which is then recorded as an exemplar of the latency histograms of WithQueryStats
+type TraceIDer interface {
+	TraceID() string
+}
+
+// queryStats aggregates the executions of queries per tenant and fingerprint
+type queryStats struct {
+	buckets []time.Duration
+	// maxFingerprints is the number of fingerprints tracked across tenants, not counting OtherFingerprint,
+	// there is no limit if it is 0
+	maxFingerprints int
+
+	mu      sync.Mutex
+	queries map[queryStatsKey]*queryStatsEntry
+	// lru holds the keys of the queries tracked when there is a limit, the most recently executed first
+	lru list.List
+}
+
+type queryStatsKey struct {
+	tenant      string
+	fingerprint string
+}
+
+// execution is an execution of a query recorded in the statistics
+type execution struct {
+	tenant      string
+	fingerprint string
+	duration    time.Duration
+	failed      bool
+	// traceID is the ID of the trace of the query if known
+	traceID string
+	// firstRow is the time it took to receive the first row, 0 if the query returned none
+	firstRow time.Duration
+}
+
+type queryStatsEntry struct {
+	// elem is the element of the entry in the lru list, nil for OtherFingerprint or when there is no limit
+	elem   *list.Element
+	count  int64
+	errors int64
+	total  time.Duration
+	min    time.Duration
+	max    time.Duration
+	// counts has one more element than the buckets, for durations above the last one
+	counts []int64
+	// exemplars has an element per count once an execution with a trace ID was recorded
+	exemplars []Exemplar
+
+	// firstRowCounts is the histogram of the time to the first row, it is allocated with the first row received
+	firstRowCount  int64
+	firstRowMax    time.Duration
+	firstRowCounts []int64
+}
+
+func newQueryStats(buckets []time.Duration, maxFingerprints int) *queryStats {
+	return &queryStats{buckets: buckets, maxFingerprints: maxFingerprints, queries: map[queryStatsKey]*queryStatsEntry{}}
+}
+
+// record adds an execution of a query
+func (s *queryStats) record(x execution) {
+	bucket := s.bucket(x.duration)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(queryStatsKey{tenant: x.tenant, fingerprint: x.fingerprint}, x.duration)
+	e.count++
+	if x.failed {
+		e.errors++
+	}
+	e.total += x.duration
+	if x.duration < e.min {
+		e.min = x.duration
+	}
+	if x.duration > e.max {
+		e.max = x.duration
+	}
+	e.counts[bucket]++
+	if x.traceID != "" {
+		if e.exemplars == nil {
+			e.exemplars = make([]Exemplar, len(e.counts))
+		}
+		e.exemplars[bucket] = Exemplar{TraceID: x.traceID, Duration: x.duration, Time: time.Now()}
+	}
+	if x.firstRow > 0 {
+		if e.firstRowCounts == nil {
+			e.firstRowCounts = make([]int64, len(e.counts))
+		}
+		e.firstRowCount++
+		if x.firstRow > e.firstRowMax {
+			e.firstRowMax = x.firstRow
+		}
+		e.firstRowCounts[s.bucket(x.firstRow)]++
+	}
+}
+
+// bucket returns the index of the histogram bucket of duration
+func (s *queryStats) bucket(duration time.Duration) int {
+	return sort.Search(len(s.buckets), func(i int) bool { return duration <= s.buckets[i] })
+}
+
+// entry returns the entry of key, creating it and evicting the least recently executed fingerprint if needed,
+// into the OtherFingerprint entry of its tenant
+func (s *queryStats) entry(key queryStatsKey, duration time.Duration) *queryStatsEntry {
+	e, ok := s.queries[key]
+	if ok {
+		if e.elem != nil {
+			s.lru.MoveToFront(e.elem)
+		}
+		return e
+	}
+
+	e = &queryStatsEntry{min: duration, counts: make([]int64, len(s.buckets)+1)}
+	s.queries[key] = e
+	if s.maxFingerprints <= 0 || key.fingerprint == OtherFingerprint {
+		return e
+	}
+
+	e.elem = s.lru.PushFront(key)
+	if s.lru.Len() > s.maxFingerprints {
+		evicted := s.lru.Remove(s.lru.Back()).(queryStatsKey)
+		old := s.queries[evicted]
+		delete(s.queries, evicted)
+
+		otherKey := queryStatsKey{tenant: evicted.tenant, fingerprint: OtherFingerprint}
+		other, ok := s.queries[otherKey]
+		if !ok {
+			other = &queryStatsEntry{min: old.min, counts: make([]int64, len(s.buckets)+1)}
+			s.queries[otherKey] = other
+		}
+		other.merge(old)
+	}
+
+	return e
+}
+
+// merge adds the executions aggregated in o to e
+func (e *queryStatsEntry) merge(o *queryStatsEntry) {
+	e.count += o.count
+	e.errors += o.errors
+	e.total += o.total
+	if o.min < e.min {
+		e.min = o.min
+	}
+	if o.max > e.max {
+		e.max = o.max
+	}
+	for n, c := range o.counts {
+		e.counts[n] += c
+	}
+	if o.firstRowCounts != nil {
+		if e.firstRowCounts == nil {
+			e.firstRowCounts = make([]int64, len(e.counts))
+		}
+		e.firstRowCount += o.firstRowCount
+		if o.firstRowMax > e.firstRowMax {
+			e.firstRowMax = o.firstRowMax
+		}
+		for n, c := range o.firstRowCounts {
+			e.firstRowCounts[n] += c
+		}
+	}
+	for n, ex := range o.exemplars {
+		if e.exemplars == nil {
+			e.exemplars = make([]Exemplar, len(e.counts))
+		}
+		if ex.TraceID != "" && ex.Time.After(e.exemplars[n].Time) {
+			e.exemplars[n] = ex
+		}
+	}
+}
+
+// snapshot returns the statistics of every fingerprint, the ones with the largest total duration first
+func (s *queryStats) snapshot() []QueryStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]QueryStats, 0, len(s.queries))
+	for key, e := range s.queries {
+		stats = append(stats, QueryStats{
+			Tenant:      key.tenant,
+			Fingerprint: key.fingerprint,
+			Count:       e.count,
+			Errors:      e.errors,
+			Total:       e.total,
+			Min:         e.min,
+			Max:         e.max,
+			P50:         s.percentile(e.counts, e.count, e.max, 0.50),
+			P95:         s.percentile(e.counts, e.count, e.max, 0.95),
+			P99:         s.percentile(e.counts, e.count, e.max, 0.99),
+			FirstRows:   e.firstRowCount,
+			FirstRowP50: s.percentile(e.firstRowCounts, e.firstRowCount, e.firstRowMax, 0.50),
+			FirstRowP95: s.percentile(e.firstRowCounts, e.firstRowCount, e.firstRowMax, 0.95),
+			FirstRowP99: s.percentile(e.firstRowCounts, e.firstRowCount, e.firstRowMax, 0.99),
+			Exemplars:   s.exemplars(e),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Total > stats[j].Total })
+
+	return stats
+}
+
+// exemplars returns the exemplars recorded in e with the upper bound of their bucket
+func (s *queryStats) exemplars(e *queryStatsEntry) []Exemplar {
+	var exemplars []Exemplar
+	for n, ex := range e.exemplars {
+		if ex.TraceID == "" {
+			continue
+		}
+		ex.UpperBound = math.MaxInt64
+		if n < len(s.buckets) {
+			ex.UpperBound = s.buckets[n]
+		}
+		exemplars = append(exemplars, ex)
+	}
+
+	return exemplars
+}
+
+// percentile estimates the p-th percentile of the count durations recorded in the histogram counts, whose maximum is max
+func (s *queryStats) percentile(counts []int64, count int64, max time.Duration, p float64) time.Duration {
+	rank := int64(float64(count)*p + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for n, c := range counts {
+		seen += c
+		if seen >= rank {
+			if n < len(s.buckets) && s.buckets[n] < max {
+				return s.buckets[n]
+			}
+			return max
+		}
+	}
+
+	return max
+}
@@ -0,0 +1,167 @@
+package instrumentedsql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/away-team/go-tracer/tracer"
+)
+
+func TestQueryStats(t *testing.T) {
+	s := newQueryStats(defaultLatencyBuckets, 0)
+	for i := 0; i < 98; i++ {
+		s.record(execution{fingerprint: "SELECT ?", duration: time.Millisecond})
+	}
+	s.record(execution{fingerprint: "SELECT ?", duration: 40 * time.Millisecond, failed: true})
+	s.record(execution{fingerprint: "SELECT ?", duration: 3 * time.Second})
+	s.record(execution{fingerprint: "UPDATE t SET v = ?", duration: 200 * time.Microsecond})
+
+	stats := s.snapshot()
+	if len(stats) != 2 {
+		t.Fatalf("got %d fingerprints, want 2", len(stats))
+	}
+
+	got := stats[0]
+	want := QueryStats{
+		Fingerprint: "SELECT ?",
+		Count:       100,
+		Errors:      1,
+		Total:       98*time.Millisecond + 40*time.Millisecond + 3*time.Second,
+		Min:         time.Millisecond,
+		Max:         3 * time.Second,
+		P50:         time.Millisecond,
+		P95:         time.Millisecond,
+		P99:         50 * time.Millisecond,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestQueryStatsMaxFingerprints(t *testing.T) {
+	s := newQueryStats(defaultLatencyBuckets, 2)
+	s.record(execution{fingerprint: "SELECT ?", duration: time.Millisecond})
+	s.record(execution{fingerprint: "DELETE FROM t WHERE id = ?", duration: 2 * time.Millisecond, failed: true})
+	s.record(execution{fingerprint: "SELECT ?", duration: time.Millisecond})
+	// Evicts the DELETE, then the first UPDATE, the SELECT stays as the most recently executed
+	for _, query := range []string{"UPDATE t SET a = 1", "SELECT ?", "UPDATE t SET b = 2"} {
+		s.record(execution{fingerprint: query, duration: 3 * time.Millisecond})
+	}
+
+	got := map[string]QueryStats{}
+	for _, stats := range s.snapshot() {
+		got[stats.Fingerprint] = stats
+	}
+	if len(got) != 3 || got["SELECT ?"].Count != 3 || got["UPDATE t SET b = 2"].Count != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	other := got[OtherFingerprint]
+	if other.Count != 2 || other.Errors != 1 || other.Total != 5*time.Millisecond || other.Min != 2*time.Millisecond {
+		t.Errorf("got %+v for the evicted fingerprints", other)
+	}
+}
+
+func TestLatencyBuckets(t *testing.T) {
+	buckets := []time.Duration{30 * time.Second, 100 * time.Microsecond, time.Second, 100 * time.Microsecond}
+	d := WrapDriver(&fakeDriver{}, WithQueryStats(), WithLatencyBuckets(buckets...)).(wrappedDriver)
+	if fmt.Sprint(d.stats.buckets) != "[100µs 1s 30s]" {
+		t.Fatalf("got buckets %v", d.stats.buckets)
+	}
+
+	for _, duration := range []time.Duration{50 * time.Microsecond, 200 * time.Millisecond, 10 * time.Second} {
+		d.stats.record(execution{fingerprint: "SELECT ?", duration: duration})
+	}
+	if stats := d.Stats(); len(stats) != 1 || stats[0].P50 != time.Second || stats[0].P99 != 10*time.Second {
+		t.Errorf("got %+v", stats)
+	}
+}
+
+// traceIDSpan is a span of the trace with the given ID
+type traceIDSpan struct {
+	tracer.Span
+	id string
+}
+
+func (s traceIDSpan) NewChild(name string) tracer.Span {
+	return traceIDSpan{Span: s.Span.NewChild(name), id: s.id}
+}
+
+func (s traceIDSpan) TraceID() string {
+	return s.id
+}
+
+type traceIDTracer struct {
+	tracer.Tracer
+}
+
+func (t traceIDTracer) GetSpan(ctx context.Context) tracer.Span {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return traceIDSpan{Span: t.Tracer.GetSpan(ctx), id: id}
+}
+
+type traceIDKey struct{}
+
+func TestExemplars(t *testing.T) {
+	d := WrapDriver(&fakeDriver{}, WithQueryStats(), WithTracer(traceIDTracer{tracer.NewNullTracer()}),
+		WithLatencyBuckets(time.Hour))
+	db := openBenchDB(t, d, "")
+
+	for _, id := range []string{"trace-1", "trace-2"} {
+		if _, err := db.ExecContext(context.WithValue(context.Background(), traceIDKey{}, id), "UPDATE t SET a = 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := d.(wrappedDriver).Stats()
+	if len(stats) != 1 || len(stats[0].Exemplars) != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+	if ex := stats[0].Exemplars[0]; ex.TraceID != "trace-2" || ex.UpperBound != time.Hour || ex.Time.IsZero() {
+		t.Errorf("got exemplar %+v, want the latest execution", ex)
+	}
+}
+
+func TestTimeToFirstRow(t *testing.T) {
+	s := newQueryStats(defaultLatencyBuckets, 0)
+	for i := 0; i < 9; i++ {
+		s.record(execution{fingerprint: "SELECT ?", duration: time.Second, firstRow: 200 * time.Microsecond})
+	}
+	s.record(execution{fingerprint: "SELECT ?", duration: 2 * time.Second, firstRow: 40 * time.Millisecond})
+	s.record(execution{fingerprint: "SELECT ?", duration: time.Millisecond})
+
+	stats := s.snapshot()
+	if len(stats) != 1 {
+		t.Fatalf("got %d fingerprints, want 1", len(stats))
+	}
+	if got := stats[0]; got.FirstRows != 10 || got.FirstRowP50 != 250*time.Microsecond || got.FirstRowP99 != 40*time.Millisecond {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestTimeToFirstRowRecorded(t *testing.T) {
+	d := WrapDriver(&fakeDriver{rows: 2}, WithQueryStats())
+	db := openBenchDB(t, d, "")
+	if err := countRows(db.Query("SELECT a FROM t")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]QueryStats{}
+	for _, stats := range d.(wrappedDriver).Stats() {
+		got[stats.Fingerprint] = stats
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	if query := got["SELECT a FROM t"]; query.FirstRows != 1 || query.FirstRowP50 <= 0 {
+		t.Errorf("got %+v for the query", query)
+	}
+	if exec, ok := got["UPDATE t SET a = ?"]; !ok || exec.FirstRows != 0 {
+		t.Errorf("got %+v for the exec", exec)
+	}
+}
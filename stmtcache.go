@@ -0,0 +1,107 @@
+package instrumentedsql
+
+import (
+	"container/list"
+	"database/sql/driver"
+	"sync"
+	"sync/atomic"
+)
+
+// StatementCacheStats counts the lookups in the prepared statement caches of all the connections, see WithStatementCache
+type StatementCacheStats struct {
+	// Hits is the number of prepares that reused a cached statement
+	Hits int64
+	// Misses is the number of prepares that prepared a new statement on the parent connection
+	Misses int64
+	// Evictions is the number of statements closed to make room for new ones
+	Evictions int64
+}
+
+// stmtCache is the cache of the prepared statements of a connection, the least recently used are evicted first
+type stmtCache struct {
+	size  int
+	stats *StatementCacheStats
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds *cachedStmt, the most recently used first
+	lru list.List
+}
+
+// cachedStmt is a statement of the parent connection shared by all the statements prepared with the same query
+type cachedStmt struct {
+	query string
+	stmt  driver.Stmt
+	// refs is the number of statements returned to database/sql and not closed yet
+	refs int
+	// evicted is set once the statement left the cache, it is closed as soon as it is no longer used
+	evicted bool
+}
+
+func newStmtCache(size int, stats *StatementCacheStats) *stmtCache {
+	return &stmtCache{size: size, stats: stats, entries: make(map[string]*list.Element, size)}
+}
+
+// get returns the cached statement for query, calling prepare if there is none, and whether it was cached
+func (c *stmtCache) get(query string, prepare func() (driver.Stmt, error)) (*cachedStmt, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[query]; ok {
+		c.lru.MoveToFront(e)
+		cached := e.Value.(*cachedStmt)
+		cached.refs++
+		atomic.AddInt64(&c.stats.Hits, 1)
+		return cached, true, nil
+	}
+
+	atomic.AddInt64(&c.stats.Misses, 1)
+	stmt, err := prepare()
+	if err != nil {
+		return nil, false, err
+	}
+
+	cached := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	c.entries[query] = c.lru.PushFront(cached)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.evict(oldest)
+		atomic.AddInt64(&c.stats.Evictions, 1)
+	}
+
+	return cached, false, nil
+}
+
+// evict removes a statement from the cache, closing it unless it is still used
+func (c *stmtCache) evict(e *list.Element) {
+	cached := c.lru.Remove(e).(*cachedStmt)
+	delete(c.entries, cached.query)
+	cached.evicted = true
+	if cached.refs == 0 {
+		cached.stmt.Close()
+	}
+}
+
+// release is called when a statement returned to database/sql is closed, the cached statement is only closed
+// if it was evicted in the meantime
+func (c *stmtCache) release(cached *cachedStmt) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached.refs--
+	if cached.evicted && cached.refs == 0 {
+		return cached.stmt.Close()
+	}
+
+	return nil
+}
+
+// close closes all the cached statements, when their connection is closed
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.lru.Front(); e != nil; e = c.lru.Front() {
+		c.evict(e)
+	}
+}
@@ -0,0 +1,73 @@
+package instrumentedsql
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestStatementCache(t *testing.T) {
+	parent := &fakeDriver{api: fakeBareAPI}
+	wrapped := WrapDriver(parent, WithStatementCache(2))
+	db := openBenchDB(t, wrapped, "")
+
+	// database/sql prepares every query for drivers that cannot run them directly
+	for n := 0; n < 5; n++ {
+		if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stmt, err := db.Prepare("SELECT a FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Evicts UPDATE, SELECT is still in use
+	for _, query := range []string{"DELETE FROM t", "INSERT INTO t VALUES (1)"} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := wrapped.(interface{ StatementCacheStats() StatementCacheStats }).StatementCacheStats()
+	if stats != (StatementCacheStats{Hits: 4, Misses: 4, Evictions: 2}) {
+		t.Errorf("StatementCacheStats() = %+v", stats)
+	}
+	if prepares, closes := atomic.LoadInt64(&parent.prepares), atomic.LoadInt64(&parent.closes); prepares != 4 || closes != 1 {
+		t.Errorf("parent prepared %d statements and closed %d, want 4 and 1", prepares, closes)
+	}
+
+	// The SELECT was evicted while in use
+	stmt.Close()
+	if closes := atomic.LoadInt64(&parent.closes); closes != 2 {
+		t.Errorf("parent closed %d statements, want 2", closes)
+	}
+	db.Close()
+	if closes := atomic.LoadInt64(&parent.closes); closes != 4 {
+		t.Errorf("parent closed %d statements once the database was closed, want 4", closes)
+	}
+}
+
+func TestStatementUsage(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger)), "")
+
+	stmt, err := db.Prepare("SELECT a FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 3; n++ {
+		if _, err := stmt.Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stmt.Close()
+
+	closes := logger.Find(string(OpSQLStmtClose))
+	if len(closes) != 1 || closes[0].Labels["executions"] != "3" || closes[0].Labels["stmt_lifetime"] == nil {
+		t.Errorf("statement closes recorded as %+v", closes)
+	}
+}
@@ -0,0 +1,60 @@
+package instrumentedsql
+
+import (
+	"reflect"
+	"strings"
+)
+
+// The database systems recognized from the type of the parent driver, named after the OpenTelemetry db.system values
+const (
+	systemPostgres = "postgresql"
+	systemMySQL    = "mysql"
+	systemSQLite   = "sqlite"
+	systemMSSQL    = "mssql"
+	systemOracle   = "oracle"
+)
+
+// driverSystems maps import paths of well known drivers to the database system they connect to
+var driverSystems = []struct {
+	pkgPath string
+	system  string
+}{
+	{"github.com/lib/pq", systemPostgres},
+	{"github.com/jackc/pgx", systemPostgres},
+	{"github.com/go-sql-driver/mysql", systemMySQL},
+	{"github.com/mattn/go-sqlite3", systemSQLite},
+	{"modernc.org/sqlite", systemSQLite},
+	{"github.com/denisenkom/go-mssqldb", systemMSSQL},
+	{"github.com/microsoft/go-mssqldb", systemMSSQL},
+	{"github.com/godror/godror", systemOracle},
+	{"github.com/sijms/go-ora", systemOracle},
+	{"github.com/mattn/go-oci8", systemOracle},
+}
+
+// namedValueSystems are the database systems whose drivers accept sql.NamedArg values through the legacy interfaces,
+// their named args are passed as such unless WithNamedArgs is used
+var namedValueSystems = map[string]bool{
+	systemMSSQL:  true,
+	systemOracle: true,
+}
+
+// dbSystem returns the database system the parent driver, connection or statement connects to,
+// or an empty string if its driver is unknown
+func dbSystem(d interface{}) string {
+	t := reflect.TypeOf(d)
+	if t == nil {
+		return ""
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	pkgPath := t.PkgPath()
+	for _, ds := range driverSystems {
+		if strings.HasPrefix(pkgPath, ds.pkgPath) {
+			return ds.system
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,57 @@
+package instrumentedsql
+
+import (
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestDBSystem(t *testing.T) {
+	if system := dbSystem(&fakeDriver{}); system != "" {
+		t.Errorf("dbSystem(fakeDriver) = %q, want none", system)
+	}
+
+	logger := instrumentedsqltest.NewLogger()
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger), WithDBSystem(systemPostgres)), "")
+	if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if op := logger.AssertQuery(t, "UPDATE t SET a = 1"); op.Labels["db_system"] != systemPostgres {
+		t.Errorf("query recorded with db_system %v, want %s", op.Labels["db_system"], systemPostgres)
+	}
+}
+
+func TestComponent(t *testing.T) {
+	cases := []struct {
+		name     string
+		options  []Opt
+		wantSpan string
+		wantLog  interface{}
+		wantDB   interface{}
+	}{
+		{name: "default", wantSpan: "database/sql"},
+		{name: "set", options: []Opt{WithComponent("orders-db"), WithDBName("orders")}, wantSpan: "orders-db", wantLog: "orders-db", wantDB: "orders"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := instrumentedsqltest.NewLogger()
+			tr := instrumentedsqltest.NewTracer()
+			db := openBenchDB(t, WrapDriver(&fakeDriver{}, append(tc.options, WithLogger(logger), WithTracer(tr))...), "")
+			if _, err := db.Exec("UPDATE t SET a = 1"); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, span := range tr.Spans() {
+				if span.Labels["component"] != tc.wantSpan {
+					t.Errorf("span %s recorded with component %q, want %q", span.Name, span.Labels["component"], tc.wantSpan)
+				}
+			}
+			for _, op := range logger.Ops() {
+				if op.Labels["component"] != tc.wantLog || op.Labels["db"] != tc.wantDB {
+					t.Errorf("%s logged with component %v and db %v, want %v and %v", op.Name, op.Labels["component"], op.Labels["db"], tc.wantLog, tc.wantDB)
+				}
+			}
+		})
+	}
+}
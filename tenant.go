@@ -0,0 +1,60 @@
+package instrumentedsql
+
+import (
+	"context"
+	"sync"
+)
+
+// OtherTenant is the tenant of the operations run for tenants beyond the limit of WithTenantExtractor
+const OtherTenant = "other"
+
+// defaultMaxTenants is the number of tenants tracked by WithTenantExtractor unless set otherwise
+const defaultMaxTenants = 100
+
+// tenants resolves the tenants of operations, bounding the number of distinct ones, see WithTenantExtractor
+type tenants struct {
+	extract func(ctx context.Context) string
+	max     int
+
+	mu   sync.RWMutex
+	seen map[string]struct{}
+}
+
+func newTenants(extract func(ctx context.Context) string, max int) *tenants {
+	if max <= 0 {
+		max = defaultMaxTenants
+	}
+
+	return &tenants{extract: extract, max: max, seen: map[string]struct{}{}}
+}
+
+// tenant returns the tenant of the operations run with ctx, which may be nil for the legacy driver methods,
+// or OtherTenant once the maximum number of tenants was seen
+func (t *tenants) tenant(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tenant := t.extract(ctx)
+	if tenant == "" {
+		return ""
+	}
+
+	t.mu.RLock()
+	_, ok := t.seen[tenant]
+	t.mu.RUnlock()
+	if ok {
+		return tenant
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.seen[tenant]; ok {
+		return tenant
+	}
+	if len(t.seen) >= t.max {
+		return OtherTenant
+	}
+	t.seen[tenant] = struct{}{}
+
+	return tenant
+}
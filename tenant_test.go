@@ -0,0 +1,43 @@
+package instrumentedsql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+type tenantKey struct{}
+
+func TestTenantExtractor(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	d := WrapDriver(&fakeDriver{}, WithLogger(logger), WithQueryStats(), WithTenantExtractor(func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return tenant
+	}, 2))
+	db := openBenchDB(t, d, "")
+
+	for _, tenant := range []string{"acme", "globex", "acme", "initech", "umbrella", ""} {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		if _, err := db.ExecContext(ctx, "UPDATE t SET a = 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logged []interface{}
+	for _, op := range logger.Find(string(OpSQLConnExec)) {
+		logged = append(logged, op.Labels["tenant"])
+	}
+	if want := []interface{}{"acme", "globex", "acme", OtherTenant, OtherTenant, nil}; !reflect.DeepEqual(logged, want) {
+		t.Errorf("logged tenants %v, want %v", logged, want)
+	}
+
+	counts := map[string]int64{}
+	for _, stats := range d.(wrappedDriver).Stats() {
+		counts[stats.Tenant] += stats.Count
+	}
+	if want := map[string]int64{"acme": 2, "globex": 1, OtherTenant: 2, "": 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("got counts per tenant %v, want %v", counts, want)
+	}
+}
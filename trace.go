@@ -0,0 +1,41 @@
+package instrumentedsql
+
+import (
+	"context"
+	"runtime/trace"
+)
+
+// startTraceRegion starts the runtime/trace region of the operation, within the task of the transaction in progress if any,
+// see WithRuntimeTrace. The region is ended by finish.
+func (c *opCall) startTraceRegion() {
+	ctx := c.conn.txTraceCtx
+	if ctx == nil {
+		ctx = c.ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	c.traceRegion = trace.StartRegion(ctx, c.opName(c.op))
+	if c.query != "" && trace.IsEnabled() {
+		trace.Log(ctx, "sql_query", c.fingerprint())
+	}
+}
+
+// endTraceRegion ends the runtime/trace region of the operation, if any
+func (c *opCall) endTraceRegion() {
+	if c.traceRegion != nil {
+		c.traceRegion.End()
+	}
+}
+
+// startTraceTask starts the runtime/trace task of a transaction, the regions of its operations belong to it
+func (c *wrappedConn) startTraceTask(ctx context.Context) *trace.Task {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var task *trace.Task
+	c.txTraceCtx, task = trace.NewTask(ctx, c.opName(OpSQLTx))
+	return task
+}
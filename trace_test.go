@@ -0,0 +1,41 @@
+package instrumentedsql
+
+import (
+	"bytes"
+	"context"
+	"runtime/trace"
+	"testing"
+)
+
+func TestRuntimeTrace(t *testing.T) {
+	if trace.IsEnabled() {
+		t.Skip("the execution trace is already being recorded")
+	}
+	db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithRuntimeTrace()), "")
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		trace.Stop()
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("UPDATE traced SET a = 1 WHERE id = 2"); err != nil {
+		trace.Stop()
+		t.Fatal(err)
+	}
+	tx.Commit()
+	trace.Stop()
+
+	// The names of the task, regions and logs are recorded as is in the trace
+	for _, s := range []string{string(OpSQLTx), string(OpSQLTxBegin), string(OpSQLConnExec), string(OpSQLTxCommit), "sql_query", "UPDATE traced SET a = ? WHERE id = ?"} {
+		if !bytes.Contains(buf.Bytes(), []byte(s)) {
+			t.Errorf("the execution trace does not contain %q", s)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package instrumentedsql
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// missingTraceContext detects the operations run without a span in their context, see WithMissingTraceContext
+type missingTraceContext struct {
+	hasSpan func(ctx context.Context) bool
+
+	// count is the number of operations run without a span, accessed atomically
+	count int64
+	// callers holds the callers already logged, so that each call site is only logged once
+	callers sync.Map
+}
+
+// requestOp reports whether op is run on behalf of requests, whose context should carry a span
+func requestOp(op Op) bool {
+	return isStatementOp(op) || op == OpSQLTxBegin
+}
+
+// missing reports whether the context of the operation, which may be nil for the legacy driver methods, carries no span
+func (m *missingTraceContext) missing(c *opCall) bool {
+	return requestOp(c.op) && (c.ctx == nil || !m.hasSpan(c.ctx))
+}
+
+// checkTraceContext counts and logs the statements and transactions run without a span in their context
+func (c *opCall) checkTraceContext() {
+	if !c.missingTraceContext.missing(c) {
+		return
+	}
+
+	atomic.AddInt64(&c.missingTraceContext.count, 1)
+	site := c.caller
+	if site == "" {
+		site = caller()
+	}
+	if _, logged := c.missingTraceContext.callers.LoadOrStore(site, true); !logged {
+		c.events.Log(c.routeContext(), "sql-missing-trace-context", "op", c.opName(c.op), "query", c.shown, "caller", site)
+	}
+}
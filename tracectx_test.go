@@ -0,0 +1,124 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+type requestKey struct{}
+
+// schemaRewriter is a QueryRewriter qualifying the table t with a schema
+type schemaRewriter struct{}
+
+func (schemaRewriter) Before(ctx context.Context, op Op, query string, args []driver.NamedValue) (context.Context, error) {
+	return ctx, nil
+}
+
+func (schemaRewriter) After(ctx context.Context, op Op, query string, args []driver.NamedValue, result interface{}, err error, duration time.Duration) {
+}
+
+func (schemaRewriter) RewriteQuery(ctx context.Context, op Op, query string) string {
+	return strings.ReplaceAll(query, " t", " tenant1.t")
+}
+
+func TestMissingTraceContext(t *testing.T) {
+	logger := instrumentedsqltest.NewLogger()
+	d := WrapDriver(&fakeDriver{}, WithLogger(logger), WithMissingTraceContext(func(ctx context.Context) bool {
+		return ctx.Value(requestKey{}) != nil
+	}))
+	db := openBenchDB(t, d, "")
+
+	request := context.WithValue(context.Background(), requestKey{}, "request")
+	for n := 0; n < 3; n++ {
+		if _, err := db.ExecContext(request, "UPDATE t SET a = 1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("UPDATE t SET a = 2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := d.(interface{ MissingTraceContexts() int64 }).MissingTraceContexts(); n != 3 {
+		t.Errorf("counted %d operations without a span, want 3", n)
+	}
+	missing := logger.Find("sql-missing-trace-context")
+	if len(missing) != 1 || missing[0].Query != "UPDATE t SET a = 2" || missing[0].Labels["caller"] == nil {
+		t.Errorf("logged %+v, want the call site once", missing)
+	}
+}
+
+func TestOrphanSpans(t *testing.T) {
+	tr := instrumentedsqltest.NewTracer()
+	d := WrapDriver(&fakeDriver{rows: 2}, WithTracer(tr), WithOrphanSpans(), WithMissingTraceContext(func(ctx context.Context) bool {
+		return ctx.Value(requestKey{}) != nil
+	}))
+
+	// database/sql always passes a context, the legacy methods are only called by code using the driver directly
+	conn, err := d.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.(driver.Execer).Exec("UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := conn.(driver.Queryer).Query("SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	db := openBenchDB(t, d, "")
+	if _, err := db.Exec("DELETE FROM t"); err != nil {
+		t.Fatal(err)
+	}
+	request := context.WithValue(context.Background(), requestKey{}, "request")
+	if _, err := db.ExecContext(request, "INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var orphans []string
+	for _, span := range tr.Spans() {
+		if span.Labels["orphan"] == "true" && span.Finished {
+			orphans = append(orphans, span.Labels["query"])
+		}
+	}
+	if !reflect.DeepEqual(orphans, []string{"UPDATE t SET a = 1", "SELECT a FROM t", "DELETE FROM t"}) {
+		t.Errorf("recorded orphan spans for %q", orphans)
+	}
+}
+
+func TestOrphanSpansSendRewrittenQuery(t *testing.T) {
+	parent := &fakeDriver{api: fakeExecerAPI}
+	tr := instrumentedsqltest.NewTracer()
+	conn, err := WrapDriver(parent, WithTracer(tr), WithOrphanSpans(), WithHooks(schemaRewriter{}), WithSQLCommenter("app")).Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.(driver.Execer).Exec("UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := conn.(driver.Queryer).Query("SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	want := []string{"UPDATE tenant1.t SET a = 1 /*application='app'*/", "SELECT a FROM tenant1.t /*application='app'*/"}
+	if sent := parent.sentQueries(); !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	for _, span := range tr.Spans() {
+		if span.Labels["rewritten_query"] != strings.ReplaceAll(span.Labels["query"], " t", " tenant1.t") {
+			t.Errorf("span %+v does not record the query sent", span)
+		}
+	}
+}
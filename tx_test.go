@@ -0,0 +1,37 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestTxOptionsLabels(t *testing.T) {
+	cases := []struct {
+		opts          *sql.TxOptions
+		wantIsolation string
+		wantReadOnly  string
+	}{
+		{opts: nil, wantIsolation: "Default", wantReadOnly: "false"},
+		{opts: &sql.TxOptions{Isolation: sql.LevelSerializable}, wantIsolation: "Serializable", wantReadOnly: "false"},
+		{opts: &sql.TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true}, wantIsolation: "Read Committed", wantReadOnly: "true"},
+	}
+
+	for _, tc := range cases {
+		logger := instrumentedsqltest.NewLogger()
+		db := openBenchDB(t, WrapDriver(&fakeDriver{}, WithLogger(logger)), "")
+
+		tx, err := db.BeginTx(context.Background(), tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Rollback()
+
+		begins := logger.Find(string(OpSQLTxBegin))
+		if len(begins) != 1 || begins[0].Labels["isolation"] != tc.wantIsolation || begins[0].Labels["read_only"] != tc.wantReadOnly {
+			t.Errorf("BeginTx(%+v) recorded as %+v, want isolation %q and read_only %s", tc.opts, begins, tc.wantIsolation, tc.wantReadOnly)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package instrumentedsql
+
+import "context"
+
+// WideEventFunc sends a wide event, such as a Honeycomb event, whose fields are flat and named like db.fingerprint
+type WideEventFunc func(ctx context.Context, fields map[string]interface{}) error
+
+// wideEventSink flattens the events of statements into wide events, see NewWideEventSink
+type wideEventSink struct {
+	send WideEventFunc
+}
+
+// NewWideEventSink returns an EventSink sending one wide event per statement run to send, with all of its attributes
+// as flat fields: timestamp, duration_ms, error, trace.trace_id and db.* fields such as db.query, db.fingerprint,
+// db.rows, db.conn_id, along with the other labels of the statement such as db.caller or db.tenant.
+// This suits pipelines querying events rather than span trees, the other operations such as prepares are left out.
+func NewWideEventSink(send WideEventFunc) EventSink {
+	return wideEventSink{send: send}
+}
+
+func (s wideEventSink) WriteEvent(ctx context.Context, event QueryEvent) error {
+	if !event.Statement {
+		return nil
+	}
+
+	return s.send(ctx, event.Fields())
+}
+
+// Fields returns the event as the flat fields of a wide event, see NewWideEventSink
+func (e QueryEvent) Fields() map[string]interface{} {
+	fields := make(map[string]interface{}, 12+len(e.Labels))
+	for k, v := range e.Labels {
+		fields["db."+k] = v
+	}
+
+	fields["timestamp"] = e.Time
+	fields["duration_ms"] = float64(e.Duration) / 1e6
+	fields["db.op"] = e.Op
+	fields["db.query"] = e.Query
+	fields["db.fingerprint"] = e.Fingerprint
+	fields["db.rows"] = e.Rows
+	fields["db.conn_id"] = e.ConnID
+	if e.Args != "" {
+		fields["db.args"] = e.Args
+	}
+	if e.DB != "" {
+		fields["db.name"] = e.DB
+	}
+	if e.Err != "" {
+		fields["error"] = e.Err
+	}
+	if e.TraceID != "" {
+		fields["trace.trace_id"] = e.TraceID
+	}
+
+	return fields
+}
@@ -0,0 +1,147 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// Wrapper instruments connections and statements obtained without going through a wrapped driver,
+// such as the ones held by custom pools or proxies, see NewWrapper
+type Wrapper struct {
+	// driver holds the options shared by the connections and statements wrapped, it has no parent
+	driver wrappedDriver
+	// recording is unset if nothing would be recorded, connections and statements are then returned as is
+	// and the options of driver are empty, so that its methods report nothing
+	recording bool
+}
+
+// NewWrapper returns a Wrapper instrumenting connections and statements with options the way WrapDriver does.
+// The connections and statements it wraps share its options and statistics, so a pool should use a single Wrapper,
+// and call Shutdown once it is closed to stop the background reporting.
+// As there is no parent driver, WithDBName does not register the wrapper in Drivers, EXPLAINs are not run and the
+// database system is only detected from the type of the first connection or statement wrapped unless WithDBSystem is used.
+func NewWrapper(options ...Opt) *Wrapper {
+	w := newWrapper(newOpts(nil, options))
+	w.driver.startReporting()
+
+	return w
+}
+
+// newWrapper returns a wrapper using o, which is nil if nothing would be recorded
+func newWrapper(o *opts) *Wrapper {
+	if o == nil {
+		return &Wrapper{driver: wrappedDriver{opts: &opts{}}}
+	}
+
+	return &Wrapper{driver: wrappedDriver{opts: o}, recording: true}
+}
+
+// WrapConn returns conn instrumented as if it was opened by a wrapped driver, its opening is not recorded.
+// As the DSN of conn is not known, the labels of WithDSNAttributes are not recorded.
+func (w *Wrapper) WrapConn(conn driver.Conn) driver.Conn {
+	if !w.recording || conn == nil {
+		return conn
+	}
+	w.detectSystem(conn)
+
+	c := w.driver.newConn("")
+	c.parent = conn
+	c.caps = detectConnCapabilities(conn)
+	c.opened = time.Now()
+
+	return c
+}
+
+// WrapStmt returns stmt, prepared with query, instrumented as if it was prepared on a wrapped connection.
+// The statement is recorded on a connection of its own, whose DSN is not known, so the labels of WithDSNAttributes
+// are not recorded. Statements prepared on a connection wrapped with WrapConn are already instrumented.
+func (w *Wrapper) WrapStmt(stmt driver.Stmt, query string) driver.Stmt {
+	if !w.recording || stmt == nil {
+		return stmt
+	}
+	w.detectSystem(stmt)
+
+	return w.driver.newConn("").wrapStmt(context.Background(), query, stmt)
+}
+
+// detectSystem sets the database system from the type of parent if it is not known yet
+func (w *Wrapper) detectSystem(parent interface{}) {
+	o := w.driver.opts
+	o.detectSystem.Do(func() {
+		if o.dbSystem != "" {
+			return
+		}
+		o.dbSystem = dbSystem(parent)
+		if o.namedArgs == nil && namedValueSystems[o.dbSystem] {
+			o.namedArgs = NamedArgsAsValues
+		}
+	})
+}
+
+// Stats returns the statistics of the queries run on the connections and statements wrapped, see WithQueryStats
+func (w *Wrapper) Stats() []QueryStats {
+	return w.driver.Stats()
+}
+
+// PingStats returns the number of successful and failed pings of the connections wrapped, see WithPingMonitor
+func (w *Wrapper) PingStats() PingStats {
+	return w.driver.PingStats()
+}
+
+// MissingTraceContexts returns the number of queries and transactions run without a span in their context,
+// see WithMissingTraceContext
+func (w *Wrapper) MissingTraceContexts() int64 {
+	return w.driver.MissingTraceContexts()
+}
+
+// QueryCacheStats returns the number of hits, misses and evictions of the query cache, see WithQueryCache
+func (w *Wrapper) QueryCacheStats() QueryCacheStats {
+	return w.driver.QueryCacheStats()
+}
+
+// StatementCacheStats returns the number of hits, misses and evictions of the statement caches of the connections wrapped,
+// see WithStatementCache
+func (w *Wrapper) StatementCacheStats() StatementCacheStats {
+	return w.driver.StatementCacheStats()
+}
+
+// Flush waits for the background work of the wrapper to be done, then flushes the event sink and the logger,
+// see the Flush method of the drivers returned by WrapDriver
+func (w *Wrapper) Flush(ctx context.Context) error {
+	return w.driver.Flush(ctx)
+}
+
+// Shutdown stops the background reporting of the wrapper then flushes it,
+// see the Shutdown method of the drivers returned by WrapDriver
+func (w *Wrapper) Shutdown(ctx context.Context) error {
+	return w.driver.Shutdown(ctx)
+}
+
+// SetEnabled switches the instrumentation of the connections and statements wrapped on or off at runtime, see WithEnabled
+func (w *Wrapper) SetEnabled(enabled bool) {
+	w.driver.SetEnabled(enabled)
+}
+
+// WrapConn returns conn instrumented with options, for the libraries holding a driver.Conn rather than a driver.
+// Each call sets up instrumentation of its own, whose statistics cannot be read and whose sinks cannot be flushed,
+// so WithSlowQueryReport is ignored. Use a single Wrapper for the connections of a pool instead.
+func WrapConn(conn driver.Conn, options ...Opt) driver.Conn {
+	return oneShotWrapper(options).WrapConn(conn)
+}
+
+// WrapStmt returns stmt, prepared with query, instrumented with options, for the libraries holding a driver.Stmt.
+// Like WrapConn, each call sets up instrumentation of its own, use a single Wrapper for many statements instead.
+func WrapStmt(stmt driver.Stmt, query string, options ...Opt) driver.Stmt {
+	return oneShotWrapper(options).WrapStmt(stmt, query)
+}
+
+// oneShotWrapper returns a wrapper without background reporting, which could never be stopped
+func oneShotWrapper(options []Opt) *Wrapper {
+	o := newOpts(nil, options)
+	if o != nil {
+		o.slowQueryReport = nil
+	}
+
+	return newWrapper(o)
+}
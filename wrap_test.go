@@ -0,0 +1,114 @@
+package instrumentedsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/away-team/instrumentedsql/instrumentedsqltest"
+)
+
+func TestWrapper(t *testing.T) {
+	ctx := context.Background()
+	d := &fakeDriver{}
+	logger := instrumentedsqltest.NewLogger()
+	w := NewWrapper(WithLogger(logger))
+
+	for n := 0; n < 2; n++ {
+		parent, err := d.Open("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn := w.WrapConn(parent)
+		if _, err := conn.(driver.ExecerContext).ExecContext(ctx, "UPDATE t SET a = 1", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		stmt, err := parent.Prepare("DELETE FROM t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.WrapStmt(stmt, "DELETE FROM t").(driver.StmtExecContext).ExecContext(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	execs := logger.Find(string(OpSQLConnExec))
+	if len(execs) != 2 || execs[0].Query != "UPDATE t SET a = 1" || execs[0].Labels["conn_id"] == execs[1].Labels["conn_id"] {
+		t.Errorf("logged %+v, want an exec per connection", execs)
+	}
+	if stmtExecs := logger.Find(string(OpSQLStmtExec)); len(stmtExecs) != 2 || stmtExecs[0].Query != "DELETE FROM t" {
+		t.Errorf("logged %+v, want the statements executed", stmtExecs)
+	}
+}
+
+func TestWrapperLifecycle(t *testing.T) {
+	ctx := context.Background()
+	var reported []QueryStats
+	w := NewWrapper(WithQueryStats(), WithSlowQueryReport(time.Hour, 1, func(stats []QueryStats) { reported = stats }))
+
+	parent, err := (&fakeDriver{}).Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WrapConn(parent).(driver.ExecerContext).ExecContext(ctx, "UPDATE t SET a = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := w.Stats(); len(stats) != 1 || stats[0].Count != 1 {
+		t.Errorf("stats are %+v, want the exec", stats)
+	}
+	if err := w.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 1 {
+		t.Errorf("reported %+v on shutdown, want the exec", reported)
+	}
+
+	if conn := WrapConn(parent, WithSlowQueryReport(time.Hour, 1, nil)).(*wrappedConn); conn.slowQueryReport != nil {
+		t.Error("WrapConn set up a slow query report that could never be stopped")
+	}
+}
+
+func TestWrapConnWithoutOptions(t *testing.T) {
+	parent, err := (&fakeDriver{}).Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conn := WrapConn(parent); conn != parent {
+		t.Errorf("WrapConn returned %T, want the parent connection as nothing is recorded", conn)
+	}
+}
+
+func TestWrapperWithoutOptions(t *testing.T) {
+	w := NewWrapper()
+	parent := &fakeBareStmt{}
+	if stmt := w.WrapStmt(parent, "SELECT 1"); stmt != parent {
+		t.Errorf("WrapStmt returned %T, want the parent statement as nothing is recorded", stmt)
+	}
+
+	w.SetEnabled(false)
+	if stats := w.Stats(); stats != nil {
+		t.Errorf("Stats() = %v, want none", stats)
+	}
+	if stats := w.PingStats(); stats != (PingStats{}) {
+		t.Errorf("PingStats() = %+v, want none", stats)
+	}
+	if n := w.MissingTraceContexts(); n != 0 {
+		t.Errorf("MissingTraceContexts() = %d, want 0", n)
+	}
+	if stats := w.QueryCacheStats(); stats != (QueryCacheStats{}) {
+		t.Errorf("QueryCacheStats() = %+v, want none", stats)
+	}
+	if stats := w.StatementCacheStats(); stats != (StatementCacheStats{}) {
+		t.Errorf("StatementCacheStats() = %+v, want none", stats)
+	}
+	if err := w.Flush(context.Background()); err != nil {
+		t.Errorf("Flush() = %v", err)
+	}
+	if err := w.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() = %v", err)
+	}
+}